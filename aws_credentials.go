@@ -0,0 +1,574 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// errSSOTokenExpired is returned when the cached SSO access token is missing or expired, which
+// means the user must log in again.
+var errSSOTokenExpired = errors.New("the SSO session associated with this profile has expired or is otherwise invalid")
+
+// awsProfileSettings holds the settings of a profile in the shared AWS config files.
+type awsProfileSettings struct {
+	Name                  string
+	Region                string
+	AccessKeyID           string
+	SecretAccessKey       string
+	SessionToken          string
+	SSOSession            string
+	SSOStartURL           string
+	SSORegion             string
+	SSOAccountID          string
+	SSORoleName           string
+	SSORegistrationScopes string
+	RoleARN               string
+	CredentialProcess     string
+}
+
+// ssoTokenCache mirrors the token files the AWS CLI keeps in ~/.aws/sso/cache, so that a login
+// made by either backend is visible to the other.
+type ssoTokenCache struct {
+	StartURL              string `json:"startUrl,omitempty"`
+	Region                string `json:"region,omitempty"`
+	AccessToken           string `json:"accessToken,omitempty"`
+	ExpiresAt             string `json:"expiresAt,omitempty"`
+	ClientID              string `json:"clientId,omitempty"`
+	ClientSecret          string `json:"clientSecret,omitempty"`
+	RegistrationExpiresAt string `json:"registrationExpiresAt,omitempty"`
+	RefreshToken          string `json:"refreshToken,omitempty"`
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// awsHomeDir returns the directory the AWS CLI expands "~" to, which is $HOME when it is set.
+func awsHomeDir() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return home
+	}
+
+	return getUserHomeDir()
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// sharedConfigPath returns the location of the AWS config file, honouring AWS_CONFIG_FILE.
+func sharedConfigPath() string {
+	if path := os.Getenv("AWS_CONFIG_FILE"); path != "" {
+		return path
+	}
+
+	return filepath.Join(awsHomeDir(), ".aws", "config")
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// sharedCredentialsPath returns the location of the AWS credentials file, honouring
+// AWS_SHARED_CREDENTIALS_FILE.
+func sharedCredentialsPath() string {
+	if path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); path != "" {
+		return path
+	}
+
+	return filepath.Join(awsHomeDir(), ".aws", "credentials")
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// ssoCachePath returns the token cache file for an SSO session name or legacy start URL.
+func ssoCachePath(cacheKey string) string {
+	hash := sha1.Sum([]byte(cacheKey))
+	return filepath.Join(awsHomeDir(), ".aws", "sso", "cache", hex.EncodeToString(hash[:])+".json")
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// readINIFile parses an AWS style INI file into a map of section name to key/value settings.
+// A missing file is not an error.
+func readINIFile(path string) (map[string]map[string]string, error) {
+	sections := make(map[string]map[string]string)
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return sections, nil
+		}
+
+		return nil, err
+	}
+	defer file.Close()
+
+	var current map[string]string
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.Join(strings.Fields(line[1:len(line)-1]), " ")
+
+			if _, exists := sections[name]; !exists {
+				sections[name] = make(map[string]string)
+			}
+
+			current = sections[name]
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found || current == nil {
+			continue
+		}
+
+		current[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+
+	return sections, scanner.Err()
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// resolveProfileName applies the AWS CLI rules for choosing a profile when none is given.
+func resolveProfileName(profile string) string {
+	if profile != "" {
+		return profile
+	}
+
+	if envProfile := os.Getenv("AWS_PROFILE"); envProfile != "" {
+		return envProfile
+	}
+
+	return "default"
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// loadAWSProfile reads a profile's settings from the shared config and credentials files.
+func loadAWSProfile(profile string) (awsProfileSettings, error) {
+	name := resolveProfileName(profile)
+	settings := awsProfileSettings{Name: name}
+
+	configSections, err := readINIFile(sharedConfigPath())
+	if err != nil {
+		return settings, fmt.Errorf("failed to read AWS config file: %v", err)
+	}
+
+	credentialSections, err := readINIFile(sharedCredentialsPath())
+	if err != nil {
+		return settings, fmt.Errorf("failed to read AWS credentials file: %v", err)
+	}
+
+	sectionName := "profile " + name
+	if name == "default" {
+		if _, exists := configSections[sectionName]; !exists {
+			sectionName = "default"
+		}
+	}
+
+	configSection, inConfig := configSections[sectionName]
+	credentialSection, inCredentials := credentialSections[name]
+
+	if !inConfig && !inCredentials {
+		return settings, fmt.Errorf("the config profile (%s) could not be found", name)
+	}
+
+	settings.Region = configSection["region"]
+	settings.SSOSession = configSection["sso_session"]
+	settings.SSOStartURL = configSection["sso_start_url"]
+	settings.SSORegion = configSection["sso_region"]
+	settings.SSOAccountID = configSection["sso_account_id"]
+	settings.SSORoleName = configSection["sso_role_name"]
+	settings.SSORegistrationScopes = configSection["sso_registration_scopes"]
+	settings.AccessKeyID = configSection["aws_access_key_id"]
+	settings.SecretAccessKey = configSection["aws_secret_access_key"]
+	settings.SessionToken = configSection["aws_session_token"]
+	settings.RoleARN = configSection["role_arn"]
+	settings.CredentialProcess = configSection["credential_process"]
+
+	if inCredentials {
+		settings.AccessKeyID = credentialSection["aws_access_key_id"]
+		settings.SecretAccessKey = credentialSection["aws_secret_access_key"]
+		settings.SessionToken = credentialSection["aws_session_token"]
+		settings.RoleARN = firstNonEmpty(credentialSection["role_arn"], settings.RoleARN)
+		settings.CredentialProcess = firstNonEmpty(credentialSection["credential_process"], settings.CredentialProcess)
+	}
+
+	// Settings from an [sso-session] section take precedence over legacy inline values
+	if settings.SSOSession != "" {
+		session, exists := configSections["sso-session "+settings.SSOSession]
+		if !exists {
+			return settings, fmt.Errorf("the sso-session (%s) referenced by profile %s could not be found", settings.SSOSession, name)
+		}
+
+		settings.SSOStartURL = session["sso_start_url"]
+		settings.SSORegion = session["sso_region"]
+		settings.SSORegistrationScopes = session["sso_registration_scopes"]
+	}
+
+	return settings, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (s awsProfileSettings) usesSSO() bool {
+	return s.SSOStartURL != ""
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (s awsProfileSettings) ssoCacheKey() string {
+	if s.SSOSession != "" {
+		return s.SSOSession
+	}
+
+	return s.SSOStartURL
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// resolveRegion applies the AWS CLI precedence for regions: explicit value, environment, then
+// the profile's configured region.
+func resolveRegion(explicit string, settings awsProfileSettings) (string, error) {
+	switch {
+	case explicit != "":
+		return explicit, nil
+	case os.Getenv("AWS_REGION") != "":
+		return os.Getenv("AWS_REGION"), nil
+	case os.Getenv("AWS_DEFAULT_REGION") != "":
+		return os.Getenv("AWS_DEFAULT_REGION"), nil
+	case settings.Region != "":
+		return settings.Region, nil
+	}
+
+	return "", fmt.Errorf("you must specify a region for profile %s", settings.Name)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// resolveCredentials returns credentials for a profile using, in order: environment variables
+// (only when no profile was requested), static keys in the shared files, and the SSO token
+// cache exchanged for role credentials through the SSO portal. Assume-role and
+// credential_process profiles are left to the AWS CLI.
+func (r *NativeRunner) resolveCredentials(profile string, settings awsProfileSettings) (awsCredentials, error) {
+	if profile == "" && os.Getenv("AWS_PROFILE") == "" && os.Getenv("AWS_ACCESS_KEY_ID") != "" {
+		return awsCredentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	if settings.RoleARN != "" {
+		return awsCredentials{}, unsupportedCredentialsError(settings.Name, "role_arn (assume role)")
+	}
+
+	if settings.AccessKeyID != "" {
+		return awsCredentials{
+			AccessKeyID:     settings.AccessKeyID,
+			SecretAccessKey: settings.SecretAccessKey,
+			SessionToken:    settings.SessionToken,
+		}, nil
+	}
+
+	if !settings.usesSSO() {
+		if settings.CredentialProcess != "" {
+			return awsCredentials{}, unsupportedCredentialsError(settings.Name, "credential_process")
+		}
+
+		return awsCredentials{}, fmt.Errorf("profile %s has no credentials that the native backend can use", settings.Name)
+	}
+
+	r.mu.Lock()
+	cached, exists := r.credentialCache[settings.Name]
+	r.mu.Unlock()
+
+	if exists && time.Until(cached.Expires) > time.Minute {
+		return cached, nil
+	}
+
+	token, err := readSSOToken(settings)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	creds, err := r.getRoleCredentials(settings, token.AccessToken)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	r.mu.Lock()
+	r.credentialCache[settings.Name] = creds
+	r.mu.Unlock()
+
+	return creds, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// unsupportedCredentialsError explains that a profile's credential source needs the CLI backend.
+func unsupportedCredentialsError(profile string, source string) error {
+	return fmt.Errorf("profile %s uses %s, which the native backend does not support; switch it to the AWS CLI with 'awsdo backend cli --profile %s'", profile, source, profile)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// readSSOToken loads the cached SSO access token for a profile and checks that it is still valid.
+func readSSOToken(settings awsProfileSettings) (ssoTokenCache, error) {
+	var token ssoTokenCache
+
+	tokenBytes, err := os.ReadFile(ssoCachePath(settings.ssoCacheKey()))
+	if err != nil {
+		return token, errSSOTokenExpired
+	}
+
+	if err := json.Unmarshal(tokenBytes, &token); err != nil {
+		return token, errSSOTokenExpired
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, token.ExpiresAt)
+	if err != nil || token.AccessToken == "" || time.Now().After(expiresAt) {
+		return token, errSSOTokenExpired
+	}
+
+	return token, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// getRoleCredentials exchanges an SSO access token for temporary role credentials.
+func (r *NativeRunner) getRoleCredentials(settings awsProfileSettings, accessToken string) (awsCredentials, error) {
+	if settings.SSOAccountID == "" || settings.SSORoleName == "" {
+		return awsCredentials{}, fmt.Errorf("profile %s is missing sso_account_id or sso_role_name", settings.Name)
+	}
+
+	query := url.Values{}
+	query.Set("account_id", settings.SSOAccountID)
+	query.Set("role_name", settings.SSORoleName)
+
+	req, err := http.NewRequest(http.MethodGet, r.endpoint("sso", settings.SSORegion)+"/federation/credentials?"+query.Encode(), nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	req.Header.Set("x-amz-sso_bearer_token", accessToken)
+
+	var result struct {
+		RoleCredentials struct {
+			AccessKeyID     string `json:"accessKeyId"`
+			SecretAccessKey string `json:"secretAccessKey"`
+			SessionToken    string `json:"sessionToken"`
+			Expiration      int64  `json:"expiration"`
+		} `json:"roleCredentials"`
+	}
+
+	if err := r.doJSON(req, "sso", "GetRoleCredentials", &result); err != nil {
+		var apiErr *awsAPIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+			return awsCredentials{}, errSSOTokenExpired
+		}
+
+		return awsCredentials{}, err
+	}
+
+	return awsCredentials{
+		AccessKeyID:     result.RoleCredentials.AccessKeyID,
+		SecretAccessKey: result.RoleCredentials.SecretAccessKey,
+		SessionToken:    result.RoleCredentials.SessionToken,
+		Expires:         time.UnixMilli(result.RoleCredentials.Expiration),
+	}, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// ssoLogin performs the SSO OIDC device authorization flow for a profile and stores the
+// resulting token in the shared SSO cache.
+func (r *NativeRunner) ssoLogin(profile string) error {
+	settings, err := loadAWSProfile(profile)
+	if err != nil {
+		return err
+	}
+
+	if !settings.usesSSO() {
+		return fmt.Errorf("profile %s is not configured for SSO", settings.Name)
+	}
+
+	cachePath := ssoCachePath(settings.ssoCacheKey())
+	token := ssoTokenCache{}
+
+	if existing, err := os.ReadFile(cachePath); err == nil {
+		json.Unmarshal(existing, &token)
+	}
+
+	// Register a client unless we still have a valid registration
+	registrationExpires, err := time.Parse(time.RFC3339, token.RegistrationExpiresAt)
+	if err != nil || token.ClientID == "" || time.Now().After(registrationExpires) {
+		registration := map[string]any{
+			"clientName": "awsdo",
+			"clientType": "public",
+		}
+
+		if settings.SSORegistrationScopes != "" {
+			var scopes []string
+
+			for _, scope := range strings.Split(settings.SSORegistrationScopes, ",") {
+				scopes = append(scopes, strings.TrimSpace(scope))
+			}
+
+			registration["scopes"] = scopes
+		} else if settings.SSOSession != "" {
+			registration["scopes"] = []string{"sso:account:access"}
+		}
+
+		var registered struct {
+			ClientID              string `json:"clientId"`
+			ClientSecret          string `json:"clientSecret"`
+			ClientSecretExpiresAt int64  `json:"clientSecretExpiresAt"`
+		}
+
+		if err := r.postOIDC(settings.SSORegion, "/client/register", "RegisterClient", registration, &registered); err != nil {
+			return fmt.Errorf("failed to register SSO client: %v", err)
+		}
+
+		token.ClientID = registered.ClientID
+		token.ClientSecret = registered.ClientSecret
+		token.RegistrationExpiresAt = time.Unix(registered.ClientSecretExpiresAt, 0).UTC().Format(time.RFC3339)
+	}
+
+	var authorization struct {
+		DeviceCode              string `json:"deviceCode"`
+		UserCode                string `json:"userCode"`
+		VerificationURI         string `json:"verificationUri"`
+		VerificationURIComplete string `json:"verificationUriComplete"`
+		ExpiresIn               int    `json:"expiresIn"`
+		Interval                int    `json:"interval"`
+	}
+
+	err = r.postOIDC(settings.SSORegion, "/device_authorization", "StartDeviceAuthorization", map[string]any{
+		"clientId":     token.ClientID,
+		"clientSecret": token.ClientSecret,
+		"startUrl":     settings.SSOStartURL,
+	}, &authorization)
+
+	if err != nil {
+		return fmt.Errorf("failed to start SSO device authorization: %v", err)
+	}
+
+	fmt.Println("Attempting to automatically open the SSO authorization page in your default browser.")
+	fmt.Println("If the browser does not open or you wish to use a different device to authorize this request, open the following URL:")
+	fmt.Println()
+	fmt.Println(authorization.VerificationURI)
+	fmt.Println()
+	fmt.Println("Then enter the code:")
+	fmt.Println()
+	fmt.Println(authorization.UserCode)
+
+	go openBrowser(authorization.VerificationURIComplete)
+
+	interval := time.Duration(authorization.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	deadline := time.Now().Add(time.Duration(authorization.ExpiresIn) * time.Second)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		var created struct {
+			AccessToken  string `json:"accessToken"`
+			ExpiresIn    int    `json:"expiresIn"`
+			RefreshToken string `json:"refreshToken"`
+		}
+
+		err := r.postOIDC(settings.SSORegion, "/token", "CreateToken", map[string]any{
+			"clientId":     token.ClientID,
+			"clientSecret": token.ClientSecret,
+			"grantType":    "urn:ietf:params:oauth:grant-type:device_code",
+			"deviceCode":   authorization.DeviceCode,
+		}, &created)
+
+		var apiErr *awsAPIError
+		if errors.As(err, &apiErr) {
+			switch apiErr.Code {
+			case "AuthorizationPendingException", "authorization_pending":
+				continue
+			case "SlowDownException", "slow_down":
+				interval += 5 * time.Second
+				continue
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to create SSO token: %v", err)
+		}
+
+		token.StartURL = settings.SSOStartURL
+		token.Region = settings.SSORegion
+		token.AccessToken = created.AccessToken
+		token.RefreshToken = created.RefreshToken
+		token.ExpiresAt = time.Now().Add(time.Duration(created.ExpiresIn) * time.Second).UTC().Format(time.RFC3339)
+
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err != nil {
+			return err
+		}
+
+		tokenBytes, _ := json.MarshalIndent(token, "", "    ")
+		if err := os.WriteFile(cachePath, tokenBytes, 0600); err != nil {
+			return err
+		}
+
+		// Drop any role credentials obtained with the previous token
+		r.mu.Lock()
+		delete(r.credentialCache, settings.Name)
+		r.mu.Unlock()
+
+		fmt.Printf("Successfully logged into Start URL: %s\n", settings.SSOStartURL)
+		return nil
+	}
+
+	return fmt.Errorf("SSO authorization timed out")
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// postOIDC calls an unsigned SSO OIDC operation.
+func (r *NativeRunner) postOIDC(region string, path string, operation string, input any, result any) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, r.endpoint("sso-oidc", region)+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return r.doJSON(req, "sso-oidc", operation, result)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// doJSON sends a request and decodes a JSON response, converting error documents to awsAPIError.
+func (r *NativeRunner) doJSON(req *http.Request, service string, operation string, result any) error {
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		return parseJSONError(service, operation, resp, respBody)
+	}
+
+	if result == nil || len(respBody) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(respBody, result)
+}
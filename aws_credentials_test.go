@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testSSOConfig = `[profile dev]
+sso_session = corp
+sso_account_id = 123456789012
+sso_role_name = Developer
+region = eu-west-1
+
+[sso-session corp]
+sso_start_url = https://corp.awsapps.com/start
+sso_region = us-east-1
+`
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// useTestAWSHome points the AWS config, credentials and SSO cache at a temporary home directory
+// and writes config as its ~/.aws/config.
+func useTestAWSHome(t *testing.T, config string) {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(home, ".aws", "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(home, ".aws", "credentials"))
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+
+	if err := os.MkdirAll(filepath.Join(home, ".aws", "sso", "cache"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(home, ".aws", "config"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func writeTestSSOToken(t *testing.T, cacheKey string, accessToken string, expiresAt time.Time) {
+	t.Helper()
+
+	token, _ := json.Marshal(ssoTokenCache{
+		StartURL:    "https://corp.awsapps.com/start",
+		Region:      "us-east-1",
+		AccessToken: accessToken,
+		ExpiresAt:   expiresAt.UTC().Format(time.RFC3339),
+	})
+
+	if err := os.WriteFile(ssoCachePath(cacheKey), token, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestResolveCredentialsExchangesSSOToken(t *testing.T) {
+	useTestAWSHome(t, testSSOConfig)
+	writeTestSSOToken(t, "corp", "access-token", time.Now().Add(time.Hour))
+
+	var calls atomic.Int32
+
+	runner := newTestNativeRunner(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		query := r.URL.Query()
+		if r.URL.Path != "/federation/credentials" || query.Get("account_id") != "123456789012" || query.Get("role_name") != "Developer" {
+			t.Errorf("request = %s, want role credentials for 123456789012/Developer", r.URL)
+		}
+
+		if token := r.Header.Get("x-amz-sso_bearer_token"); token != "access-token" {
+			t.Errorf("bearer token = %q, want access-token", token)
+		}
+
+		expiration := time.Now().Add(time.Hour).UnixMilli()
+		json.NewEncoder(w).Encode(map[string]any{
+			"roleCredentials": map[string]any{
+				"accessKeyId":     "ASIAEXAMPLE",
+				"secretAccessKey": "secret",
+				"sessionToken":    "session",
+				"expiration":      expiration,
+			},
+		})
+	}, "sso")
+
+	settings, err := loadAWSProfile("dev")
+	if err != nil {
+		t.Fatalf("loadAWSProfile failed: %v", err)
+	}
+
+	for range 2 {
+		creds, err := runner.resolveCredentials("dev", settings)
+		if err != nil {
+			t.Fatalf("resolveCredentials failed: %v", err)
+		}
+
+		if creds.AccessKeyID != "ASIAEXAMPLE" || creds.SecretAccessKey != "secret" || creds.SessionToken != "session" {
+			t.Errorf("credentials = %+v", creds)
+		}
+	}
+
+	if calls.Load() != 1 {
+		t.Errorf("GetRoleCredentials called %d times, want 1 with the second lookup cached", calls.Load())
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestResolveCredentialsNeedsValidSSOToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T)
+	}{
+		{
+			name:  "missing",
+			setup: func(t *testing.T) {},
+		},
+		{
+			name: "expired",
+			setup: func(t *testing.T) {
+				writeTestSSOToken(t, "corp", "access-token", time.Now().Add(-time.Minute))
+			},
+		},
+		{
+			name: "corrupt",
+			setup: func(t *testing.T) {
+				os.WriteFile(ssoCachePath("corp"), []byte("{"), 0600)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestAWSHome(t, testSSOConfig)
+			test.setup(t)
+
+			runner := newTestNativeRunner(t, func(w http.ResponseWriter, r *http.Request) {
+				t.Errorf("unexpected request %s", r.URL)
+			}, "sso")
+
+			settings, err := loadAWSProfile("dev")
+			if err != nil {
+				t.Fatalf("loadAWSProfile failed: %v", err)
+			}
+
+			if _, err := runner.resolveCredentials("dev", settings); !errors.Is(err, errSSOTokenExpired) {
+				t.Errorf("error = %v, want errSSOTokenExpired", err)
+			}
+		})
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// A token the portal no longer accepts means the user has to log in again, like an expired one.
+func TestGetRoleCredentialsRejectedToken(t *testing.T) {
+	useTestAWSHome(t, testSSOConfig)
+
+	runner := newTestNativeRunner(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message": "Session token not found or invalid"}`))
+	}, "sso")
+
+	settings, err := loadAWSProfile("dev")
+	if err != nil {
+		t.Fatalf("loadAWSProfile failed: %v", err)
+	}
+
+	if _, err := runner.getRoleCredentials(settings, "revoked"); !errors.Is(err, errSSOTokenExpired) {
+		t.Errorf("error = %v, want errSSOTokenExpired", err)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestResolveCredentialsRejectsUnsupportedProfiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		source string
+	}{
+		{
+			name:   "assume role",
+			config: "[profile dev]\nrole_arn = arn:aws:iam::123456789012:role/Admin\nsource_profile = base\n\n[profile base]\naws_access_key_id = AKID\naws_secret_access_key = SECRET\n",
+			source: "role_arn",
+		},
+		{
+			name:   "credential process",
+			config: "[profile dev]\ncredential_process = /usr/local/bin/get-credentials\n",
+			source: "credential_process",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestAWSHome(t, test.config)
+
+			settings, err := loadAWSProfile("dev")
+			if err != nil {
+				t.Fatalf("loadAWSProfile failed: %v", err)
+			}
+
+			_, err = NewNativeRunner(&Configuration{}).resolveCredentials("dev", settings)
+			if err == nil || !strings.Contains(err.Error(), test.source) || !strings.Contains(err.Error(), "awsdo backend cli --profile dev") {
+				t.Errorf("error = %v, want one naming %s and the CLI backend", err, test.source)
+			}
+		})
+	}
+}
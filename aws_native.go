@@ -0,0 +1,865 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	backendCLI    = "cli"
+	backendNative = "native"
+)
+
+// NativeRunner is an AWSRunner that calls the AWS APIs directly instead of shelling out to the
+// AWS CLI. It understands the subset of AWS CLI commands used by awsdo and produces the same
+// JSON documents the CLI would, so callers do not need to know which backend is active.
+type NativeRunner struct {
+	// config supplies endpoint overrides (e.g. "ec2": "http://localhost:4566") and the SSM
+	// session client setting.
+	config *Configuration
+
+	client          *http.Client
+	mu              sync.Mutex
+	credentialCache map[string]awsCredentials
+}
+
+// nativeCommand is an AWS CLI command line split into its service, operation and options.
+type nativeCommand struct {
+	Service   string
+	Operation string
+	Options   map[string][]string
+}
+
+// nativeSession holds what is needed to make signed calls for a profile.
+type nativeSession struct {
+	Profile     string
+	Region      string
+	Settings    awsProfileSettings
+	Credentials awsCredentials
+}
+
+// nativeOperation implements one AWS CLI command and returns the document the CLI would print.
+type nativeOperation func(r *NativeRunner, session nativeSession, command nativeCommand) (any, error)
+
+// nativeOperations maps "service operation" to its implementation.
+var nativeOperations = map[string]nativeOperation{
+	"sts get-caller-identity":                 nativeGetCallerIdentity,
+	"ec2 describe-instances":                  nativeDescribeInstances,
+	"ec2 describe-regions":                    nativeDescribeRegions,
+	"rds describe-db-instances":               nativeDescribeDBInstances,
+	"rds describe-db-clusters":                nativeDescribeDBClusters,
+	"elasticache describe-replication-groups": nativeDescribeReplicationGroups,
+	"elasticache describe-cache-clusters":     nativeDescribeCacheClusters,
+	"redshift describe-clusters":              nativeDescribeRedshiftClusters,
+	"opensearch list-domain-names":            nativeListOpenSearchDomainNames,
+	"opensearch describe-domains":             nativeDescribeOpenSearchDomains,
+	"secretsmanager get-secret-value":         nativeGetSecretValue,
+	"ssm describe-instance-information":       nativeDescribeInstanceInformation,
+	"configure export-credentials":            nativeExportCredentials,
+}
+
+// awsAPIError is an error document returned by an AWS API.
+type awsAPIError struct {
+	Operation  string
+	Code       string
+	Message    string
+	StatusCode int
+}
+
+func (e *awsAPIError) Error() string {
+	return fmt.Sprintf("An error occurred (%s) when calling the %s operation: %s", e.Code, e.Operation, e.Message)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func NewNativeRunner(config *Configuration) *NativeRunner {
+	return &NativeRunner{
+		config:          config,
+		client:          &http.Client{Timeout: 60 * time.Second},
+		credentialCache: make(map[string]awsCredentials),
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (r *NativeRunner) Output(profile string, args ...string) ([]byte, error) {
+	output, err := r.execute(profile, args)
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (r *NativeRunner) Check(profile string, args ...string) error {
+	_, err := r.execute(profile, args)
+	return err
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (r *NativeRunner) Run(profile string, args ...string) error {
+	command, err := parseNativeCommand(args)
+	if err != nil {
+		return err
+	}
+
+	switch command.name() {
+	case "sso login":
+		return r.ssoLogin(profile)
+	case "ssm start-session":
+		return r.runSession(profile, command)
+	}
+
+	output, err := r.Output(profile, args...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(output))
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (r *NativeRunner) Start(profile string, args ...string) (AWSProcess, error) {
+	command, err := parseNativeCommand(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if command.name() != "ssm start-session" {
+		return nil, fmt.Errorf("the native backend cannot start '%s'", command.name())
+	}
+
+	return r.startSession(profile, command)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (r *NativeRunner) execute(profile string, args []string) ([]byte, error) {
+	command, err := parseNativeCommand(args)
+	if err != nil {
+		return nil, err
+	}
+
+	operation, exists := nativeOperations[command.name()]
+	if !exists {
+		return nil, fmt.Errorf("the native backend does not support '%s'", command.name())
+	}
+
+	session, err := r.session(profile, command)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := operation(r, session, command)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(result, "", "    ")
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// session resolves the region and credentials to use for a command.
+func (r *NativeRunner) session(profile string, command nativeCommand) (nativeSession, error) {
+	settings, err := loadAWSProfile(profile)
+	if err != nil {
+		return nativeSession{}, err
+	}
+
+	region, err := resolveRegion(command.option("region"), settings)
+	if err != nil {
+		return nativeSession{}, err
+	}
+
+	creds, err := r.resolveCredentials(profile, settings)
+	if err != nil {
+		return nativeSession{}, err
+	}
+
+	return nativeSession{
+		Profile:     settings.Name,
+		Region:      region,
+		Settings:    settings,
+		Credentials: creds,
+	}, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// endpoint returns the base URL for a service. Overrides come from the awsdo configuration,
+// then the standard AWS_ENDPOINT_URL_<SERVICE> and AWS_ENDPOINT_URL environment variables.
+func (r *NativeRunner) endpoint(service string, region string) string {
+	if override, exists := r.config.Endpoints[service]; exists && override != "" {
+		return strings.TrimRight(override, "/")
+	}
+
+	envName := "AWS_ENDPOINT_URL_" + strings.ToUpper(strings.ReplaceAll(service, "-", "_"))
+	if override := os.Getenv(envName); override != "" {
+		return strings.TrimRight(override, "/")
+	}
+
+	if override := os.Getenv("AWS_ENDPOINT_URL"); override != "" {
+		return strings.TrimRight(override, "/")
+	}
+
+	switch service {
+	case "sso":
+		return fmt.Sprintf("https://portal.sso.%s.amazonaws.com", region)
+	case "sso-oidc":
+		return fmt.Sprintf("https://oidc.%s.amazonaws.com", region)
+	case "opensearch":
+		return fmt.Sprintf("https://es.%s.amazonaws.com", region)
+	}
+
+	return fmt.Sprintf("https://%s.%s.amazonaws.com", service, region)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// callQuery calls an AWS Query protocol API (EC2, RDS, STS) and decodes the XML response.
+func (r *NativeRunner) callQuery(session nativeSession, service string, version string, params url.Values, result any) error {
+	params.Set("Version", version)
+	body := []byte(params.Encode())
+
+	req, err := http.NewRequest(http.MethodPost, r.endpoint(service, session.Region)+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signRequest(req, body, session.Credentials, service, session.Region, time.Now())
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		return parseXMLError(params.Get("Action"), resp.StatusCode, respBody)
+	}
+
+	return xml.Unmarshal(respBody, result)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// callJSON calls an AWS JSON 1.1 protocol API (SSM, Secrets Manager) and decodes the JSON response.
+func (r *NativeRunner) callJSON(session nativeSession, service string, targetPrefix string, operation string, input any, result any) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, r.endpoint(service, session.Region)+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", targetPrefix+"."+operation)
+	signRequest(req, body, session.Credentials, service, session.Region, time.Now())
+
+	return r.doJSON(req, service, operation, result)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// callREST calls an AWS REST-JSON protocol API (OpenSearch) and decodes the JSON response. The
+// input, if any, is sent as the JSON body. signingName is the service name used for signing.
+func (r *NativeRunner) callREST(session nativeSession, service string, signingName string, method string, path string, operation string, input any, result any) error {
+	var body []byte
+
+	if input != nil {
+		var err error
+		if body, err = json.Marshal(input); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, r.endpoint(service, session.Region)+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	signRequest(req, body, session.Credentials, signingName, session.Region, time.Now())
+
+	return r.doJSON(req, service, operation, result)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func parseXMLError(operation string, statusCode int, body []byte) error {
+	var document struct {
+		Errors []struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		} `xml:"Errors>Error"`
+		Error struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		} `xml:"Error"`
+	}
+
+	apiErr := &awsAPIError{Operation: operation, StatusCode: statusCode, Code: strconv.Itoa(statusCode)}
+
+	if err := xml.Unmarshal(body, &document); err == nil {
+		if len(document.Errors) > 0 {
+			apiErr.Code = document.Errors[0].Code
+			apiErr.Message = document.Errors[0].Message
+		} else if document.Error.Code != "" {
+			apiErr.Code = document.Error.Code
+			apiErr.Message = document.Error.Message
+		}
+	}
+
+	return apiErr
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func parseJSONError(service string, operation string, resp *http.Response, body []byte) error {
+	var document struct {
+		Type             string `json:"__type"`
+		Error            string `json:"error"`
+		Message          string `json:"message"`
+		MessageUpper     string `json:"Message"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	json.Unmarshal(body, &document)
+
+	apiErr := &awsAPIError{Operation: operation, StatusCode: resp.StatusCode}
+
+	switch {
+	case resp.Header.Get("X-Amzn-Errortype") != "":
+		apiErr.Code = resp.Header.Get("X-Amzn-Errortype")
+	case document.Type != "":
+		apiErr.Code = document.Type
+	case document.Error != "":
+		apiErr.Code = document.Error
+	default:
+		apiErr.Code = strconv.Itoa(resp.StatusCode)
+	}
+
+	// Error types may be qualified with a namespace and suffixed with extra detail
+	if index := strings.LastIndex(apiErr.Code, "#"); index >= 0 {
+		apiErr.Code = apiErr.Code[index+1:]
+	}
+
+	if index := strings.Index(apiErr.Code, ":"); index >= 0 {
+		apiErr.Code = apiErr.Code[:index]
+	}
+
+	for _, message := range []string{document.Message, document.MessageUpper, document.ErrorDescription} {
+		if message != "" {
+			apiErr.Message = message
+			break
+		}
+	}
+
+	return apiErr
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// parseNativeCommand splits CLI arguments into service, operation and options. Options may be
+// given as "--name value", "--name=value", or "--name v1 v2" for list options such as --filters.
+func parseNativeCommand(args []string) (nativeCommand, error) {
+	if len(args) < 2 {
+		return nativeCommand{}, fmt.Errorf("invalid AWS command: %s", strings.Join(args, " "))
+	}
+
+	command := nativeCommand{
+		Service:   args[0],
+		Operation: args[1],
+		Options:   make(map[string][]string),
+	}
+
+	currentOption := ""
+
+	for _, arg := range args[2:] {
+		if strings.HasPrefix(arg, "--") {
+			name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+			command.Options[name] = command.Options[name]
+
+			if hasValue {
+				command.Options[name] = append(command.Options[name], value)
+				currentOption = ""
+			} else {
+				currentOption = name
+			}
+
+			continue
+		}
+
+		if currentOption == "" {
+			return nativeCommand{}, fmt.Errorf("unexpected argument: %s", arg)
+		}
+
+		command.Options[currentOption] = append(command.Options[currentOption], arg)
+	}
+
+	return command, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (c nativeCommand) name() string {
+	return c.Service + " " + c.Operation
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (c nativeCommand) option(name string) string {
+	if values := c.Options[name]; len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// parseShorthand parses AWS CLI shorthand syntax such as `host="db",portNumber="5432"` or
+// `Name=tag:Name,Values=a,b`. Values without a key of their own are appended to the previous key.
+func parseShorthand(s string) map[string][]string {
+	result := make(map[string][]string)
+
+	var parts []string
+	current := strings.Builder{}
+	inQuotes := false
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == ',' && !inQuotes:
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	parts = append(parts, current.String())
+	lastKey := ""
+
+	for _, part := range parts {
+		key, value, found := strings.Cut(part, "=")
+
+		if !found {
+			if lastKey != "" {
+				result[lastKey] = append(result[lastKey], part)
+			}
+
+			continue
+		}
+
+		lastKey = strings.TrimSpace(key)
+		result[lastKey] = append(result[lastKey], value)
+	}
+
+	return result
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// addFilterParams converts --filters shorthand values to EC2 Query protocol parameters.
+func addFilterParams(params url.Values, filters []string) {
+	for i, filter := range filters {
+		parsed := parseShorthand(filter)
+		prefix := fmt.Sprintf("Filter.%d.", i+1)
+
+		if names := parsed["Name"]; len(names) > 0 {
+			params.Set(prefix+"Name", names[0])
+		}
+
+		for j, value := range parsed["Values"] {
+			params.Set(fmt.Sprintf("%sValue.%d", prefix, j+1), value)
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func nativeGetCallerIdentity(r *NativeRunner, session nativeSession, command nativeCommand) (any, error) {
+	var output stsGetCallerIdentityOutput
+
+	params := url.Values{}
+	params.Set("Action", "GetCallerIdentity")
+
+	if err := r.callQuery(session, "sts", "2011-06-15", params, &output); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func nativeDescribeInstances(r *NativeRunner, session nativeSession, command nativeCommand) (any, error) {
+	output := ec2DescribeInstancesOutput{Reservations: []ec2Reservation{}}
+	nextToken := ""
+
+	for {
+		params := url.Values{}
+		params.Set("Action", "DescribeInstances")
+		addFilterParams(params, command.Options["filters"])
+
+		for i, instanceID := range command.Options["instance-ids"] {
+			params.Set(fmt.Sprintf("InstanceId.%d", i+1), instanceID)
+		}
+
+		if nextToken != "" {
+			params.Set("NextToken", nextToken)
+		}
+
+		var page ec2DescribeInstancesOutput
+		if err := r.callQuery(session, "ec2", "2016-11-15", params, &page); err != nil {
+			return nil, err
+		}
+
+		output.Reservations = append(output.Reservations, page.Reservations...)
+
+		if page.NextToken == "" {
+			break
+		}
+
+		nextToken = page.NextToken
+	}
+
+	return output, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func nativeDescribeRegions(r *NativeRunner, session nativeSession, command nativeCommand) (any, error) {
+	output := ec2DescribeRegionsOutput{Regions: []ec2Region{}}
+
+	params := url.Values{}
+	params.Set("Action", "DescribeRegions")
+	addFilterParams(params, command.Options["filters"])
+
+	if err := r.callQuery(session, "ec2", "2016-11-15", params, &output); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func nativeDescribeDBInstances(r *NativeRunner, session nativeSession, command nativeCommand) (any, error) {
+	output := rdsDescribeDBInstancesOutput{DBInstances: []rdsDBInstance{}}
+	marker := ""
+
+	for {
+		params := url.Values{}
+		params.Set("Action", "DescribeDBInstances")
+
+		if marker != "" {
+			params.Set("Marker", marker)
+		}
+
+		var page rdsDescribeDBInstancesOutput
+		if err := r.callQuery(session, "rds", "2014-10-31", params, &page); err != nil {
+			return nil, err
+		}
+
+		output.DBInstances = append(output.DBInstances, page.DBInstances...)
+
+		if page.Marker == "" {
+			break
+		}
+
+		marker = page.Marker
+	}
+
+	return output, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func nativeDescribeDBClusters(r *NativeRunner, session nativeSession, command nativeCommand) (any, error) {
+	output := rdsDescribeDBClustersOutput{DBClusters: []rdsDBCluster{}}
+	marker := ""
+
+	for {
+		params := url.Values{}
+		params.Set("Action", "DescribeDBClusters")
+
+		if marker != "" {
+			params.Set("Marker", marker)
+		}
+
+		var page rdsDescribeDBClustersOutput
+		if err := r.callQuery(session, "rds", "2014-10-31", params, &page); err != nil {
+			return nil, err
+		}
+
+		output.DBClusters = append(output.DBClusters, page.DBClusters...)
+
+		if page.Marker == "" {
+			break
+		}
+
+		marker = page.Marker
+	}
+
+	return output, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func nativeDescribeReplicationGroups(r *NativeRunner, session nativeSession, command nativeCommand) (any, error) {
+	output := elastiCacheDescribeReplicationGroupsOutput{ReplicationGroups: []elastiCacheReplicationGroup{}}
+	marker := ""
+
+	for {
+		params := url.Values{}
+		params.Set("Action", "DescribeReplicationGroups")
+
+		if marker != "" {
+			params.Set("Marker", marker)
+		}
+
+		var page elastiCacheDescribeReplicationGroupsOutput
+		if err := r.callQuery(session, "elasticache", "2015-02-02", params, &page); err != nil {
+			return nil, err
+		}
+
+		output.ReplicationGroups = append(output.ReplicationGroups, page.ReplicationGroups...)
+
+		if page.Marker == "" {
+			break
+		}
+
+		marker = page.Marker
+	}
+
+	return output, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func nativeDescribeCacheClusters(r *NativeRunner, session nativeSession, command nativeCommand) (any, error) {
+	output := elastiCacheDescribeCacheClustersOutput{CacheClusters: []elastiCacheCacheCluster{}}
+	marker := ""
+
+	for {
+		params := url.Values{}
+		params.Set("Action", "DescribeCacheClusters")
+
+		if marker != "" {
+			params.Set("Marker", marker)
+		}
+
+		var page elastiCacheDescribeCacheClustersOutput
+		if err := r.callQuery(session, "elasticache", "2015-02-02", params, &page); err != nil {
+			return nil, err
+		}
+
+		output.CacheClusters = append(output.CacheClusters, page.CacheClusters...)
+
+		if page.Marker == "" {
+			break
+		}
+
+		marker = page.Marker
+	}
+
+	return output, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func nativeDescribeRedshiftClusters(r *NativeRunner, session nativeSession, command nativeCommand) (any, error) {
+	output := redshiftDescribeClustersOutput{Clusters: []redshiftCluster{}}
+	marker := ""
+
+	for {
+		params := url.Values{}
+		params.Set("Action", "DescribeClusters")
+
+		if marker != "" {
+			params.Set("Marker", marker)
+		}
+
+		var page redshiftDescribeClustersOutput
+		if err := r.callQuery(session, "redshift", "2012-12-01", params, &page); err != nil {
+			return nil, err
+		}
+
+		output.Clusters = append(output.Clusters, page.Clusters...)
+
+		if page.Marker == "" {
+			break
+		}
+
+		marker = page.Marker
+	}
+
+	return output, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func nativeListOpenSearchDomainNames(r *NativeRunner, session nativeSession, command nativeCommand) (any, error) {
+	output := openSearchListDomainNamesOutput{DomainNames: []openSearchDomainName{}}
+
+	if err := r.callREST(session, "opensearch", "es", http.MethodGet, "/2021-01-01/domain", "ListDomainNames", nil, &output); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func nativeDescribeOpenSearchDomains(r *NativeRunner, session nativeSession, command nativeCommand) (any, error) {
+	output := openSearchDescribeDomainsOutput{DomainStatusList: []openSearchDomainStatus{}}
+	input := openSearchDescribeDomainsInput{DomainNames: command.Options["domain-names"]}
+
+	if err := r.callREST(session, "opensearch", "es", http.MethodPost, "/2021-01-01/opensearch/domain-info", "DescribeDomains", input, &output); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func nativeGetSecretValue(r *NativeRunner, session nativeSession, command nativeCommand) (any, error) {
+	var output secretsManagerGetSecretValueOutput
+
+	input := secretsManagerGetSecretValueInput{SecretID: command.option("secret-id")}
+
+	if err := r.callJSON(session, "secretsmanager", "secretsmanager", "GetSecretValue", input, &output); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func nativeDescribeInstanceInformation(r *NativeRunner, session nativeSession, command nativeCommand) (any, error) {
+	output := ssmDescribeInstanceInformationOutput{InstanceInformationList: []ssmInstanceInformation{}}
+	input := ssmDescribeInstanceInformationInput{MaxResults: 50}
+
+	for {
+		var page ssmDescribeInstanceInformationOutput
+		if err := r.callJSON(session, "ssm", "AmazonSSM", "DescribeInstanceInformation", input, &page); err != nil {
+			return nil, err
+		}
+
+		output.InstanceInformationList = append(output.InstanceInformationList, page.InstanceInformationList...)
+
+		if page.NextToken == "" {
+			break
+		}
+
+		input.NextToken = page.NextToken
+	}
+
+	return output, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// nativeExportCredentials prints the session's credentials like "aws configure export-credentials
+// --format process" does.
+func nativeExportCredentials(r *NativeRunner, session nativeSession, command nativeCommand) (any, error) {
+	output := configureExportCredentialsOutput{
+		Version:         1,
+		AccessKeyID:     session.Credentials.AccessKeyID,
+		SecretAccessKey: session.Credentials.SecretAccessKey,
+		SessionToken:    session.Credentials.SessionToken,
+	}
+
+	if !session.Credentials.Expires.IsZero() {
+		output.Expiration = session.Credentials.Expires.UTC().Format(time.RFC3339)
+	}
+
+	return output, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// openSession calls SSM StartSession and connects to the session with the built-in data channel
+// client or, when configured, returns the session-manager-plugin command that connects to it like
+// the AWS CLI does.
+func (r *NativeRunner) openSession(profile string, command nativeCommand) (*exec.Cmd, AWSProcess, error) {
+	session, err := r.session(profile, command)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	input := ssmStartSessionInput{
+		Target:       command.option("target"),
+		DocumentName: command.option("document-name"),
+	}
+
+	if parameters := command.option("parameters"); parameters != "" {
+		input.Parameters = parseShorthand(parameters)
+	}
+
+	var output ssmStartSessionOutput
+	if err := r.callJSON(session, "ssm", "AmazonSSM", "StartSession", input, &output); err != nil {
+		return nil, nil, err
+	}
+
+	if sessionClientFor(r.config) == sessionClientBuiltin {
+		process, err := r.startBuiltinSession(session, input, output)
+		return nil, process, err
+	}
+
+	responseJSON, _ := json.Marshal(output)
+	requestJSON, _ := json.Marshal(input)
+
+	plugin := exec.Command("session-manager-plugin",
+		string(responseJSON),
+		session.Region,
+		"StartSession",
+		session.Profile,
+		string(requestJSON),
+		r.endpoint("ssm", session.Region),
+	)
+
+	return plugin, nil, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// startSession opens a session in the background, such as a port forwarding session.
+func (r *NativeRunner) startSession(profile string, command nativeCommand) (AWSProcess, error) {
+	plugin, process, err := r.openSession(profile, command)
+	if err != nil || plugin == nil {
+		return process, err
+	}
+
+	process, err = startBackgroundProcess(plugin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session-manager-plugin: %v", err)
+	}
+
+	return process, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// runSession opens a session attached to the console, such as a shell, and waits for it to end.
+func (r *NativeRunner) runSession(profile string, command nativeCommand) error {
+	plugin, process, err := r.openSession(profile, command)
+	if err != nil {
+		return err
+	}
+
+	if plugin == nil {
+		return process.Wait()
+	}
+
+	plugin.Stdout = os.Stdout
+	plugin.Stderr = os.Stderr
+	plugin.Stdin = os.Stdin
+
+	if err := plugin.Start(); err != nil {
+		return fmt.Errorf("failed to start session-manager-plugin: %v", err)
+	}
+
+	return plugin.Wait()
+}
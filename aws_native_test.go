@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// newTestNativeRunner returns a NativeRunner whose endpoints for the given services all point
+// at a test server running handler.
+func newTestNativeRunner(t *testing.T, handler http.HandlerFunc, services ...string) *NativeRunner {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	config := &Configuration{Endpoints: make(map[string]string)}
+
+	for _, service := range services {
+		config.Endpoints[service] = server.URL
+	}
+
+	return NewNativeRunner(config)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func newTestNativeSession() nativeSession {
+	return nativeSession{
+		Profile:     "dev",
+		Region:      "eu-west-1",
+		Credentials: awsCredentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"},
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestCallQueryDecodesXML(t *testing.T) {
+	runner := newTestNativeRunner(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/x-www-form-urlencoded; charset=utf-8" {
+			t.Errorf("request = %s %s, want a form POST", r.Method, r.Header.Get("Content-Type"))
+		}
+
+		if auth := r.Header.Get("Authorization"); !strings.Contains(auth, "Credential=AKID/") || !strings.Contains(auth, "/eu-west-1/sts/aws4_request") {
+			t.Errorf("Authorization = %s, want a signature scoped to sts in eu-west-1", auth)
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(body))
+
+		if form.Get("Action") != "GetCallerIdentity" || form.Get("Version") != "2011-06-15" {
+			t.Errorf("form = %v, want Action and Version", form)
+		}
+
+		w.Header().Set("Content-Type", "text/xml")
+		io.WriteString(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>arn:aws:iam::123456789012:user/dev</Arn>
+    <UserId>AIDAEXAMPLE</UserId>
+    <Account>123456789012</Account>
+  </GetCallerIdentityResult>
+</GetCallerIdentityResponse>`)
+	}, "sts")
+
+	output, err := nativeGetCallerIdentity(runner, newTestNativeSession(), nativeCommand{})
+	if err != nil {
+		t.Fatalf("nativeGetCallerIdentity failed: %v", err)
+	}
+
+	identity := output.(stsGetCallerIdentityOutput)
+	if identity.Account != "123456789012" || identity.UserID != "AIDAEXAMPLE" || identity.Arn != "arn:aws:iam::123456789012:user/dev" {
+		t.Errorf("identity = %+v", identity)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestCallQueryReturnsAPIErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		code    string
+		message string
+	}{
+		{
+			name:    "ec2",
+			body:    `<Response><Errors><Error><Code>UnauthorizedOperation</Code><Message>You are not authorized.</Message></Error></Errors><RequestID>1</RequestID></Response>`,
+			code:    "UnauthorizedOperation",
+			message: "You are not authorized.",
+		},
+		{
+			name:    "sts",
+			body:    `<ErrorResponse><Error><Type>Sender</Type><Code>ExpiredToken</Code><Message>The security token included in the request is expired</Message></Error></ErrorResponse>`,
+			code:    "ExpiredToken",
+			message: "The security token included in the request is expired",
+		},
+		{
+			name: "unparseable",
+			body: "Forbidden",
+			code: "403",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runner := newTestNativeRunner(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+				io.WriteString(w, test.body)
+			}, "ec2")
+
+			params := url.Values{}
+			params.Set("Action", "DescribeRegions")
+
+			err := runner.callQuery(newTestNativeSession(), "ec2", "2016-11-15", params, &ec2DescribeRegionsOutput{})
+
+			var apiErr *awsAPIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v, want an awsAPIError", err)
+			}
+
+			if apiErr.Code != test.code || apiErr.Message != test.message || apiErr.StatusCode != http.StatusForbidden {
+				t.Errorf("error = %+v, want code %q and message %q", apiErr, test.code, test.message)
+			}
+
+			if apiErr.Operation != "DescribeRegions" {
+				t.Errorf("operation = %q, want DescribeRegions", apiErr.Operation)
+			}
+		})
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestCallJSONDecodesResponse(t *testing.T) {
+	runner := newTestNativeRunner(t, func(w http.ResponseWriter, r *http.Request) {
+		if target := r.Header.Get("X-Amz-Target"); target != "secretsmanager.GetSecretValue" {
+			t.Errorf("X-Amz-Target = %q, want secretsmanager.GetSecretValue", target)
+		}
+
+		if contentType := r.Header.Get("Content-Type"); contentType != "application/x-amz-json-1.1" {
+			t.Errorf("Content-Type = %q, want application/x-amz-json-1.1", contentType)
+		}
+
+		var input map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input["SecretId"] != "db/credentials" {
+			t.Errorf("input = %v (%v), want the secret ID", input, err)
+		}
+
+		io.WriteString(w, `{"Name": "db/credentials", "SecretString": "{\"password\": \"hunter2\"}"}`)
+	}, "secretsmanager")
+
+	var output struct {
+		Name         string
+		SecretString string
+	}
+
+	input := map[string]string{"SecretId": "db/credentials"}
+
+	if err := runner.callJSON(newTestNativeSession(), "secretsmanager", "secretsmanager", "GetSecretValue", input, &output); err != nil {
+		t.Fatalf("callJSON failed: %v", err)
+	}
+
+	if output.Name != "db/credentials" || output.SecretString != `{"password": "hunter2"}` {
+		t.Errorf("output = %+v", output)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestCallJSONReturnsAPIErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		body    string
+		code    string
+		message string
+	}{
+		{
+			name:    "namespaced type",
+			body:    `{"__type": "com.amazonaws.secretsmanager#ResourceNotFoundException", "Message": "Secrets Manager can't find the specified secret."}`,
+			code:    "ResourceNotFoundException",
+			message: "Secrets Manager can't find the specified secret.",
+		},
+		{
+			name:    "error type header",
+			header:  "AccessDeniedException:http://internal.amazon.com/coral/",
+			body:    `{"message": "User is not authorized"}`,
+			code:    "AccessDeniedException",
+			message: "User is not authorized",
+		},
+		{
+			name:    "oidc error",
+			body:    `{"error": "authorization_pending", "error_description": "Pending"}`,
+			code:    "authorization_pending",
+			message: "Pending",
+		},
+		{
+			name: "empty body",
+			code: "400",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runner := newTestNativeRunner(t, func(w http.ResponseWriter, r *http.Request) {
+				if test.header != "" {
+					w.Header().Set("X-Amzn-Errortype", test.header)
+				}
+
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, test.body)
+			}, "ssm")
+
+			err := runner.callJSON(newTestNativeSession(), "ssm", "AmazonSSM", "DescribeInstanceInformation", map[string]string{}, nil)
+
+			var apiErr *awsAPIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v, want an awsAPIError", err)
+			}
+
+			if apiErr.Code != test.code || apiErr.Message != test.message || apiErr.Operation != "DescribeInstanceInformation" {
+				t.Errorf("error = %+v, want code %q and message %q", apiErr, test.code, test.message)
+			}
+		})
+	}
+}
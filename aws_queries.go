@@ -1,218 +1,834 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
-	"os/exec"
 	"strings"
+	"sync"
+	"time"
 )
 
+// Service types of the endpoints that bastions forward to.
+const (
+	targetServiceRDS              = "rds"
+	targetServiceAuroraWriter     = "aurora-writer"
+	targetServiceAuroraReader     = "aurora-reader"
+	targetServiceDocumentDB       = "docdb"
+	targetServiceDocumentDBReader = "docdb-reader"
+	targetServiceElastiCache      = "elasticache"
+	targetServiceRedshift         = "redshift"
+	targetServiceOpenSearch       = "opensearch"
+)
+
+// openSearchDescribeDomainsLimit is the most domains describe-domains accepts in one call.
+const openSearchDescribeDomainsLimit = 5
+
+// documentDBDefaultPort is used for DocumentDB clusters that do not report their port.
+const documentDBDefaultPort = 27017
+
+// targetDiscoverer finds the endpoints of one kind of AWS service that a bastion can forward to.
+// Discover may return the endpoints it found along with an error for the ones it could not query.
+type targetDiscoverer struct {
+	Label       string // Used in error messages, e.g. "Redshift clusters"
+	DefaultPort int    // Used when an endpoint does not report its port
+	Discover    func(profile string, region string) ([]BastionTarget, error)
+}
+
+// targetDiscoverers are queried by 'bastions add' and 'bastions update'. Their results are
+// listed in this order.
+var targetDiscoverers = []targetDiscoverer{
+	{Label: "RDS databases", Discover: queryRDSDatabases},
+	{Label: "Aurora and DocumentDB clusters", Discover: queryClusterTargets},
+	{Label: "ElastiCache clusters", DefaultPort: 6379, Discover: queryElastiCacheClusters},
+	{Label: "Redshift clusters", DefaultPort: 5439, Discover: queryRedshiftClusters},
+	{Label: "OpenSearch domains", DefaultPort: 443, Discover: queryOpenSearchDomains},
+}
+
+// The types below mirror the JSON documents printed by the AWS CLI. Their xml tags let the
+// native backend decode the corresponding API responses straight into the same shapes.
+
+type ec2DescribeInstancesOutput struct {
+	Reservations []ec2Reservation `json:"Reservations" xml:"reservationSet>item"`
+	NextToken    string           `json:"NextToken,omitempty" xml:"nextToken"`
+}
+
+type ec2DescribeRegionsOutput struct {
+	Regions []ec2Region `json:"Regions" xml:"regionInfo>item"`
+}
+
+type ec2Region struct {
+	RegionName string `json:"RegionName" xml:"regionName"`
+}
+
+type ec2Reservation struct {
+	Instances []ec2InstanceDescription `json:"Instances" xml:"instancesSet>item"`
+}
+
+type ec2InstanceDescription struct {
+	InstanceID       string       `json:"InstanceId" xml:"instanceId"`
+	InstanceType     string       `json:"InstanceType" xml:"instanceType"`
+	PrivateIPAddress string       `json:"PrivateIpAddress,omitempty" xml:"privateIpAddress"`
+	PublicIPAddress  string       `json:"PublicIpAddress,omitempty" xml:"ipAddress"`
+	LaunchTime       string       `json:"LaunchTime" xml:"launchTime"`
+	Placement        ec2Placement `json:"Placement" xml:"placement"`
+	State            ec2State     `json:"State" xml:"instanceState"`
+	VpcID            string       `json:"VpcId,omitempty" xml:"vpcId"`
+	SubnetID         string       `json:"SubnetId,omitempty" xml:"subnetId"`
+	Tags             []ec2Tag     `json:"Tags,omitempty" xml:"tagSet>item"`
+}
+
+type ec2Placement struct {
+	AvailabilityZone string `json:"AvailabilityZone" xml:"availabilityZone"`
+}
+
+type ec2State struct {
+	Name string `json:"Name" xml:"name"`
+}
+
+type ec2Tag struct {
+	Key   string `json:"Key" xml:"key"`
+	Value string `json:"Value" xml:"value"`
+}
+
+type rdsDescribeDBInstancesOutput struct {
+	DBInstances []rdsDBInstance `json:"DBInstances" xml:"DescribeDBInstancesResult>DBInstances>DBInstance"`
+	Marker      string          `json:"Marker,omitempty" xml:"DescribeDBInstancesResult>Marker"`
+}
+
+type rdsDBInstance struct {
+	DBInstanceIdentifier string               `json:"DBInstanceIdentifier" xml:"DBInstanceIdentifier"`
+	Engine               string               `json:"Engine" xml:"Engine"`
+	Endpoint             rdsEndpoint          `json:"Endpoint" xml:"Endpoint"`
+	MasterUserSecret     *rdsMasterUserSecret `json:"MasterUserSecret,omitempty" xml:"MasterUserSecret"`
+}
+
+type rdsMasterUserSecret struct {
+	SecretArn string `json:"SecretArn" xml:"SecretArn"`
+}
+
+type rdsEndpoint struct {
+	Address string `json:"Address" xml:"Address"`
+	Port    int    `json:"Port" xml:"Port"`
+}
+
+type rdsDescribeDBClustersOutput struct {
+	DBClusters []rdsDBCluster `json:"DBClusters" xml:"DescribeDBClustersResult>DBClusters>DBCluster"`
+	Marker     string         `json:"Marker,omitempty" xml:"DescribeDBClustersResult>Marker"`
+}
+
+type rdsDBCluster struct {
+	DBClusterIdentifier string               `json:"DBClusterIdentifier" xml:"DBClusterIdentifier"`
+	Engine              string               `json:"Engine" xml:"Engine"`
+	Endpoint            string               `json:"Endpoint,omitempty" xml:"Endpoint"`
+	ReaderEndpoint      string               `json:"ReaderEndpoint,omitempty" xml:"ReaderEndpoint"`
+	Port                int                  `json:"Port" xml:"Port"`
+	MasterUserSecret    *rdsMasterUserSecret `json:"MasterUserSecret,omitempty" xml:"MasterUserSecret"`
+}
+
+type elastiCacheDescribeReplicationGroupsOutput struct {
+	ReplicationGroups []elastiCacheReplicationGroup `json:"ReplicationGroups" xml:"DescribeReplicationGroupsResult>ReplicationGroups>ReplicationGroup"`
+	Marker            string                        `json:"Marker,omitempty" xml:"DescribeReplicationGroupsResult>Marker"`
+}
+
+type elastiCacheReplicationGroup struct {
+	ReplicationGroupID    string                 `json:"ReplicationGroupId" xml:"ReplicationGroupId"`
+	Engine                string                 `json:"Engine,omitempty" xml:"Engine"`
+	ConfigurationEndpoint *elastiCacheEndpoint   `json:"ConfigurationEndpoint,omitempty" xml:"ConfigurationEndpoint"`
+	NodeGroups            []elastiCacheNodeGroup `json:"NodeGroups,omitempty" xml:"NodeGroups>NodeGroup"`
+}
+
+type elastiCacheNodeGroup struct {
+	PrimaryEndpoint *elastiCacheEndpoint `json:"PrimaryEndpoint,omitempty" xml:"PrimaryEndpoint"`
+	ReaderEndpoint  *elastiCacheEndpoint `json:"ReaderEndpoint,omitempty" xml:"ReaderEndpoint"`
+}
+
+type elastiCacheDescribeCacheClustersOutput struct {
+	CacheClusters []elastiCacheCacheCluster `json:"CacheClusters" xml:"DescribeCacheClustersResult>CacheClusters>CacheCluster"`
+	Marker        string                    `json:"Marker,omitempty" xml:"DescribeCacheClustersResult>Marker"`
+}
+
+type elastiCacheCacheCluster struct {
+	CacheClusterID        string               `json:"CacheClusterId" xml:"CacheClusterId"`
+	Engine                string               `json:"Engine" xml:"Engine"`
+	ConfigurationEndpoint *elastiCacheEndpoint `json:"ConfigurationEndpoint,omitempty" xml:"ConfigurationEndpoint"`
+}
+
+type elastiCacheEndpoint struct {
+	Address string `json:"Address" xml:"Address"`
+	Port    int    `json:"Port" xml:"Port"`
+}
+
+type redshiftDescribeClustersOutput struct {
+	Clusters []redshiftCluster `json:"Clusters" xml:"DescribeClustersResult>Clusters>Cluster"`
+	Marker   string            `json:"Marker,omitempty" xml:"DescribeClustersResult>Marker"`
+}
+
+type redshiftCluster struct {
+	ClusterIdentifier       string            `json:"ClusterIdentifier" xml:"ClusterIdentifier"`
+	DBName                  string            `json:"DBName,omitempty" xml:"DBName"`
+	Endpoint                *redshiftEndpoint `json:"Endpoint,omitempty" xml:"Endpoint"`
+	MasterPasswordSecretArn string            `json:"MasterPasswordSecretArn,omitempty" xml:"MasterPasswordSecretArn"`
+}
+
+type redshiftEndpoint struct {
+	Address string `json:"Address" xml:"Address"`
+	Port    int    `json:"Port" xml:"Port"`
+}
+
+type openSearchListDomainNamesOutput struct {
+	DomainNames []openSearchDomainName `json:"DomainNames"`
+}
+
+type openSearchDomainName struct {
+	DomainName string `json:"DomainName"`
+	EngineType string `json:"EngineType,omitempty"`
+}
+
+type openSearchDescribeDomainsInput struct {
+	DomainNames []string `json:"DomainNames"`
+}
+
+type openSearchDescribeDomainsOutput struct {
+	DomainStatusList []openSearchDomainStatus `json:"DomainStatusList"`
+}
+
+type openSearchDomainStatus struct {
+	DomainName    string            `json:"DomainName"`
+	Endpoint      string            `json:"Endpoint,omitempty"`
+	Endpoints     map[string]string `json:"Endpoints,omitempty"`
+	EngineVersion string            `json:"EngineVersion,omitempty"`
+}
+
+type ssmDescribeInstanceInformationInput struct {
+	MaxResults int    `json:"MaxResults,omitempty"`
+	NextToken  string `json:"NextToken,omitempty"`
+}
+
+type ssmDescribeInstanceInformationOutput struct {
+	InstanceInformationList []ssmInstanceInformation `json:"InstanceInformationList"`
+	NextToken               string                   `json:"NextToken,omitempty"`
+}
+
+type ssmInstanceInformation struct {
+	InstanceID   string `json:"InstanceId"`
+	PingStatus   string `json:"PingStatus"`
+	AgentVersion string `json:"AgentVersion,omitempty"`
+	PlatformName string `json:"PlatformName,omitempty"`
+}
+
+type stsGetCallerIdentityOutput struct {
+	UserID  string `json:"UserId" xml:"GetCallerIdentityResult>UserId"`
+	Account string `json:"Account" xml:"GetCallerIdentityResult>Account"`
+	Arn     string `json:"Arn" xml:"GetCallerIdentityResult>Arn"`
+}
+
+type ssmStartSessionInput struct {
+	Target       string              `json:"Target"`
+	DocumentName string              `json:"DocumentName,omitempty"`
+	Parameters   map[string][]string `json:"Parameters,omitempty"`
+}
+
+type ssmStartSessionOutput struct {
+	SessionID  string `json:"SessionId"`
+	TokenValue string `json:"TokenValue"`
+	StreamURL  string `json:"StreamUrl"`
+}
+
+type ssmTerminateSessionInput struct {
+	SessionID string `json:"SessionId"`
+}
+
+type secretsManagerGetSecretValueInput struct {
+	SecretID string `json:"SecretId"`
+}
+
+type secretsManagerGetSecretValueOutput struct {
+	ARN          string `json:"ARN"`
+	Name         string `json:"Name"`
+	SecretString string `json:"SecretString,omitempty"`
+}
+
+// configureExportCredentialsOutput is the credential_process format of
+// "aws configure export-credentials".
+type configureExportCredentialsOutput struct {
+	Version         int    `json:"Version"`
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"SessionToken,omitempty"`
+	Expiration      string `json:"Expiration,omitempty"`
+}
+
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
-func queryRDSDatabases(profile string) ([]RDSDatabase, error) {
-	commandArgs := []string{
-		"rds",
-		"describe-db-instances",
-		"--query",
-		"DBInstances[*].{ID:DBInstanceIdentifier,Endpoint:Endpoint.Address,Port:Endpoint.Port,Engine:Engine}",
-		"--output=json",
+// queryBastionTargets runs every target discoverer concurrently and merges their results in the
+// order of targetDiscoverers. A discoverer that fails, for example for lack of permissions, does
+// not hide the others; its error is returned alongside the targets that were found. An empty
+// region searches the profile's region.
+func queryBastionTargets(profile string, region string) ([]BastionTarget, []error) {
+	results := make([][]BastionTarget, len(targetDiscoverers))
+	errs := make([]error, len(targetDiscoverers))
+
+	var wg sync.WaitGroup
+
+	for i, discoverer := range targetDiscoverers {
+		wg.Add(1)
+
+		go func(i int, discoverer targetDiscoverer) {
+			defer wg.Done()
+
+			targets, err := discoverer.Discover(profile, region)
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to query %s: %v", discoverer.Label, err)
+			}
+
+			for j := range targets {
+				if targets[j].Port == 0 {
+					targets[j].Port = discoverer.DefaultPort
+				}
+			}
+
+			results[i] = targets
+		}(i, discoverer)
 	}
 
-	if len(profile) != 0 {
-		commandArgs = append(commandArgs, "--profile", profile)
+	wg.Wait()
+
+	targets := []BastionTarget{}
+	failures := []error{}
+
+	for i := range targetDiscoverers {
+		targets = append(targets, results[i]...)
+
+		if errs[i] != nil {
+			failures = append(failures, errs[i])
+		}
 	}
 
-	command := exec.Command("aws", commandArgs...)
-	outputStream, err := command.StdoutPipe()
+	return targets, failures
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func queryRDSDatabases(profile string, region string) ([]BastionTarget, error) {
+	output, err := awsRunner.Output(profile, append([]string{"rds", "describe-db-instances", "--output=json"}, regionArgs(region)...)...)
 	if err != nil {
 		return nil, err
 	}
 
-	errorStream, err := command.StderrPipe()
-	if err != nil {
-		return nil, err
+	if len(output) == 0 {
+		return []BastionTarget{}, nil
 	}
 
-	go func() {
-		scanner := bufio.NewScanner(errorStream)
-		scanner.Split(bufio.ScanLines)
+	var document rdsDescribeDBInstancesOutput
+	if err := json.Unmarshal(output, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse RDS database list: %v", err)
+	}
 
-		for scanner.Scan() {
-			fmt.Println(scanner.Text())
+	databases := []BastionTarget{}
+
+	for _, db := range document.DBInstances {
+		database := BastionTarget{
+			Service:  targetServiceRDS,
+			ID:       db.DBInstanceIdentifier,
+			Endpoint: db.Endpoint.Address,
+			Port:     db.Endpoint.Port,
+			Engine:   db.Engine,
 		}
-	}()
 
-	err = command.Start()
+		// Databases whose master password is managed by RDS keep it in Secrets Manager
+		if db.MasterUserSecret != nil {
+			database.SecretArn = db.MasterUserSecret.SecretArn
+		}
+
+		databases = append(databases, database)
+	}
+
+	return databases, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// queryDBClusters lists the RDS clusters, which include Aurora, DocumentDB and Neptune clusters.
+func queryDBClusters(profile string, region string) ([]rdsDBCluster, error) {
+	output, err := awsRunner.Output(profile, append([]string{"rds", "describe-db-clusters", "--output=json"}, regionArgs(region)...)...)
 	if err != nil {
 		return nil, err
 	}
 
-	scanner := bufio.NewScanner(outputStream)
-	scanner.Split(bufio.ScanLines)
-	outputDoc := strings.Builder{}
+	if len(output) == 0 {
+		return []rdsDBCluster{}, nil
+	}
 
-	for scanner.Scan() {
-		outputDoc.WriteString(strings.Trim(scanner.Text(), " "))
+	var document rdsDescribeDBClustersOutput
+	if err := json.Unmarshal(output, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse RDS cluster list: %v", err)
 	}
 
-	command.Wait()
-	output := outputDoc.String()
+	return document.DBClusters, nil
+}
 
-	if len(output) == 0 {
-		return []RDSDatabase{}, nil
-	}
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// clusterTargets returns the writer and reader endpoints of the clusters whose engine matches.
+func clusterTargets(clusters []rdsDBCluster, matches func(engine string) bool, writerService string, readerService string) []BastionTarget {
+	targets := []BastionTarget{}
 
-	var databases []RDSDatabase
-	if err := json.Unmarshal([]byte(output), &databases); err != nil {
-		return nil, fmt.Errorf("failed to parse RDS database list: %v", err)
+	for _, cluster := range clusters {
+		if !matches(cluster.Engine) {
+			continue
+		}
+
+		secretArn := ""
+		if cluster.MasterUserSecret != nil {
+			secretArn = cluster.MasterUserSecret.SecretArn
+		}
+
+		if cluster.Endpoint != "" {
+			targets = append(targets, BastionTarget{
+				Service:   writerService,
+				ID:        cluster.DBClusterIdentifier,
+				Endpoint:  cluster.Endpoint,
+				Port:      cluster.Port,
+				Engine:    cluster.Engine,
+				SecretArn: secretArn,
+			})
+		}
+
+		if cluster.ReaderEndpoint != "" {
+			targets = append(targets, BastionTarget{
+				Service:   readerService,
+				ID:        cluster.DBClusterIdentifier + "-reader",
+				Endpoint:  cluster.ReaderEndpoint,
+				Port:      cluster.Port,
+				Engine:    cluster.Engine,
+				SecretArn: secretArn,
+			})
+		}
 	}
 
-	return databases, nil
+	return targets
 }
 
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
-func queryBastionInstances(profile string) ([]EC2Instance, error) {
-	commandArgs := []string{
-		"ec2",
-		"describe-instances",
-		"--query",
-		"Reservations[*].Instances[*].{Instance:InstanceId,AZ:Placement.AvailabilityZone,Name:Tags[?Key=='Name']|[0].Value}",
-		"--filters",
-		"Name=tag:Name,Values=*bastion*",
-		"--output=json",
+// queryClusterTargets lists the RDS clusters once and returns the endpoints of the Aurora
+// clusters, followed by those of the DocumentDB clusters.
+func queryClusterTargets(profile string, region string) ([]BastionTarget, error) {
+	clusters, err := queryDBClusters(profile, region)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(profile) != 0 {
-		commandArgs = append(commandArgs, "--profile", profile)
+	isAurora := func(engine string) bool { return strings.HasPrefix(engine, "aurora") }
+	isDocumentDB := func(engine string) bool { return engine == "docdb" }
+
+	documentDBTargets := clusterTargets(clusters, isDocumentDB, targetServiceDocumentDB, targetServiceDocumentDBReader)
+
+	for i := range documentDBTargets {
+		if documentDBTargets[i].Port == 0 {
+			documentDBTargets[i].Port = documentDBDefaultPort
+		}
 	}
 
-	command := exec.Command("aws", commandArgs...)
-	outputStream, err := command.StdoutPipe()
+	targets := clusterTargets(clusters, isAurora, targetServiceAuroraWriter, targetServiceAuroraReader)
+
+	return append(targets, documentDBTargets...), nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// queryElastiCacheClusters lists Redis and Valkey replication groups by their primary (or, in
+// cluster mode, configuration) endpoint, and Memcached clusters by their configuration endpoint.
+// When the clusters cannot be listed, the replication groups are still returned with the error.
+func queryElastiCacheClusters(profile string, region string) ([]BastionTarget, error) {
+	output, err := awsRunner.Output(profile, append([]string{"elasticache", "describe-replication-groups", "--output=json"}, regionArgs(region)...)...)
 	if err != nil {
 		return nil, err
 	}
 
-	errorStream, err := command.StderrPipe()
+	var groups elastiCacheDescribeReplicationGroupsOutput
+	if len(output) > 0 {
+		if err := json.Unmarshal(output, &groups); err != nil {
+			return nil, fmt.Errorf("failed to parse ElastiCache replication group list: %v", err)
+		}
+	}
+
+	targets := []BastionTarget{}
+
+	for _, group := range groups.ReplicationGroups {
+		engine := firstNonEmpty(group.Engine, "redis")
+
+		endpoint := group.ConfigurationEndpoint
+		if endpoint == nil && len(group.NodeGroups) > 0 {
+			endpoint = group.NodeGroups[0].PrimaryEndpoint
+		}
+
+		if endpoint != nil {
+			targets = append(targets, BastionTarget{
+				Service:  targetServiceElastiCache,
+				ID:       group.ReplicationGroupID,
+				Endpoint: endpoint.Address,
+				Port:     endpoint.Port,
+				Engine:   engine,
+			})
+		}
+
+		if group.ConfigurationEndpoint == nil && len(group.NodeGroups) > 0 && group.NodeGroups[0].ReaderEndpoint != nil {
+			reader := group.NodeGroups[0].ReaderEndpoint
+
+			targets = append(targets, BastionTarget{
+				Service:  targetServiceElastiCache,
+				ID:       group.ReplicationGroupID + "-reader",
+				Endpoint: reader.Address,
+				Port:     reader.Port,
+				Engine:   engine,
+			})
+		}
+	}
+
+	output, err = awsRunner.Output(profile, append([]string{"elasticache", "describe-cache-clusters", "--output=json"}, regionArgs(region)...)...)
 	if err != nil {
-		return nil, err
+		return targets, err
 	}
 
-	go func() {
-		scanner := bufio.NewScanner(errorStream)
-		scanner.Split(bufio.ScanLines)
+	var clusters elastiCacheDescribeCacheClustersOutput
+	if len(output) > 0 {
+		if err := json.Unmarshal(output, &clusters); err != nil {
+			return targets, fmt.Errorf("failed to parse ElastiCache cluster list: %v", err)
+		}
+	}
 
-		for scanner.Scan() {
-			fmt.Println(scanner.Text())
+	// Redis and Valkey nodes belong to the replication groups above
+	for _, cluster := range clusters.CacheClusters {
+		if cluster.Engine != "memcached" || cluster.ConfigurationEndpoint == nil {
+			continue
 		}
-	}()
 
-	err = command.Start()
+		targets = append(targets, BastionTarget{
+			Service:  targetServiceElastiCache,
+			ID:       cluster.CacheClusterID,
+			Endpoint: cluster.ConfigurationEndpoint.Address,
+			Port:     cluster.ConfigurationEndpoint.Port,
+			Engine:   cluster.Engine,
+		})
+	}
+
+	return targets, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func queryRedshiftClusters(profile string, region string) ([]BastionTarget, error) {
+	output, err := awsRunner.Output(profile, append([]string{"redshift", "describe-clusters", "--output=json"}, regionArgs(region)...)...)
 	if err != nil {
 		return nil, err
 	}
 
-	scanner := bufio.NewScanner(outputStream)
-	scanner.Split(bufio.ScanLines)
-	outputDoc := strings.Builder{}
+	if len(output) == 0 {
+		return []BastionTarget{}, nil
+	}
 
-	for scanner.Scan() {
-		outputDoc.WriteString(strings.Trim(scanner.Text(), " "))
+	var document redshiftDescribeClustersOutput
+	if err := json.Unmarshal(output, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse Redshift cluster list: %v", err)
 	}
 
-	command.Wait()
-	output := outputDoc.String()
+	targets := []BastionTarget{}
 
-	if len(output) == 0 {
-		return []EC2Instance{}, nil
+	for _, cluster := range document.Clusters {
+		// Clusters that are still being created have no endpoint yet
+		if cluster.Endpoint == nil {
+			continue
+		}
+
+		targets = append(targets, BastionTarget{
+			Service:   targetServiceRedshift,
+			ID:        cluster.ClusterIdentifier,
+			Endpoint:  cluster.Endpoint.Address,
+			Port:      cluster.Endpoint.Port,
+			Engine:    "redshift",
+			SecretArn: cluster.MasterPasswordSecretArn,
+		})
 	}
 
-	var instanceList [][]EC2Instance
-	if err := json.Unmarshal([]byte(output), &instanceList); err != nil {
-		return nil, fmt.Errorf("failed to parse EC2 instance list: %v", err)
+	return targets, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// queryOpenSearchDomains lists OpenSearch and Elasticsearch domains by their VPC endpoint. Public
+// domains are reachable without a bastion, and domains still being created have no endpoint yet.
+func queryOpenSearchDomains(profile string, region string) ([]BastionTarget, error) {
+	output, err := awsRunner.Output(profile, append([]string{"opensearch", "list-domain-names", "--output=json"}, regionArgs(region)...)...)
+	if err != nil {
+		return nil, err
 	}
 
-	var instances []EC2Instance
-	for _, reservation := range instanceList {
-		for _, instance := range reservation {
-			if instance.Instance != "" {
-				instances = append(instances, instance)
+	var names openSearchListDomainNamesOutput
+	if len(output) > 0 {
+		if err := json.Unmarshal(output, &names); err != nil {
+			return nil, fmt.Errorf("failed to parse OpenSearch domain list: %v", err)
+		}
+	}
+
+	targets := []BastionTarget{}
+
+	for start := 0; start < len(names.DomainNames); start += openSearchDescribeDomainsLimit {
+		args := append([]string{"opensearch", "describe-domains", "--output=json"}, regionArgs(region)...)
+		args = append(args, "--domain-names")
+
+		for _, domain := range names.DomainNames[start:min(start+openSearchDescribeDomainsLimit, len(names.DomainNames))] {
+			args = append(args, domain.DomainName)
+		}
+
+		output, err := awsRunner.Output(profile, args...)
+		if err != nil {
+			return targets, err
+		}
+
+		var document openSearchDescribeDomainsOutput
+		if err := json.Unmarshal(output, &document); err != nil {
+			return targets, fmt.Errorf("failed to parse OpenSearch domains: %v", err)
+		}
+
+		for _, domain := range document.DomainStatusList {
+			endpoint := domain.Endpoints["vpc"]
+			if endpoint == "" {
+				continue
+			}
+
+			engine := "opensearch"
+			if strings.HasPrefix(domain.EngineVersion, "Elasticsearch") {
+				engine = "elasticsearch"
 			}
+
+			targets = append(targets, BastionTarget{
+				Service:  targetServiceOpenSearch,
+				ID:       domain.DomainName,
+				Endpoint: endpoint,
+				Port:     443,
+				Engine:   engine,
+			})
 		}
 	}
 
-	return instances, nil
+	return targets, nil
 }
 
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
-func queryEC2Instances(profile string, filter string) ([]EC2Instance, error) {
-	commandArgs := []string{
-		"ec2",
-		"describe-instances",
-		"--query",
-		"Reservations[*].Instances[*].{Instance:InstanceId,AZ:Placement.AvailabilityZone,Name:Tags[?Key=='Name']|[0].Value,Host:PrivateIpAddress,State:State.Name,Type:InstanceType,PublicIP:PublicIpAddress,LaunchTime:LaunchTime}",
-		"--filters",
-		fmt.Sprintf("Name=tag:Name,Values=*%s*", filter),
-		"--output=json",
+// querySecretValue reads a secret from Secrets Manager by ARN or name.
+func querySecretValue(profile string, secretID string) (secretsManagerGetSecretValueOutput, error) {
+	var document secretsManagerGetSecretValueOutput
+
+	output, err := awsRunner.Output(profile, "secretsmanager", "get-secret-value", "--secret-id", secretID, "--output=json")
+	if err != nil {
+		return document, err
 	}
 
-	if len(profile) != 0 {
-		commandArgs = append(commandArgs, "--profile", profile)
+	if err := json.Unmarshal(output, &document); err != nil {
+		return document, fmt.Errorf("failed to parse secret '%s': %v", secretID, err)
 	}
 
-	command := exec.Command("aws", commandArgs...)
-	outputStream, err := command.StdoutPipe()
+	return document, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// queryProfileCredentials returns the credentials the AWS backend resolves for a profile.
+func queryProfileCredentials(profile string) (awsCredentials, error) {
+	var document configureExportCredentialsOutput
+
+	output, err := awsRunner.Output(profile, "configure", "export-credentials", "--format", "process")
 	if err != nil {
-		return nil, err
+		return awsCredentials{}, err
+	}
+
+	if err := json.Unmarshal(output, &document); err != nil || document.AccessKeyID == "" {
+		return awsCredentials{}, fmt.Errorf("failed to read the credentials of profile %s", profile)
+	}
+
+	creds := awsCredentials{
+		AccessKeyID:     document.AccessKeyID,
+		SecretAccessKey: document.SecretAccessKey,
+		SessionToken:    document.SessionToken,
+	}
+
+	if document.Expiration != "" {
+		creds.Expires, _ = time.Parse(time.RFC3339, document.Expiration)
 	}
 
-	errorStream, err := command.StderrPipe()
+	return creds, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// queryBastionInstances finds the instances matching a profile's discovery rules, each with its
+// SSM ping status. EC2 filters within one call are combined with AND, so every name pattern list
+// and tag is queried separately and the results are merged. An empty region searches the
+// profile's region.
+func queryBastionInstances(profile string, region string, rules *BastionDiscovery) ([]EC2Instance, error) {
+	if rules == nil {
+		rules = &BastionDiscovery{}
+	}
+
+	filters := []string{}
+
+	if len(rules.Names) > 0 {
+		filters = append(filters, "Name=tag:Name,Values="+strings.Join(rules.Names, ","))
+	}
+
+	for _, key := range sortedKeys(rules.Tags) {
+		filters = append(filters, fmt.Sprintf("Name=tag:%s,Values=%s", key, firstNonEmpty(rules.Tags[key], "*")))
+	}
+
+	if len(filters) == 0 {
+		filters = append(filters, "Name=tag:Name,Values=*bastion*")
+	}
+
+	instances := []EC2Instance{}
+	seen := make(map[string]bool)
+
+	for _, filter := range filters {
+		matches, err := describeEC2Instances(profile, region, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, instance := range matches {
+			if !seen[instance.Instance] {
+				seen[instance.Instance] = true
+				instances = append(instances, instance)
+			}
+		}
+	}
+
+	pingStatus, err := querySSMPingStatus(profile, region)
+
 	if err != nil {
-		return nil, err
+		// The ping status is informational unless the rules depend on it
+		if rules.SSMOnline {
+			return nil, fmt.Errorf("failed to query SSM instance status: %v", err)
+		}
+
+		return instances, nil
 	}
 
-	go func() {
-		scanner := bufio.NewScanner(errorStream)
-		scanner.Split(bufio.ScanLines)
+	online := []EC2Instance{}
 
-		for scanner.Scan() {
-			fmt.Println(scanner.Text())
+	for _, instance := range instances {
+		instance.PingStatus = firstNonEmpty(pingStatus[instance.Instance], "Not registered")
+
+		if !rules.SSMOnline || instance.PingStatus == "Online" {
+			online = append(online, instance)
 		}
-	}()
+	}
 
-	err = command.Start()
+	return online, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// querySSMPingStatus returns the SSM agent ping status of every managed instance by instance ID.
+func querySSMPingStatus(profile string, region string) (map[string]string, error) {
+	args := append([]string{"ssm", "describe-instance-information", "--output=json"}, regionArgs(region)...)
+
+	output, err := awsRunner.Output(profile, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	scanner := bufio.NewScanner(outputStream)
-	scanner.Split(bufio.ScanLines)
-	outputDoc := strings.Builder{}
+	status := make(map[string]string)
 
-	for scanner.Scan() {
-		outputDoc.WriteString(strings.Trim(scanner.Text(), " "))
+	if len(output) == 0 {
+		return status, nil
+	}
+
+	var document ssmDescribeInstanceInformationOutput
+	if err := json.Unmarshal(output, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse SSM instance list: %v", err)
 	}
 
-	command.Wait()
-	output := outputDoc.String()
+	for _, information := range document.InstanceInformationList {
+		status[information.InstanceID] = information.PingStatus
+	}
+
+	return status, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func queryEC2Instances(profile string, filter string) ([]EC2Instance, error) {
+	return describeEC2Instances(profile, "", fmt.Sprintf("Name=tag:Name,Values=*%s*", filter))
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// describeEC2Instances runs describe-instances with the given --filters values and flattens the
+// reservations into a single list. An empty region is the profile's region.
+func describeEC2Instances(profile string, region string, filters ...string) ([]EC2Instance, error) {
+	args := append([]string{"ec2", "describe-instances", "--output=json"}, regionArgs(region)...)
+
+	if len(filters) > 0 {
+		args = append(args, "--filters")
+		args = append(args, filters...)
+	}
+
+	output, err := awsRunner.Output(profile, args...)
+	if err != nil {
+		return nil, err
+	}
 
 	if len(output) == 0 {
 		return []EC2Instance{}, nil
 	}
 
-	var instanceList [][]EC2Instance
-	if err := json.Unmarshal([]byte(output), &instanceList); err != nil {
+	var document ec2DescribeInstancesOutput
+	if err := json.Unmarshal(output, &document); err != nil {
 		return nil, fmt.Errorf("failed to parse EC2 instance list: %v", err)
 	}
 
 	var instances []EC2Instance
 
-	for _, reservation := range instanceList {
-		for _, instance := range reservation {
-			if instance.Instance != "" {
-				instances = append(instances, instance)
+	for _, reservation := range document.Reservations {
+		for _, instance := range reservation.Instances {
+			if instance.InstanceID != "" {
+				ec2Instance := instance.toEC2Instance()
+				ec2Instance.Region = region
+
+				instances = append(instances, ec2Instance)
 			}
 		}
 	}
 
 	return instances, nil
 }
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (d ec2InstanceDescription) toEC2Instance() EC2Instance {
+	return EC2Instance{
+		Instance:     d.InstanceID,
+		Name:         d.tag("Name"),
+		AZ:           d.Placement.AvailabilityZone,
+		Host:         d.PrivateIPAddress,
+		State:        d.State.Name,
+		InstanceType: d.InstanceType,
+		PublicIP:     d.PublicIPAddress,
+		LaunchTime:   d.LaunchTime,
+		VPC:          d.VpcID,
+		Subnet:       d.SubnetID,
+		Tags:         d.tagMap(),
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (d ec2InstanceDescription) tagMap() map[string]string {
+	if len(d.Tags) == 0 {
+		return nil
+	}
+
+	tags := make(map[string]string, len(d.Tags))
+
+	for _, tag := range d.Tags {
+		tags[tag.Key] = tag.Value
+	}
+
+	return tags
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (d ec2InstanceDescription) tag(key string) string {
+	for _, tag := range d.Tags {
+		if tag.Key == key {
+			return tag.Value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// AWSRunner executes AWS CLI style commands (e.g. "ec2 describe-instances ...") on behalf of
+// awsdo. Every AWS interaction goes through the active runner so that the backend can be
+// swapped out, for example with a FakeRunner when testing.
+type AWSRunner interface {
+	// Output runs a command and returns its standard output. Error output is echoed to the
+	// console as it arrives.
+	Output(profile string, args ...string) ([]byte, error)
+
+	// Check runs a command silently and returns an error if it did not complete successfully.
+	Check(profile string, args ...string) error
+
+	// Run runs a command attached to the console and waits for it to complete.
+	Run(profile string, args ...string) error
+
+	// Start starts a command in the background, such as a port forwarding session, and returns
+	// without waiting for it. Its output goes to sessionOutput.
+	Start(profile string, args ...string) (AWSProcess, error)
+}
+
+// AWSProcess is a long-running command started by an AWSRunner. Kill ends the command along with
+// the processes it started, such as the session-manager-plugin run by the AWS CLI.
+type AWSProcess interface {
+	Wait() error
+	Kill() error
+}
+
+// processStopTimeout is how long a background command has to exit once asked to stop, before it
+// is killed.
+const processStopTimeout = 5 * time.Second
+
+// awsRunner is the runner used for all AWS calls.
+var awsRunner AWSRunner = &CLIRunner{}
+
+// sessionOutput receives the console output of processes started with Start. It is silenced
+// while another program, such as a database client, owns the console.
+var sessionOutput io.Writer = os.Stdout
+
+// BackendRunner dispatches each call to the CLI or native runner, according to the backend
+// configured for the profile or, failing that, the global backend setting.
+type BackendRunner struct {
+	config *Configuration
+	cli    AWSRunner
+	native AWSRunner
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func newBackendRunner(config *Configuration) *BackendRunner {
+	return &BackendRunner{
+		config: config,
+		cli:    &CLIRunner{},
+		native: NewNativeRunner(config),
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// backendForProfile returns the backend name that applies to a profile.
+func backendForProfile(config *Configuration, profile string) string {
+	if profileInfo, exists := config.Profiles[profile]; exists && profileInfo.Backend != "" {
+		return profileInfo.Backend
+	}
+
+	if config.Backend != "" {
+		return config.Backend
+	}
+
+	return backendCLI
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (r *BackendRunner) runnerFor(profile string, args []string) AWSRunner {
+	if backendForProfile(r.config, profile) == backendNative {
+		return r.native
+	}
+
+	// The AWS CLI can only hand sessions to session-manager-plugin, so the native runner starts
+	// sessions for the built-in client
+	if hasCommandPrefix(args, "ssm start-session") && sessionClientFor(r.config) == sessionClientBuiltin {
+		return r.native
+	}
+
+	return r.cli
+}
+
+func (r *BackendRunner) Output(profile string, args ...string) ([]byte, error) {
+	return r.runnerFor(profile, args).Output(profile, args...)
+}
+
+func (r *BackendRunner) Check(profile string, args ...string) error {
+	return r.runnerFor(profile, args).Check(profile, args...)
+}
+
+func (r *BackendRunner) Run(profile string, args ...string) error {
+	return r.runnerFor(profile, args).Run(profile, args...)
+}
+
+func (r *BackendRunner) Start(profile string, args ...string) (AWSProcess, error) {
+	return r.runnerFor(profile, args).Start(profile, args...)
+}
+
+// CLIRunner runs commands using the locally installed AWS CLI.
+type CLIRunner struct{}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (r *CLIRunner) command(profile string, args []string) *exec.Cmd {
+	commandArgs := append([]string{}, args...)
+
+	if len(profile) != 0 {
+		commandArgs = append(commandArgs, "--profile", profile)
+	}
+
+	return exec.Command("aws", commandArgs...)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (r *CLIRunner) Output(profile string, args ...string) ([]byte, error) {
+	command := r.command(profile, args)
+
+	outputStream, err := command.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	errorStream, err := command.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(errorStream)
+		scanner.Split(bufio.ScanLines)
+
+		for scanner.Scan() {
+			fmt.Println(scanner.Text())
+		}
+	}()
+
+	err = command.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(outputStream)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	scanner.Split(bufio.ScanLines)
+	outputDoc := strings.Builder{}
+
+	for scanner.Scan() {
+		outputDoc.WriteString(strings.Trim(scanner.Text(), " "))
+	}
+
+	if err := command.Wait(); err != nil {
+		return []byte(outputDoc.String()), err
+	}
+
+	return []byte(outputDoc.String()), nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (r *CLIRunner) Check(profile string, args ...string) error {
+	return r.command(profile, args).Run()
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (r *CLIRunner) Run(profile string, args ...string) error {
+	command := r.command(profile, args)
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+	command.Stdin = os.Stdin
+
+	return command.Run()
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (r *CLIRunner) Start(profile string, args ...string) (AWSProcess, error) {
+	return startBackgroundProcess(r.command(profile, args))
+}
+
+// cliProcess is a command running in the background as a process tree of its own.
+type cliProcess struct {
+	tree *processTree
+	done chan struct{}
+	err  error
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// startBackgroundProcess starts a command with its output going to sessionOutput. The command
+// and everything it starts form a process tree that Kill ends as a whole. The tree does not read
+// the console or get its Ctrl-C, which belong to awsdo or to a client such as psql.
+func startBackgroundProcess(command *exec.Cmd) (AWSProcess, error) {
+	command.Stdout = sessionOutput
+	command.Stderr = os.Stderr
+	command.Stdin = nil
+
+	tree, err := startProcessTree(command)
+	if err != nil {
+		return nil, err
+	}
+
+	process := &cliProcess{tree: tree, done: make(chan struct{})}
+
+	go func() {
+		process.err = command.Wait()
+		tree.release()
+		close(process.done)
+	}()
+
+	return process, nil
+}
+
+func (p *cliProcess) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// Kill asks the whole process tree to stop, so that session-manager-plugin closes its SSM
+// session and local port rather than outliving the AWS CLI, and kills the tree if it has not
+// exited within processStopTimeout.
+func (p *cliProcess) Kill() error {
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+
+	if err := p.tree.stop(); err != nil {
+		return p.tree.kill()
+	}
+
+	select {
+	case <-p.done:
+		return nil
+	case <-time.After(processStopTimeout):
+		return p.tree.kill()
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// hasCommandPrefix reports whether the arguments start with the words of a command, e.g.
+// "ssm start-session".
+func hasCommandPrefix(args []string, command string) bool {
+	prefix := strings.Fields(command)
+
+	if len(prefix) > len(args) {
+		return false
+	}
+
+	for i, word := range prefix {
+		if args[i] != word {
+			return false
+		}
+	}
+
+	return true
+}
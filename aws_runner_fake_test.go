@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// FakeRunner is an AWSRunner that replays canned output instead of calling AWS, and records
+// every invocation. It lets instance discovery, bastion setup and auto-login be tested without
+// an AWS account:
+//
+//	fake := useFakeRunner(t)
+//	fake.Respond("ec2 describe-instances", `{"Reservations": [{"Instances": [...]}]}`)
+type FakeRunner struct {
+	mu        sync.Mutex
+	responses map[string]FakeResponse
+	calls     []FakeCall
+	processes []*fakeProcess
+}
+
+// FakeResponse is the canned result for a command.
+type FakeResponse struct {
+	Output string
+	Err    error
+}
+
+// FakeCall records a single invocation of a FakeRunner.
+type FakeCall struct {
+	Method  string
+	Profile string
+	Args    []string
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{
+		responses: make(map[string]FakeResponse),
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// useFakeRunner makes a FakeRunner the active runner for the rest of the test.
+func useFakeRunner(t *testing.T) *FakeRunner {
+	previous := awsRunner
+	t.Cleanup(func() { awsRunner = previous })
+
+	fake := NewFakeRunner()
+	awsRunner = fake
+
+	return fake
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// Respond registers the output returned for commands whose arguments start with the given
+// command prefix, e.g. "ec2 describe-instances". The longest matching prefix wins.
+func (f *FakeRunner) Respond(command string, output string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.responses[command] = FakeResponse{Output: output}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// Fail registers an error returned for commands whose arguments start with the given prefix.
+func (f *FakeRunner) Fail(command string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.responses[command] = FakeResponse{Err: err}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// Calls returns the invocations recorded so far.
+func (f *FakeRunner) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]FakeCall{}, f.calls...)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// Processes returns the processes started so far, such as SSM sessions.
+func (f *FakeRunner) Processes() []*fakeProcess {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]*fakeProcess{}, f.processes...)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// CallsTo returns the recorded invocations whose arguments start with the given prefix.
+func (f *FakeRunner) CallsTo(command string) []FakeCall {
+	var matches []FakeCall
+
+	for _, call := range f.Calls() {
+		if hasCommandPrefix(call.Args, command) {
+			matches = append(matches, call)
+		}
+	}
+
+	return matches
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (f *FakeRunner) invoke(method string, profile string, args []string) FakeResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, FakeCall{
+		Method:  method,
+		Profile: profile,
+		Args:    append([]string{}, args...),
+	})
+
+	bestMatch := ""
+	response := FakeResponse{Err: fmt.Errorf("no canned response for: %s", strings.Join(args, " "))}
+
+	for command, candidate := range f.responses {
+		if hasCommandPrefix(args, command) && len(command) >= len(bestMatch) {
+			bestMatch = command
+			response = candidate
+		}
+	}
+
+	return response
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (f *FakeRunner) Output(profile string, args ...string) ([]byte, error) {
+	response := f.invoke("Output", profile, args)
+	return []byte(response.Output), response.Err
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (f *FakeRunner) Check(profile string, args ...string) error {
+	return f.invoke("Check", profile, args).Err
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (f *FakeRunner) Run(profile string, args ...string) error {
+	response := f.invoke("Run", profile, args)
+
+	if response.Output != "" {
+		fmt.Print(response.Output)
+	}
+
+	return response.Err
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// Start returns a process that writes the canned output to sessionOutput, like a session
+// reporting that it waits for connections, and runs until it is killed. If an error is
+// registered for the command, the process exits immediately with that error instead.
+func (f *FakeRunner) Start(profile string, args ...string) (AWSProcess, error) {
+	response := f.invoke("Start", profile, args)
+	process := &fakeProcess{done: make(chan struct{})}
+
+	if response.Err != nil {
+		process.err = response.Err
+		close(process.done)
+	} else if response.Output != "" {
+		io.WriteString(sessionOutput, response.Output)
+	}
+
+	f.mu.Lock()
+	f.processes = append(f.processes, process)
+	f.mu.Unlock()
+
+	return process, nil
+}
+
+// fakeProcess simulates a long-running command such as an SSM session.
+type fakeProcess struct {
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func (p *fakeProcess) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// Ended reports whether the process has exited or been killed.
+func (p *fakeProcess) Ended() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *fakeProcess) Kill() error {
+	p.once.Do(func() {
+		select {
+		case <-p.done:
+		default:
+			close(p.done)
+		}
+	})
+
+	return nil
+}
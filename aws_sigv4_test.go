@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// The expected signatures come from the examples in the AWS Signature Version 4 documentation
+// and test suite, which use the same credentials and date.
+func TestSignRequest(t *testing.T) {
+	creds := awsCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		url           string
+		contentType   string
+		service       string
+		signedHeaders string
+		signature     string
+	}{
+		{
+			name:          "get-vanilla",
+			url:           "https://example.amazonaws.com/",
+			service:       "service",
+			signedHeaders: "host;x-amz-date",
+			signature:     "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:          "iam-list-users",
+			url:           "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08",
+			contentType:   "application/x-www-form-urlencoded; charset=utf-8",
+			service:       "iam",
+			signedHeaders: "content-type;host;x-amz-date",
+			signature:     "5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, test.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+
+			signRequest(req, nil, creds, test.service, "us-east-1", now)
+
+			expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/" + test.service + "/aws4_request, " +
+				"SignedHeaders=" + test.signedHeaders + ", Signature=" + test.signature
+
+			if got := req.Header.Get("Authorization"); got != expected {
+				t.Errorf("Authorization = %s, want %s", got, expected)
+			}
+
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date = %s, want 20150830T123600Z", got)
+			}
+		})
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestSignRequestWithSessionToken(t *testing.T) {
+	creds := awsCredentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET", SessionToken: "TOKEN"}
+
+	req, err := http.NewRequest(http.MethodPost, "https://sts.us-east-1.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signRequest(req, []byte("Action=GetCallerIdentity"), creds, "sts", "us-east-1", time.Now())
+
+	if got := req.Header.Get("X-Amz-Security-Token"); got != "TOKEN" {
+		t.Errorf("X-Amz-Security-Token = %q, want TOKEN", got)
+	}
+
+	if got := req.Header.Get("Authorization"); !strings.Contains(got, "SignedHeaders=host;x-amz-date;x-amz-security-token,") {
+		t.Errorf("Authorization = %s, want the security token signed", got)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// backendCommand shows or changes which backend is used to talk to AWS, globally or per profile.
+func backendCommand(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("backend", flag.ContinueOnError)
+	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
+	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
+	clearEndpoints := flagSet.Bool("clear-endpoints", false, "--clear-endpoints")
+	sessionClient := flagSet.String("session-client", "", "--session-client <builtin|plugin>")
+	listen := flagSet.String("listen-address", "", "--listen-address <address>")
+
+	var endpoints stringListFlag
+	flagSet.Var(&endpoints, "endpoint", "--endpoint <service>=<url>")
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:")
+		fmt.Println("    awsdo backend [cli|native] [--profile <aws cli profile>]")
+		fmt.Println("                  [--endpoint <service>=<url>] [--clear-endpoints]")
+		fmt.Println("                  [--session-client <builtin|plugin>] [--listen-address <address>]")
+	}
+
+	positional, err := parseFlags(flagSet, args)
+	if err != nil {
+		return nil
+	}
+
+	targetProfile := *profile
+	if *profileShort != "" {
+		targetProfile = *profileShort
+	}
+
+	if config.Endpoints == nil {
+		config.Endpoints = make(map[string]string)
+	}
+
+	if *clearEndpoints {
+		for service := range config.Endpoints {
+			delete(config.Endpoints, service)
+		}
+	}
+
+	for _, endpoint := range endpoints {
+		service, endpointURL, found := strings.Cut(endpoint, "=")
+		if !found || service == "" {
+			return fmt.Errorf("invalid endpoint '%s', expected <service>=<url>", endpoint)
+		}
+
+		if endpointURL == "" {
+			delete(config.Endpoints, service)
+		} else {
+			config.Endpoints[service] = endpointURL
+		}
+	}
+
+	if *sessionClient != "" {
+		client := strings.ToLower(*sessionClient)
+
+		if client != sessionClientBuiltin && client != sessionClientPlugin {
+			return fmt.Errorf("invalid session client '%s', expected '%s' or '%s'", client, sessionClientBuiltin, sessionClientPlugin)
+		}
+
+		config.SessionClient = client
+	}
+
+	if *listen != "" {
+		if err := validateListenAddress(*listen); err != nil {
+			return err
+		}
+
+		// The default is not saved, so that the configuration follows it
+		config.ListenAddress = *listen
+		if *listen == defaultListenAddress {
+			config.ListenAddress = ""
+		}
+
+		listenAddress = listenAddressFor(config)
+	}
+
+	if len(positional) > 0 {
+		backend := strings.ToLower(positional[0])
+
+		if backend != backendCLI && backend != backendNative {
+			return fmt.Errorf("invalid backend '%s', expected '%s' or '%s'", backend, backendCLI, backendNative)
+		}
+
+		if targetProfile != "" {
+			if config.Profiles == nil {
+				config.Profiles = make(map[string]Profile)
+			}
+
+			profileInfo := config.Profiles[targetProfile]
+			profileInfo.Name = targetProfile
+			profileInfo.Backend = backend
+			config.Profiles[targetProfile] = profileInfo
+
+			fmt.Printf("\nProfile '%s' now uses the %s backend.\n", targetProfile, backend)
+		} else {
+			config.Backend = backend
+			fmt.Printf("\nAll profiles without their own setting now use the %s backend.\n", backend)
+		}
+	}
+
+	// Show the effective settings
+	defaultBackend := config.Backend
+	if defaultBackend == "" {
+		defaultBackend = backendCLI
+	}
+
+	fmt.Printf("\nDefault backend: %s\n", defaultBackend)
+
+	for _, profileName := range sortedProfileNames(config) {
+		if config.Profiles[profileName].Backend != "" {
+			fmt.Printf("  %s: %s\n", profileName, config.Profiles[profileName].Backend)
+		}
+	}
+
+	fmt.Printf("SSM session client: %s\n", sessionClientFor(config))
+	fmt.Printf("Listen address: %s\n", listenAddressFor(config))
+
+	if len(config.Endpoints) > 0 {
+		fmt.Println("\nEndpoint overrides:")
+
+		for _, service := range sortedKeys(config.Endpoints) {
+			fmt.Printf("  %s = %s\n", service, config.Endpoints[service])
+		}
+	}
+
+	fmt.Println()
+
+	return nil
+}
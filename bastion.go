@@ -12,25 +12,37 @@ import (
 	"strings"
 )
 
+// minBastionIDPrefix is the shortest bastion ID prefix accepted in place of a name, git-style.
+const minBastionIDPrefix = 4
+
+// listedBastion is a configured bastion as 'bastions list' writes it with --output.
+type listedBastion struct {
+	Bastion
+	Default bool `json:"default,omitempty"` // The profile's default bastion
+}
+
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
 func listBastions(args []string, config *Configuration) error {
 	flagSet := flag.NewFlagSet("bastions list", flag.ContinueOnError)
 	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
 	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
 
+	var tableFlags tableOptions
+	tableFlags.register(flagSet)
+
 	flagSet.Usage = func() {
-		fmt.Println("USAGE:\n    awsdo bastions list [--profile <aws cli profile>]")
+		fmt.Println("USAGE:\n    awsdo bastions list [--profile <aws cli profile>] [--columns <column>[,<column> ...]]")
+		fmt.Println("                    [--sort-by [-]<column>] [--no-header] [--no-color]")
 	}
 
 	if err := flagSet.Parse(args); err != nil {
 		return nil
 	}
 
-	// List all bastions across all profiles
-	if config.Profiles == nil {
-		fmt.Println("\nNo bastions configured.")
-		fmt.Println()
-		return nil
+	headers := []string{"Name", "ID", "Host", "Instance", "Port", "LPort"}
+
+	if err := tableFlags.validate(headers); err != nil {
+		return err
 	}
 
 	// Collect all bastions grouped by profile
@@ -74,146 +86,60 @@ func listBastions(args []string, config *Configuration) error {
 		}
 	}
 
-	if len(profileGroups) == 0 {
-		fmt.Println("\nNo bastions configured.")
-		fmt.Println()
-		return nil
-	}
-
 	// Get sorted list of profile names
-	var profileNames []string
-	for profileName := range profileGroups {
-		profileNames = append(profileNames, profileName)
-	}
-	sort.Strings(profileNames)
-
-	// Calculate maximum column widths from all bastions
-	maxNameWidth := len("Name") // Start with header width
-	maxHostWidth := len("Host")
-	maxInstanceWidth := len("Instance")
-	maxPortWidth := len("Port")
-	maxLocalPortWidth := len("LPort")
-
-	// Iterate through all bastions to find maximum widths
-	for _, bastions := range profileGroups {
-		for _, row := range bastions {
-			// Calculate name width (including "*" for default)
-			name := row.BastionName
-			if row.IsDefault {
-				name = "*" + name
-			}
-			if len(name) > maxNameWidth {
-				maxNameWidth = len(name)
-			}
+	profileNames := sortedKeys(profileGroups)
 
-			// Calculate other column widths
-			if len(row.Bastion.Host) > maxHostWidth {
-				maxHostWidth = len(row.Bastion.Host)
-			}
-			if len(row.Bastion.Instance) > maxInstanceWidth {
-				maxInstanceWidth = len(row.Bastion.Instance)
-			}
+	if machineOutput() {
+		var records []listedBastion
 
-			// Port and Local Port as strings
-			portStr := strconv.Itoa(row.Bastion.Port)
-			if len(portStr) > maxPortWidth {
-				maxPortWidth = len(portStr)
-			}
+		for _, profileName := range profileNames {
+			for _, row := range profileGroups[profileName] {
+				bastion := row.Bastion
+				bastion.Name = row.BastionName
+				bastion.Profile = firstNonEmpty(bastion.Profile, profileName)
 
-			localPortStr := strconv.Itoa(row.Bastion.LocalPort)
-			if len(localPortStr) > maxLocalPortWidth {
-				maxLocalPortWidth = len(localPortStr)
+				records = append(records, listedBastion{Bastion: bastion, Default: row.IsDefault})
 			}
 		}
-	}
 
-	// Add 2 characters padding for readability
-	const padding = 2
-	colNameWidth := maxNameWidth + padding
-	colHostWidth := maxHostWidth + padding
-	colInstanceWidth := maxInstanceWidth + padding
-	colPortWidth := maxPortWidth + padding
-	colLocalPortWidth := maxLocalPortWidth + padding
-
-	// Helper function to truncate string to width
-	truncate := func(s string, width int) string {
-		if len(s) > width {
-			return s[:width-3] + "..."
-		}
-		return s + strings.Repeat(" ", width-len(s))
+		return writeRecords(records, func(record listedBastion) string { return firstNonEmpty(record.ID, record.Name) })
 	}
 
-	// Helper function to format integer to string with padding
-	formatInt := func(n int, width int) string {
-		s := strconv.Itoa(n)
-		if len(s) > width {
-			return s[:width-3] + "..."
-		}
-		return s + strings.Repeat(" ", width-len(s))
+	if len(profileGroups) == 0 {
+		fmt.Println("\nNo bastions configured.")
+		fmt.Println()
+		return nil
 	}
 
-	// ANSI escape codes for bold
-	bold := "\033[1m"
-	reset := "\033[0m"
-
 	fmt.Println()
 
 	// Display each profile group
 	for i, profileName := range profileNames {
-		bastions := profileGroups[profileName]
-
 		// Print profile header
 		if i > 0 {
 			fmt.Println()
 		}
-		fmt.Printf("%sProfile: %s%s\n", bold, profileName, reset)
-
-		// Print top border
-		fmt.Printf("┌%s┬%s┬%s┬%s┬%s┐\n",
-			strings.Repeat("─", colNameWidth),
-			strings.Repeat("─", colHostWidth),
-			strings.Repeat("─", colInstanceWidth),
-			strings.Repeat("─", colPortWidth),
-			strings.Repeat("─", colLocalPortWidth))
-
-		// Print header row
-		fmt.Printf("│%s%s%s│%s%s%s│%s%s%s│%s%s%s│%s%s%s│\n",
-			bold, truncate("Name", colNameWidth), reset,
-			bold, truncate("Host", colHostWidth), reset,
-			bold, truncate("Instance", colInstanceWidth), reset,
-			bold, truncate("Port", colPortWidth), reset,
-			bold, truncate("LPort", colLocalPortWidth), reset)
-
-		// Print separator between header and data
-		fmt.Printf("├%s┼%s┼%s┼%s┼%s┤\n",
-			strings.Repeat("─", colNameWidth),
-			strings.Repeat("─", colHostWidth),
-			strings.Repeat("─", colInstanceWidth),
-			strings.Repeat("─", colPortWidth),
-			strings.Repeat("─", colLocalPortWidth))
-
-		// Print data rows
-		for _, row := range bastions {
+		fmt.Println(tableFlags.bold("Profile: " + profileName))
+
+		bastionTable := table{headers: headers}
+
+		for _, row := range profileGroups[profileName] {
 			name := row.BastionName
 			if row.IsDefault {
 				name = "*" + name
 			}
 
-			fmt.Printf("│%s│%s│%s│%s│%s│\n",
-				truncate(name, colNameWidth),
-				truncate(row.Bastion.Host, colHostWidth),
-				truncate(row.Bastion.Instance, colInstanceWidth),
-				formatInt(row.Bastion.Port, colPortWidth),
-				formatInt(row.Bastion.LocalPort, colLocalPortWidth))
+			bastionTable.rows = append(bastionTable.rows, []string{
+				name,
+				row.Bastion.ID,
+				row.Bastion.Host,
+				row.Bastion.Instance,
+				strconv.Itoa(row.Bastion.Port),
+				strconv.Itoa(row.Bastion.LocalPort),
+			})
 		}
 
-		// Print bottom border
-		fmt.Printf("└%s┴%s┴%s┴%s┴%s┘\n",
-			strings.Repeat("─", colNameWidth),
-			strings.Repeat("─", colHostWidth),
-			strings.Repeat("─", colInstanceWidth),
-			strings.Repeat("─", colPortWidth),
-			strings.Repeat("─", colLocalPortWidth))
+		bastionTable.print(tableFlags)
 	}
 
 	fmt.Println()
@@ -226,15 +152,43 @@ func addBastion(args []string, config *Configuration) error {
 	flagSet := flag.NewFlagSet("bastions add", flag.ContinueOnError)
 	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
 	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
+	bastionNameFlag := flagSet.String("name", "", "--name <bastion name>")
+
+	var fields bastionFieldFlags
+	fields.register(flagSet)
 
 	flagSet.Usage = func() {
-		fmt.Println("USAGE:\n    awsdo bastions add [--profile <aws cli profile>]")
+		fmt.Println("USAGE:\n    awsdo bastions add [--profile <aws cli profile>] [--name <bastion name>]")
+		fmt.Println("                    [--db-id <id> | --host <remote host> --port <remote port>]")
+		fmt.Println("                    [--instance <instance id> | --instance-name <instance name>]")
+		fmt.Println("                    [--resolve-name <name pattern>] [--resolve-tag <key>=<value pattern> ...]")
+		fmt.Println("                    [--local-port <local port>] [--region <region>] [--default]")
 	}
 
-	if err := flagSet.Parse(args); err != nil {
+	if _, err := parseFlags(flagSet, args); err != nil {
 		return nil
 	}
 
+	// Targets and instances are discovered in the given region, which is saved with the bastion
+	region, err := fields.regions.single()
+	if err != nil {
+		return err
+	}
+
+	interactive := isInteractive()
+
+	// Without a terminal nothing can be prompted for, so fail before making any AWS calls
+	if !interactive {
+		switch {
+		case fields.dbID == "" && fields.host == "":
+			return errNotInteractive("--db-id or --host")
+		case fields.dbID == "" && fields.port == 0:
+			return errNotInteractive("--port")
+		case fields.instance == "" && fields.instanceName == "" && fields.resolveName == "" && len(fields.resolveTags) == 0:
+			return errNotInteractive("--instance, --instance-name or --resolve-name/--resolve-tag")
+		}
+	}
+
 	currentProfile, err := ensureProfile(config, profile, profileShort)
 	if err != nil {
 		return err
@@ -257,77 +211,31 @@ func addBastion(args []string, config *Configuration) error {
 
 	reader := bufio.NewReader(os.Stdin)
 
-	// Query RDS databases
-	fmt.Println("\nQuerying RDS databases...")
-	databases, err := queryRDSDatabases(currentProfile)
+	// Resolve the database, cache or cluster the bastion forwards to
+	selectedDB, err := resolveBastionRemote(reader, currentProfile, region, fields)
 	if err != nil {
-		return fmt.Errorf("failed to query RDS databases: %v", err)
-	}
-
-	if len(databases) == 0 {
-		fmt.Println("No RDS databases found.")
-	} else {
-		// Display databases and let user select
-		fmt.Println("\nAvailable RDS databases:")
-		for i, db := range databases {
-			fmt.Printf("  %d. %s (%s) - %s:%d\n", i+1, db.DBInstanceIdentifier, db.Engine, db.Endpoint, db.Port)
-		}
-	}
-
-	var selectedDB *RDSDatabase
-
-	if len(databases) > 0 {
-		fmt.Print("\nSelect database number (or 0 to skip): ")
-		dbSelection, _ := reader.ReadString('\n')
-		dbIndex, err := strconv.Atoi(strings.TrimSpace(dbSelection))
-
-		if err != nil || dbIndex < 0 || dbIndex > len(databases) {
-			return fmt.Errorf("invalid selection")
-		}
-
-		if dbIndex > 0 {
-			selectedDB = &databases[dbIndex-1]
-		}
+		return err
 	}
 
-	// Query bastion instances
-	fmt.Println("\nQuerying bastion instances...")
-	bastionInstances, err := queryBastionInstances(currentProfile)
-
+	// Resolve the bastion instance
+	selectedBastionInstance, err := resolveBastionInstance(reader, currentProfile, region, profileInfo.Discovery, fields)
 	if err != nil {
-		return fmt.Errorf("failed to query bastion instances: %v", err)
-	}
-
-	if len(bastionInstances) == 0 {
-		return fmt.Errorf("no bastion instances found")
-	}
-
-	// Display bastion instances and let user select
-	fmt.Println("\nAvailable bastion instances:")
-
-	for i, inst := range bastionInstances {
-		fmt.Printf("  %d. %s (%s)\n", i+1, inst.Name, inst.Instance)
+		return err
 	}
 
-	fmt.Print("\nSelect bastion instance number: ")
-	instSelection, _ := reader.ReadString('\n')
-	instIndex, err := strconv.Atoi(strings.TrimSpace(instSelection))
+	// Get bastion name
+	bastionName := *bastionNameFlag
 
-	if err != nil || instIndex < 1 || instIndex > len(bastionInstances) {
-		return fmt.Errorf("invalid selection")
+	if bastionName == "" && interactive {
+		fmt.Print("\nEnter bastion name: ")
+		nameInput, _ := reader.ReadString('\n')
+		bastionName = strings.TrimSpace(nameInput)
 	}
 
-	selectedBastionInstance := bastionInstances[instIndex-1]
-
-	// Get bastion name
-	fmt.Print("\nEnter bastion name: ")
-	bastionName, _ := reader.ReadString('\n')
-	bastionName = strings.TrimSpace(bastionName)
-
 	if bastionName == "" {
 		// Generate a default name from database identifier
-		if selectedDB != nil {
-			bastionName = selectedDB.DBInstanceIdentifier
+		if selectedDB.ID != "" {
+			bastionName = selectedDB.ID
 		} else {
 			bastionName = fmt.Sprintf("bastion-%d", len(profileInfo.Bastions)+1)
 		}
@@ -345,44 +253,21 @@ func addBastion(args []string, config *Configuration) error {
 		Name:     bastionName,
 		Profile:  currentProfile,
 		Instance: selectedBastionInstance.Instance,
+		Host:     selectedDB.Endpoint,
+		Port:     selectedDB.Port,
+		Service:  selectedDB.Service,
+		Engine:   selectedDB.Engine,
+		Secret:   selectedDB.SecretArn,
+		Region:   region,
 	}
 
-	if selectedDB != nil {
-		newBastion.Host = selectedDB.Endpoint
-		newBastion.Port = selectedDB.Port
-	} else {
-		// Prompt for host and port
-		fmt.Print("Enter remote host: ")
-		host, _ := reader.ReadString('\n')
-		newBastion.Host = strings.TrimSpace(host)
-
-		fmt.Print("Enter remote port: ")
-		portStr, _ := reader.ReadString('\n')
-
-		port, err := strconv.Atoi(strings.TrimSpace(portStr))
-		if err != nil {
-			return fmt.Errorf("invalid port: %v", err)
-		}
-
-		newBastion.Port = port
+	if newBastion.InstanceResolver, err = parseInstanceResolver(fields.resolveName, fields.resolveTags); err != nil {
+		return err
 	}
 
-	// Find available local port
-	localPort, err := findAvailableLocalPort(7000)
+	localPort, err := resolveLocalPort(reader, fields, interactive)
 	if err != nil {
-		return fmt.Errorf("failed to find available local port: %v", err)
-	}
-
-	fmt.Printf("Using local port: %d\n", localPort)
-	fmt.Print("Enter local port (or press Enter to use suggested): ")
-	localPortStr, _ := reader.ReadString('\n')
-	localPortStr = strings.TrimSpace(localPortStr)
-
-	if localPortStr != "" {
-		customPort, err := strconv.Atoi(localPortStr)
-		if err == nil {
-			localPort = customPort
-		}
+		return err
 	}
 
 	newBastion.LocalPort = localPort
@@ -390,7 +275,7 @@ func addBastion(args []string, config *Configuration) error {
 	// Save to configuration
 	profileInfo.Bastions[bastionName] = newBastion
 
-	if profileInfo.DefaultBastion == "" {
+	if profileInfo.DefaultBastion == "" || fields.makeDefault {
 		profileInfo.DefaultBastion = bastionName
 	}
 
@@ -413,6 +298,8 @@ func addBastion(args []string, config *Configuration) error {
 }
 
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// updateBastion changes a bastion. With field flags only the given fields change; otherwise the
+// user is guided through the same prompts as when adding a bastion.
 func updateBastion(args []string, config *Configuration) error {
 	flagSet := flag.NewFlagSet("bastions update", flag.ContinueOnError)
 	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
@@ -420,33 +307,25 @@ func updateBastion(args []string, config *Configuration) error {
 	bastionName := flagSet.String("name", "", "--name <bastion name>")
 	bastionNameShort := flagSet.String("n", "", "--name <bastion name>")
 
-	flagSet.Usage = func() {
-		fmt.Println("USAGE:\n    awsdo bastions update [--profile <aws cli profile>] [--name <bastion name>]")
-	}
+	var fields bastionFieldFlags
+	fields.register(flagSet)
 
-	if err := flagSet.Parse(args); err != nil {
-		return nil
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:\n    awsdo bastions update [--profile <aws cli profile>] [--name <bastion name or id>]")
+		fmt.Println("                    [--db-id <id>] [--host <remote host>] [--port <remote port>]")
+		fmt.Println("                    [--instance <instance id> | --instance-name <instance name>]")
+		fmt.Println("                    [--resolve-name <name pattern>] [--resolve-tag <key>=<value pattern> ...]")
+		fmt.Println("                    [--no-resolve] [--local-port <local port>] [--region <region>] [--default]")
 	}
 
-	currentProfile, err := ensureProfile(config, profile, profileShort)
+	positional, err := parseFlags(flagSet, args)
 	if err != nil {
-		return err
-	}
-
-	// Ensure that we're logged in before running the command
-	if !isLoggedIn(currentProfile) {
-		loginArgs := []string{"--profile", currentProfile}
-		if err := login(loginArgs, config); err != nil {
-			return err
-		}
+		return nil
 	}
 
-	profileInfo := config.Profiles[currentProfile]
-	if profileInfo.Bastions == nil {
-		profileInfo.Bastions = make(map[string]Bastion)
-	}
+	interactive := isInteractive()
 
-	// Get bastion name
+	// Get bastion name or ID
 	var targetBastionName string
 
 	switch {
@@ -454,12 +333,14 @@ func updateBastion(args []string, config *Configuration) error {
 		targetBastionName = *bastionName
 	case *bastionNameShort != "":
 		targetBastionName = *bastionNameShort
-	case flagSet.NArg() > 0:
-		targetBastionName = flagSet.Arg(0)
+	case len(positional) > 0:
+		targetBastionName = positional[0]
+	case !interactive:
+		return errNotInteractive("--name")
 	default:
 		// Prompt for bastion name
 		reader := bufio.NewReader(os.Stdin)
-		fmt.Print("Enter bastion name to update: ")
+		fmt.Print("Enter bastion name or ID to update: ")
 		nameInput, _ := reader.ReadString('\n')
 		targetBastionName = strings.TrimSpace(nameInput)
 
@@ -468,11 +349,17 @@ func updateBastion(args []string, config *Configuration) error {
 		}
 	}
 
-	// Check if bastion exists
-	existingBastion, exists := profileInfo.Bastions[targetBastionName]
+	// An ID also selects the bastion's profile
+	targetBastionName, currentProfile, err := resolveProfileBastion(config, profile, profileShort, targetBastionName)
+	if err != nil {
+		return err
+	}
 
-	if !exists {
-		return fmt.Errorf("bastion '%s' not found in profile '%s'", targetBastionName, currentProfile)
+	profileInfo := config.Profiles[currentProfile]
+	existingBastion := profileInfo.Bastions[targetBastionName]
+
+	if !fields.any() && !fields.makeDefault && !interactive {
+		return fmt.Errorf("nothing to update, pass --db-id, --host, --port, --instance, --instance-name, --resolve-name, --resolve-tag, --no-resolve, --local-port, --region or --default")
 	}
 
 	// Preserve ID and Profile
@@ -488,120 +375,62 @@ func updateBastion(args []string, config *Configuration) error {
 		existingBastionID = newID
 	}
 
-	reader := bufio.NewReader(os.Stdin)
-
-	// Query RDS databases
-	fmt.Println("\nQuerying RDS databases...")
-	databases, err := queryRDSDatabases(currentProfile)
-	if err != nil {
-		return fmt.Errorf("failed to query RDS databases: %v", err)
-	}
+	// Update bastion configuration, keeping settings such as reconnect that the update does not ask for
+	updatedBastion := existingBastion
+	updatedBastion.ID = existingBastionID
+	updatedBastion.Name = targetBastionName
+	updatedBastion.Profile = currentProfile
 
-	if len(databases) == 0 {
-		fmt.Println("No RDS databases found.")
+	// With field flags, or only --default, only the given fields change
+	if fields.any() || fields.makeDefault {
+		if err := applyBastionFieldFlags(&updatedBastion, currentProfile, fields, config); err != nil {
+			return err
+		}
 	} else {
-		// Display databases and let user select
-		fmt.Println("\nAvailable RDS databases:")
-
-		for i, db := range databases {
-			fmt.Printf("  %d. %s (%s) - %s:%d\n", i+1, db.DBInstanceIdentifier, db.Engine, db.Endpoint, db.Port)
+		// Ensure that we're logged in before running the command
+		if !isLoggedIn(currentProfile) {
+			loginArgs := []string{"--profile", currentProfile}
+			if err := login(loginArgs, config); err != nil {
+				return err
+			}
 		}
-	}
 
-	var selectedDB *RDSDatabase
-	if len(databases) > 0 {
-		fmt.Print("\nSelect database number (or 0 to skip): ")
-		dbSelection, _ := reader.ReadString('\n')
+		reader := bufio.NewReader(os.Stdin)
 
-		dbIndex, err := strconv.Atoi(strings.TrimSpace(dbSelection))
-		if err != nil || dbIndex < 0 || dbIndex > len(databases) {
-			return fmt.Errorf("invalid selection")
+		// Query the databases, caches and warehouses a bastion can forward to, in the bastion's region
+		selectedDB, err := resolveBastionRemote(reader, currentProfile, updatedBastion.Region, fields)
+		if err != nil {
+			return err
 		}
 
-		if dbIndex > 0 {
-			selectedDB = &databases[dbIndex-1]
+		// Query bastion instances
+		selectedBastionInstance, err := resolveBastionInstance(reader, currentProfile, updatedBastion.Region, profileInfo.Discovery, fields)
+		if err != nil {
+			return err
 		}
-	}
-
-	// Query bastion instances
-	fmt.Println("\nQuerying bastion instances...")
-
-	bastionInstances, err := queryBastionInstances(currentProfile)
-	if err != nil {
-		return fmt.Errorf("failed to query bastion instances: %v", err)
-	}
-
-	if len(bastionInstances) == 0 {
-		return fmt.Errorf("no bastion instances found")
-	}
-
-	// Display bastion instances and let user select
-	fmt.Println("\nAvailable bastion instances:")
-
-	for i, inst := range bastionInstances {
-		fmt.Printf("  %d. %s (%s)\n", i+1, inst.Name, inst.Instance)
-	}
-
-	fmt.Print("\nSelect bastion instance number: ")
-	instSelection, _ := reader.ReadString('\n')
-
-	instIndex, err := strconv.Atoi(strings.TrimSpace(instSelection))
-	if err != nil || instIndex < 1 || instIndex > len(bastionInstances) {
-		return fmt.Errorf("invalid selection")
-	}
-
-	selectedBastionInstance := bastionInstances[instIndex-1]
-
-	// Update bastion configuration
-	updatedBastion := Bastion{
-		ID:       existingBastionID,
-		Name:     targetBastionName,
-		Profile:  currentProfile,
-		Instance: selectedBastionInstance.Instance,
-	}
 
-	if selectedDB != nil {
+		updatedBastion.Instance = selectedBastionInstance.Instance
 		updatedBastion.Host = selectedDB.Endpoint
 		updatedBastion.Port = selectedDB.Port
-	} else {
-		// Prompt for host and port
-		fmt.Print("Enter remote host: ")
-		host, _ := reader.ReadString('\n')
-		updatedBastion.Host = strings.TrimSpace(host)
-
-		fmt.Print("Enter remote port: ")
-		portStr, _ := reader.ReadString('\n')
+		updatedBastion.Service = selectedDB.Service
+		updatedBastion.Engine = selectedDB.Engine
 
-		port, err := strconv.Atoi(strings.TrimSpace(portStr))
-		if err != nil {
-			return fmt.Errorf("invalid port: %v", err)
+		if selectedDB.SecretArn != "" {
+			updatedBastion.Secret = selectedDB.SecretArn
 		}
 
-		updatedBastion.Port = port
-	}
-
-	// Find available local port
-	localPort, err := findAvailableLocalPort(7000)
-	if err != nil {
-		return fmt.Errorf("failed to find available local port: %v", err)
-	}
-
-	fmt.Printf("Using local port: %d\n", localPort)
-	fmt.Print("Enter local port (or press Enter to use suggested): ")
-	localPortStr, _ := reader.ReadString('\n')
-	localPortStr = strings.TrimSpace(localPortStr)
-
-	if localPortStr != "" {
-		customPort, err := strconv.Atoi(localPortStr)
-		if err == nil {
-			localPort = customPort
+		if updatedBastion.LocalPort, err = resolveLocalPort(reader, fields, interactive); err != nil {
+			return err
 		}
 	}
 
-	updatedBastion.LocalPort = localPort
-
 	// Save to configuration
 	profileInfo.Bastions[targetBastionName] = updatedBastion
+
+	if fields.makeDefault {
+		profileInfo.DefaultBastion = targetBastionName
+	}
+
 	profileInfo.Name = currentProfile
 	config.Profiles[currentProfile] = profileInfo
 
@@ -620,58 +449,658 @@ func updateBastion(args []string, config *Configuration) error {
 	return nil
 }
 
+// bastionFieldFlags are the flags of 'bastions add' and 'bastions update' that set a bastion's
+// fields without prompting. Discovery only validates and resolves them.
+type bastionFieldFlags struct {
+	dbID         string
+	host         string
+	port         int
+	instance     string
+	instanceName string
+	localPort    int
+	makeDefault  bool
+	resolveName  string
+	resolveTags  stringListFlag
+	noResolve    bool
+	regions      regionFlags
+}
+
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
-func startBastionTunnel(args []string, config *Configuration) error {
-	flagSet := flag.NewFlagSet("bastion", flag.ContinueOnError)
-	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
-	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
-	bastionNameFull := flagSet.String("name", "", "--name <bastion name>")
-	bastionNameShort := flagSet.String("n", "", "-n <bastion name>")
+func (f *bastionFieldFlags) register(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&f.dbID, "db-id", "", "--db-id <database, cache or cluster id>")
+	flagSet.StringVar(&f.host, "host", "", "--host <remote host>")
+	flagSet.IntVar(&f.port, "port", 0, "--port <remote port>")
+	flagSet.StringVar(&f.instance, "instance", "", "--instance <instance id>")
+	flagSet.StringVar(&f.instanceName, "instance-name", "", "--instance-name <instance name>")
+	flagSet.IntVar(&f.localPort, "local-port", 0, "--local-port <local port>")
+	flagSet.BoolVar(&f.makeDefault, "default", false, "--default")
+	flagSet.StringVar(&f.resolveName, "resolve-name", "", "--resolve-name <instance name pattern>")
+	flagSet.Var(&f.resolveTags, "resolve-tag", "--resolve-tag <key>=<value pattern>")
+	flagSet.BoolVar(&f.noResolve, "no-resolve", false, "--no-resolve")
+	f.regions.register(flagSet)
+}
 
-	flagSet.Usage = func() {
-		fmt.Println("USAGE:")
-		fmt.Println("    awsdo bastion [--profile <aws cli profile>] [--name <bastion name>]")
-		fmt.Println("                    [--instance <instance id>] [--host <remote host>]")
-		fmt.Println("                    [--port <remote port>] [--local <local port>]")
-	}
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// any reports whether a flag that changes a bastion's fields was given.
+func (f *bastionFieldFlags) any() bool {
+	return f.dbID != "" || f.host != "" || f.port != 0 || f.instance != "" || f.instanceName != "" || f.localPort != 0 ||
+		f.resolveName != "" || len(f.resolveTags) > 0 || f.noResolve || f.regions.given()
+}
 
-	if err := flagSet.Parse(args); err != nil {
-		return nil
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// applyBastionFieldFlags changes only the fields of a bastion that the flags give. Targets and
+// instances are looked up in the --region region, or else in the bastion's region.
+func applyBastionFieldFlags(bastion *Bastion, profile string, fields bastionFieldFlags, config *Configuration) error {
+	region, err := fields.regions.single()
+	if err != nil {
+		return err
 	}
 
-	// Handle bastion name lookup logic
-	var bastion Bastion
-	var currentProfile string
-	var err error
-	var bastionName string
-
-	switch {
-	case flagSet.NArg() > 0:
-		bastionName = flagSet.Arg(0)
-	case *bastionNameFull != "":
-		bastionName = *bastionNameFull
-	case *bastionNameShort != "":
-		bastionName = *bastionNameShort
+	if fields.regions.given() {
+		bastion.Region = region
 	}
 
-	if bastionName != "" {
-		// If profile is specified, look only in that profile
-		if *profile != "" || *profileShort != "" {
-			currentProfile, err = ensureProfile(config, profile, profileShort)
-			if err != nil {
+	// Resolving IDs and names needs AWS, plain values do not
+	if fields.dbID != "" || fields.instance != "" || fields.instanceName != "" || fields.resolveName != "" || len(fields.resolveTags) > 0 {
+		if !isLoggedIn(profile) {
+			if err := login([]string{"--profile", profile}, config); err != nil {
 				return err
 			}
+		}
+	}
 
-			profileInfo := config.Profiles[currentProfile]
+	switch {
+	case fields.dbID != "":
+		target, err := findBastionTarget(profile, bastion.Region, fields.dbID)
+		if err != nil {
+			return err
+		}
 
-			if profileInfo.Bastions == nil {
-				profileInfo.Bastions = make(map[string]Bastion)
-			}
+		bastion.Host = target.Endpoint
+		bastion.Port = target.Port
+		bastion.Service = target.Service
+		bastion.Engine = target.Engine
+
+		if target.SecretArn != "" {
+			bastion.Secret = target.SecretArn
+		}
+	case fields.host != "":
+		// A host entered by hand is not a discovered service
+		bastion.Service = ""
+		bastion.Engine = ""
+	}
+
+	if fields.host != "" {
+		bastion.Host = fields.host
+	}
+
+	if fields.port != 0 {
+		bastion.Port = fields.port
+	}
+
+	if fields.instance != "" || fields.instanceName != "" {
+		instance, err := findBastionInstance(profile, bastion.Region, fields)
+		if err != nil {
+			return err
+		}
+
+		bastion.Instance = instance.Instance
+	}
+
+	if fields.localPort != 0 {
+		bastion.LocalPort = fields.localPort
+	}
+
+	resolver, err := parseInstanceResolver(fields.resolveName, fields.resolveTags)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resolver != nil:
+		bastion.InstanceResolver = resolver
+
+		// Check the resolver now, keeping the current instance if it still matches
+		if err := refreshBastionInstance(bastion, profile, nil); err != nil {
+			return err
+		}
+	case fields.noResolve:
+		bastion.InstanceResolver = nil
+	}
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// resolveBastionRemote returns the target named by --db-id, the host and port given with --host
+// and --port, or otherwise the target the user picks or enters. --host and --port override the
+// endpoint of a target found by ID.
+func resolveBastionRemote(reader *bufio.Reader, profile string, region string, fields bastionFieldFlags) (BastionTarget, error) {
+	var target BastionTarget
+
+	switch {
+	case fields.dbID != "":
+		found, err := findBastionTarget(profile, region, fields.dbID)
+		if err != nil {
+			return target, err
+		}
+
+		target = found
+	case fields.host == "":
+		selected, err := selectBastionTarget(reader, profile, region)
+		if err != nil {
+			return target, err
+		}
+
+		if selected != nil {
+			target = *selected
+		}
+	}
+
+	if fields.host != "" {
+		target.Endpoint = fields.host
+	}
+
+	if fields.port != 0 {
+		target.Port = fields.port
+	}
+
+	if target.Endpoint == "" {
+		if !isInteractive() {
+			return target, errNotInteractive("--db-id or --host")
+		}
+
+		// Prompt for host
+		fmt.Print("Enter remote host: ")
+		host, _ := reader.ReadString('\n')
+		target.Endpoint = strings.TrimSpace(host)
+	}
+
+	if target.Port == 0 {
+		if !isInteractive() {
+			return target, errNotInteractive("--port")
+		}
+
+		// Prompt for port
+		fmt.Print("Enter remote port: ")
+		portStr, _ := reader.ReadString('\n')
+
+		port, err := strconv.Atoi(strings.TrimSpace(portStr))
+		if err != nil {
+			return target, fmt.Errorf("invalid port: %v", err)
+		}
+
+		target.Port = port
+	}
+
+	return target, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// findBastionTarget finds a discovered database, cache or cluster by its ID.
+func findBastionTarget(profile string, region string, id string) (BastionTarget, error) {
+	targets, failures := queryBastionTargets(profile, region)
+
+	for _, target := range targets {
+		if target.ID == id {
+			return target, nil
+		}
+	}
+
+	for _, failure := range failures {
+		fmt.Printf("Warning: %v\n", failure)
+	}
+
+	return BastionTarget{}, fmt.Errorf("no database, cache or cluster with ID '%s' found in profile '%s'", id, profile)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// resolveBastionInstance returns the instance given with --instance or --instance-name, the one
+// the --resolve-name and --resolve-tag resolver finds, or otherwise the one the user picks from
+// the discovered bastion instances.
+func resolveBastionInstance(reader *bufio.Reader, profile string, region string, rules *BastionDiscovery, fields bastionFieldFlags) (EC2Instance, error) {
+	if fields.instance != "" || fields.instanceName != "" {
+		return findBastionInstance(profile, region, fields)
+	}
+
+	resolver, err := parseInstanceResolver(fields.resolveName, fields.resolveTags)
+	if err != nil {
+		return EC2Instance{}, err
+	}
+
+	if resolver != nil {
+		return resolveInstance(profile, region, resolver)
+	}
+
+	return selectBastionInstance(reader, profile, region, rules)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// findBastionInstance checks that the instance given with --instance exists, or finds the one
+// instance whose Name tag is --instance-name.
+func findBastionInstance(profile string, region string, fields bastionFieldFlags) (EC2Instance, error) {
+	if fields.instance != "" {
+		instances, err := describeEC2Instances(profile, region, "Name=instance-id,Values="+fields.instance)
+		if err != nil {
+			return EC2Instance{}, fmt.Errorf("failed to query instance %s: %v", fields.instance, err)
+		}
+
+		if len(instances) == 0 {
+			return EC2Instance{}, fmt.Errorf("instance %s not found in profile '%s'", fields.instance, profile)
+		}
+
+		return instances[0], nil
+	}
+
+	// Terminated instances keep their tags for a while, so they are left out
+	instances, err := describeEC2Instances(profile, region,
+		"Name=tag:Name,Values="+fields.instanceName,
+		"Name=instance-state-name,Values=pending,running,stopping,stopped")
+
+	if err != nil {
+		return EC2Instance{}, fmt.Errorf("failed to query instances named %s: %v", fields.instanceName, err)
+	}
+
+	switch len(instances) {
+	case 0:
+		return EC2Instance{}, fmt.Errorf("no instance named '%s' found in profile '%s'", fields.instanceName, profile)
+	case 1:
+		return instances[0], nil
+	}
+
+	ids := make([]string, len(instances))
+	for i, instance := range instances {
+		ids[i] = instance.Instance
+	}
+
+	return EC2Instance{}, fmt.Errorf("%d instances are named '%s' (%s), use --instance to choose one", len(instances), fields.instanceName, strings.Join(ids, ", "))
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// resolveLocalPort returns the --local-port value, or suggests a free port and lets the user
+// change it. Without a terminal the suggested port is used.
+func resolveLocalPort(reader *bufio.Reader, fields bastionFieldFlags, interactive bool) (int, error) {
+	if fields.localPort != 0 {
+		return fields.localPort, nil
+	}
+
+	// Find available local port
+	localPort, err := findAvailableLocalPort(7000)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find available local port: %v", err)
+	}
+
+	fmt.Printf("Using local port: %d\n", localPort)
+
+	if !interactive {
+		return localPort, nil
+	}
+
+	fmt.Print("Enter local port (or press Enter to use suggested): ")
+	localPortStr, _ := reader.ReadString('\n')
+	localPortStr = strings.TrimSpace(localPortStr)
+
+	if localPortStr != "" {
+		customPort, err := strconv.Atoi(localPortStr)
+		if err == nil {
+			localPort = customPort
+		}
+	}
+
+	return localPort, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// selectBastionTarget lists the endpoints found by all target discoverers and lets the user pick
+// one. It returns nil when the user skips the selection to enter a host and port by hand.
+func selectBastionTarget(reader *bufio.Reader, profile string, region string) (*BastionTarget, error) {
+	fmt.Println("\nQuerying databases, caches and clusters...")
+	targets, failures := queryBastionTargets(profile, region)
+
+	for _, failure := range failures {
+		fmt.Printf("Warning: %v\n", failure)
+	}
+
+	if len(targets) == 0 {
+		if len(failures) == len(targetDiscoverers) {
+			return nil, fmt.Errorf("failed to query any databases, caches or clusters")
+		}
+
+		fmt.Println("No databases, caches or clusters found.")
+		return nil, nil
+	}
+
+	// Display targets and let user select
+	maxIDWidth := 0
+	maxServiceWidth := 0
+
+	for _, target := range targets {
+		maxIDWidth = max(maxIDWidth, len(target.ID))
+		maxServiceWidth = max(maxServiceWidth, len(target.Service))
+	}
+
+	fmt.Println("\nAvailable targets:")
+
+	for i, target := range targets {
+		fmt.Printf("  %2d. %-*s  %-*s  %s:%d (%s)\n", i+1, maxIDWidth, target.ID, maxServiceWidth, target.Service, target.Endpoint, target.Port, target.Engine)
+	}
+
+	fmt.Print("\nSelect target number (or 0 to skip): ")
+	selection, _ := reader.ReadString('\n')
+
+	index, err := strconv.Atoi(strings.TrimSpace(selection))
+	if err != nil || index < 0 || index > len(targets) {
+		return nil, fmt.Errorf("invalid selection")
+	}
+
+	if index == 0 {
+		return nil, nil
+	}
+
+	return &targets[index-1], nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// selectBastionInstance lists the instances matching the profile's discovery rules with their SSM
+// status and lets the user pick one.
+func selectBastionInstance(reader *bufio.Reader, profile string, region string, rules *BastionDiscovery) (EC2Instance, error) {
+	fmt.Println("\nQuerying bastion instances...")
+
+	bastionInstances, err := queryBastionInstances(profile, region, rules)
+	if err != nil {
+		return EC2Instance{}, fmt.Errorf("failed to query bastion instances: %v", err)
+	}
+
+	if len(bastionInstances) == 0 {
+		if rules != nil && rules.SSMOnline {
+			return EC2Instance{}, fmt.Errorf("no bastion instances online in SSM found, see 'awsdo bastions discovery'")
+		}
+
+		return EC2Instance{}, fmt.Errorf("no bastion instances found, see 'awsdo bastions discovery'")
+	}
+
+	// Display bastion instances and let user select
+	fmt.Println("\nAvailable bastion instances:")
+
+	for i, inst := range bastionInstances {
+		if inst.PingStatus != "" {
+			fmt.Printf("  %d. %s (%s) - SSM: %s\n", i+1, inst.Name, inst.Instance, inst.PingStatus)
+		} else {
+			fmt.Printf("  %d. %s (%s)\n", i+1, inst.Name, inst.Instance)
+		}
+	}
+
+	fmt.Print("\nSelect bastion instance number: ")
+	instSelection, _ := reader.ReadString('\n')
+
+	instIndex, err := strconv.Atoi(strings.TrimSpace(instSelection))
+	if err != nil || instIndex < 1 || instIndex > len(bastionInstances) {
+		return EC2Instance{}, fmt.Errorf("invalid selection")
+	}
+
+	return bastionInstances[instIndex-1], nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// bastionCommand runs a tunnel in the foreground, manages background tunnels with the up, down
+// and status subcommands, or prints database credentials with creds and IAM tokens with token.
+func bastionCommand(args []string, config *Configuration) error {
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "up":
+			return bastionUp(args[1:], config)
+		case "down":
+			return bastionDown(args[1:], config)
+		case "status":
+			return bastionStatus(args[1:], config)
+		case "creds", "credentials":
+			return bastionCredentials(args[1:], config)
+		case "token":
+			return bastionToken(args[1:], config)
+		}
+	}
+
+	return startBastionTunnel(args, config)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func startBastionTunnel(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("bastion", flag.ContinueOnError)
+	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
+	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
+	bastionNameFull := flagSet.String("name", "", "--name <bastion name>")
+	bastionNameShort := flagSet.String("n", "", "-n <bastion name>")
+	reconnect := flagSet.Bool("reconnect", false, "--reconnect")
+	wait := flagSet.Bool("wait", false, "--wait")
+	timeout := flagSet.Duration("timeout", defaultTunnelReadyTimeout, "--timeout <duration>")
+	onDemand := flagSet.Bool("on-demand", false, "--on-demand")
+	idleTimeout := flagSet.Duration("idle-timeout", 0, "--idle-timeout <duration>")
+	statsFile := flagSet.String("stats-file", "", "--stats-file <file>") // Written for the tunnel daemon
+	connect := flagSet.Bool("connect", false, "--connect")
+	engine := flagSet.String("engine", "", "--engine <database engine>")
+	user := flagSet.String("user", "", "--user <database user>")
+	database := flagSet.String("database", "", "--database <database name>")
+	iam := flagSet.Bool("iam", false, "--iam")
+	group := flagSet.String("group", "", "--group <tunnel group>")
+	localPort := flagSet.Int("local", 0, "--local <local port>")
+
+	var portOptions localPortOptions
+	portOptions.register(flagSet)
+
+	var regions regionFlags
+	regions.register(flagSet)
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:")
+		fmt.Println("    awsdo bastion [--profile <aws cli profile>] [--name <bastion name>]")
+		fmt.Println("                    [--instance <instance id>] [--host <remote host>]")
+		fmt.Println("                    [--port <remote port>] [--local <local port>]")
+		fmt.Println("                    [--region <region> ... | --all-regions]")
+		fmt.Println("                    [--auto-port | --save-port]")
+		fmt.Println("                    [--reconnect] [--wait [--timeout <duration>]]")
+		fmt.Println("                    [--on-demand [--idle-timeout <duration>]]")
+		fmt.Println("    awsdo bastion [--profile <aws cli profile>] --group <tunnel group>")
+		fmt.Println("                    [--auto-port | --save-port]")
+		fmt.Println("                    [--reconnect] [--wait [--timeout <duration>]]")
+		fmt.Println("                    [--on-demand [--idle-timeout <duration>]]")
+		fmt.Println("    awsdo bastion [--profile <aws cli profile>] [--name <bastion name>] --connect")
+		fmt.Println("                    [--engine <engine>] [--user <user>] [--database <database>]")
+		fmt.Println("                    [--iam] [-- <client arguments>]")
+	}
+
+	// Arguments after "--" are passed on to the database client
+	args, clientArgs := splitPassthroughArgs(args)
+
+	positional, err := parseFlags(flagSet, args)
+	if err != nil {
+		return nil
+	}
+
+	// A tunnel group runs all of its bastions at once
+	if *group != "" {
+		if *connect {
+			return fmt.Errorf("--group cannot be combined with --connect")
+		}
+
+		if regions.given() {
+			return fmt.Errorf("--group uses the regions saved with its bastions, and cannot be combined with --region or --all-regions")
+		}
+
+		bastions, err := resolveTunnelGroup(config, profile, profileShort, *group)
+		if err != nil {
+			return err
+		}
+
+		if err := ensureLocalPortsFree(bastions, portOptions, config); err != nil {
+			return err
+		}
+
+		options := backgroundTunnelOptions{Reconnect: *reconnect, OnDemand: *onDemand, IdleTimeout: *idleTimeout}
+
+		if *wait {
+			loginBastionProfiles(bastions, config)
+			return startBackgroundTunnels(bastions, options, *timeout)
+		}
+
+		return runTunnelGroup(*group, bastions, options, config)
+	}
+
+	var bastionName string
+
+	switch {
+	case len(positional) > 0:
+		bastionName = positional[0]
+	case *bastionNameFull != "":
+		bastionName = *bastionNameFull
+	case *bastionNameShort != "":
+		bastionName = *bastionNameShort
+	}
+
+	bastion, currentProfile, err := resolveBastion(config, profile, profileShort, bastionName)
+	if err != nil {
+		return err
+	}
+
+	if *localPort > 0 {
+		bastion.LocalPort = *localPort
+	}
+
+	// Check the local port before logging in, rather than have the session fail to bind it. The
+	// database client finds a free port by itself.
+	if !*connect {
+		if err := ensureLocalPortFree(&bastion, portOptions, nil, config); err != nil {
+			return err
+		}
+	}
+
+	// The Session Manager plugin is only needed when it is configured as the session client
+	if sessionClientFor(config) == sessionClientPlugin {
+		pluginCheck := exec.Command("session-manager-plugin")
+
+		if err := pluginCheck.Run(); err != nil {
+			return fmt.Errorf("AWS Session Manager plugin is not installed. Please install it first, or use the built-in session client with 'awsdo backend --session-client builtin'")
+		}
+	}
+
+	// Use profile from bastion if available, otherwise use currentProfile
+	bastionProfile := currentProfile
+
+	if bastion.Profile != "" {
+		bastionProfile = bastion.Profile
+	}
+
+	// Ensure that we're logged in before running the command
+	if !isLoggedIn(bastionProfile) {
+		args := []string{}
+
+		if len(bastionProfile) != 0 {
+			args = append(args, "--profile", bastionProfile)
+		}
+
+		login(args, config)
+	}
+
+	// --region and --all-regions find the bastion instance's region and remember it
+	if regions.given() {
+		if err := updateBastionRegion(&bastion, bastionProfile, regions, config); err != nil {
+			return err
+		}
+	}
+
+	// Bastions with an instance resolver find their current instance before connecting
+	if err := refreshBastionInstance(&bastion, bastionProfile, config); err != nil {
+		return err
+	}
+
+	if *connect {
+		return connectDatabaseClient(bastion, bastionProfile, databaseClientOptions{
+			Engine:   *engine,
+			User:     *user,
+			Database: *database,
+			Args:     clientArgs,
+			IAMAuth:  *iam,
+		})
+	}
+
+	// --wait hands the tunnel to the daemon and returns once the local port accepts connections
+	if *wait {
+		bastion.Profile = bastionProfile
+		options := backgroundTunnelOptions{Reconnect: *reconnect, OnDemand: *onDemand, IdleTimeout: *idleTimeout}
+		return startBackgroundTunnels([]Bastion{bastion}, options, *timeout)
+	}
+
+	// --reconnect enables reconnection for this run when the bastion does not configure it
+	policy := bastion.Reconnect
+
+	if *reconnect && (policy == nil || !policy.Enabled) {
+		policy = &ReconnectPolicy{Enabled: true}
+	}
+
+	// Set up signal handling to catch Ctrl-C
+	signalChan := make(chan os.Signal, 1)
+	setupSignalHandler(signalChan)
+	defer signal.Stop(signalChan)
+
+	// On-demand tunnels only hold a session open while clients are connected
+	if *onDemand || bastion.OnDemand {
+		return runTunnelProxy(bastion, bastionProfile, tunnelIdleTimeout(bastion, *idleTimeout), *statsFile, signalChan)
+	}
+
+	return runTunnel(bastion, bastionProfile, policy, *statsFile, signalChan, config)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// resolveBastion finds a bastion by name or, failing that, by its ID or a unique prefix of it.
+// IDs tell apart bastions with the same name in several profiles.
+func resolveBastion(config *Configuration, profile *string, profileShort *string, bastionName string) (Bastion, string, error) {
+	bastion, currentProfile, err := resolveBastionByName(config, profile, profileShort, bastionName)
+	if err == nil || bastionName == "" {
+		return bastion, currentProfile, err
+	}
+
+	lookup, found, idErr := findBastionByID(config, bastionName)
+	if idErr != nil {
+		return Bastion{}, "", idErr
+	}
+
+	if !found {
+		return Bastion{}, "", err
+	}
+
+	if givenProfile := firstNonEmpty(*profile, *profileShort); givenProfile != "" && givenProfile != lookup.Profile {
+		return Bastion{}, "", fmt.Errorf("bastion ID '%s' belongs to profile '%s', not '%s'", bastionName, lookup.Profile, givenProfile)
+	}
+
+	return config.Profiles[lookup.Profile].Bastions[lookup.Name], lookup.Profile, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// resolveBastionByName finds a bastion by name. Without a profile, the default profile is
+// searched first, then all other profiles. Without a name, the default bastion of the profile
+// is used.
+func resolveBastionByName(config *Configuration, profile *string, profileShort *string, bastionName string) (Bastion, string, error) {
+	var bastion Bastion
+	var currentProfile string
+	var err error
+
+	if bastionName != "" {
+		// If profile is specified, look only in that profile
+		if *profile != "" || *profileShort != "" {
+			currentProfile, err = ensureProfile(config, profile, profileShort)
+			if err != nil {
+				return Bastion{}, "", err
+			}
+
+			profileInfo := config.Profiles[currentProfile]
+
+			if profileInfo.Bastions == nil {
+				profileInfo.Bastions = make(map[string]Bastion)
+			}
 
 			selectedBastion, err := selectBastionByName(profileInfo, bastionName)
 
 			if err != nil {
-				return fmt.Errorf("bastion '%s' not found in profile '%s'", bastionName, currentProfile)
+				return Bastion{}, "", fmt.Errorf("bastion '%s' not found in profile '%s'", bastionName, currentProfile)
 			}
 
 			bastion = selectedBastion
@@ -690,7 +1119,7 @@ func startBastionTunnel(args []string, config *Configuration) error {
 			}
 
 			// If not found in default profile, search all profiles (skip default if already checked)
-			if bastion.Instance == "" {
+			if bastion.Instance == "" && bastion.InstanceResolver == nil {
 				found := false
 
 				if config.Profiles != nil {
@@ -718,7 +1147,7 @@ func startBastionTunnel(args []string, config *Configuration) error {
 				}
 
 				if !found {
-					return fmt.Errorf("bastion '%s' not found in any profile", bastionName)
+					return Bastion{}, "", fmt.Errorf("bastion '%s' not found in any profile", bastionName)
 				}
 			} else {
 				// Ensure Profile field is set when found in default profile
@@ -731,7 +1160,7 @@ func startBastionTunnel(args []string, config *Configuration) error {
 		// No name specified - use existing logic
 		currentProfile, err = ensureProfile(config, profile, profileShort)
 		if err != nil {
-			return err
+			return Bastion{}, "", err
 		}
 
 		profileInfo := config.Profiles[currentProfile]
@@ -750,96 +1179,7 @@ func startBastionTunnel(args []string, config *Configuration) error {
 		}
 	}
 
-	// Check if Session Manager plugin is installed
-	pluginCheck := exec.Command("session-manager-plugin")
-
-	if err := pluginCheck.Run(); err != nil {
-		return fmt.Errorf("AWS Session Manager plugin is not installed. Please install it first")
-	}
-
-	commandArgs := []string{
-		"ssm",
-		"start-session",
-		"--target",
-		bastion.Instance,
-		"--document-name",
-		"AWS-StartPortForwardingSessionToRemoteHost",
-		"--parameters",
-		fmt.Sprintf(`host="%s",portNumber="%d",localPortNumber="%d"`, bastion.Host, bastion.Port, bastion.LocalPort),
-	}
-
-	// Use profile from bastion if available, otherwise use currentProfile
-	bastionProfile := currentProfile
-
-	if bastion.Profile != "" {
-		bastionProfile = bastion.Profile
-	}
-
-	if len(bastionProfile) != 0 {
-		commandArgs = append(commandArgs, "--profile", bastionProfile)
-	}
-
-	// Ensure that we're logged in before running the command
-	if !isLoggedIn(bastionProfile) {
-		args := []string{}
-
-		if len(bastionProfile) != 0 {
-			args = append(args, "--profile", bastionProfile)
-		}
-
-		login(args, config)
-	}
-
-	fmt.Printf("\nStarting port forwarding session to %s:%d via bastion %s...\n", bastion.Host, bastion.LocalPort, bastion.Instance)
-	fmt.Println("Press Ctrl-C to stop the tunnel and return to the REPL.")
-
-	command := exec.Command("aws", commandArgs...)
-	command.Stdout = os.Stdout
-	command.Stderr = os.Stderr
-	command.Stdin = os.Stdin
-
-	if err := command.Start(); err != nil {
-		return fmt.Errorf("failed to start session: %v", err)
-	}
-
-	// Set up signal handling to catch Ctrl-C
-	signalChan := make(chan os.Signal, 1)
-	setupSignalHandler(signalChan)
-	defer signal.Stop(signalChan)
-
-	// Wait for command completion or interrupt in a goroutine
-	done := make(chan error, 1)
-	go func() {
-		done <- command.Wait()
-	}()
-
-	select {
-	case <-signalChan:
-		// Signal received (Ctrl-C) - kill the command process
-		fmt.Println("\nStopping bastion tunnel...")
-		if err := command.Process.Kill(); err != nil {
-			return fmt.Errorf("failed to kill process: %v", err)
-		}
-
-		// Wait for the process to actually terminate
-		<-done
-
-		// Don't return an error - just return to REPL
-		return nil
-	case err := <-done:
-		// Command completed normally
-		if err != nil {
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				// If the process was terminated by a signal, don't treat it as an error
-				if exitErr.ExitCode() == -1 {
-					return nil
-				}
-			}
-			return fmt.Errorf("session ended with error: %v", err)
-		}
-
-		return nil
-	}
+	return bastion, currentProfile, nil
 }
 
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
@@ -851,24 +1191,13 @@ func removeBastion(args []string, config *Configuration) error {
 	bastionNameShort := flagSet.String("n", "", "--name <bastion name>")
 
 	flagSet.Usage = func() {
-		fmt.Println("USAGE:\n    awsdo bastions remove [--profile <aws cli profile>] [--name <bastion name>]")
+		fmt.Println("USAGE:\n    awsdo bastions remove [--profile <aws cli profile>] [--name <bastion name or id>]")
 	}
 
 	if err := flagSet.Parse(args); err != nil {
 		return nil
 	}
 
-	currentProfile, err := ensureProfile(config, profile, profileShort)
-	if err != nil {
-		return err
-	}
-
-	profileInfo := config.Profiles[currentProfile]
-
-	if len(profileInfo.Bastions) == 0 {
-		return fmt.Errorf("no bastions configured for profile '%s'", currentProfile)
-	}
-
 	reader := bufio.NewReader(os.Stdin)
 
 	// Get bastion name
@@ -883,7 +1212,7 @@ func removeBastion(args []string, config *Configuration) error {
 		targetBastionName = flagSet.Arg(0)
 	default:
 		// Prompt for bastion name
-		fmt.Print("Enter bastion name to remove: ")
+		fmt.Print("Enter bastion name or ID to remove: ")
 		nameInput, _ := reader.ReadString('\n')
 		targetBastionName = strings.TrimSpace(nameInput)
 
@@ -892,12 +1221,15 @@ func removeBastion(args []string, config *Configuration) error {
 		}
 	}
 
-	// Check if bastion exists
-	existingBastion, exists := profileInfo.Bastions[targetBastionName]
-	if !exists {
-		return fmt.Errorf("bastion '%s' not found in profile '%s'", targetBastionName, currentProfile)
+	// An ID also selects the bastion's profile
+	targetBastionName, currentProfile, err := resolveProfileBastion(config, profile, profileShort, targetBastionName)
+	if err != nil {
+		return err
 	}
 
+	profileInfo := config.Profiles[currentProfile]
+	existingBastion := profileInfo.Bastions[targetBastionName]
+
 	// Display bastion information
 	fmt.Printf("\nBastion to remove:\n")
 	fmt.Printf("  Name:       %s\n", targetBastionName)
@@ -940,6 +1272,183 @@ func removeBastion(args []string, config *Configuration) error {
 	return nil
 }
 
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// reconnectBastion shows or changes a bastion's reconnect policy.
+func reconnectBastion(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("bastions reconnect", flag.ContinueOnError)
+	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
+	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
+	maxRetries := flagSet.Int("max-retries", -1, "--max-retries <count>")
+	initialDelay := flagSet.Int("initial-delay", -1, "--initial-delay <seconds>")
+	maxDelay := flagSet.Int("max-delay", -1, "--max-delay <seconds>")
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:\n    awsdo bastions reconnect [--profile <aws cli profile>] <bastion name> [on|off]")
+		fmt.Println("                    [--max-retries <count>] [--initial-delay <seconds>] [--max-delay <seconds>]")
+	}
+
+	positional, err := parseFlags(flagSet, args)
+	if err != nil {
+		return nil
+	}
+
+	if len(positional) == 0 || len(positional) > 2 {
+		flagSet.Usage()
+		return nil
+	}
+
+	currentProfile, err := ensureProfile(config, profile, profileShort)
+	if err != nil {
+		return err
+	}
+
+	profileInfo := config.Profiles[currentProfile]
+	targetBastionName := positional[0]
+
+	existingBastion, exists := profileInfo.Bastions[targetBastionName]
+	if !exists {
+		return fmt.Errorf("bastion '%s' not found in profile '%s'", targetBastionName, currentProfile)
+	}
+
+	policy := ReconnectPolicy{}
+	if existingBastion.Reconnect != nil {
+		policy = *existingBastion.Reconnect
+	}
+
+	changed := false
+
+	if len(positional) == 2 {
+		switch strings.ToLower(positional[1]) {
+		case "on", "true", "yes":
+			policy.Enabled = true
+		case "off", "false", "no":
+			policy.Enabled = false
+		default:
+			return fmt.Errorf("invalid reconnect setting '%s', expected 'on' or 'off'", positional[1])
+		}
+
+		changed = true
+	}
+
+	for _, setting := range []struct {
+		name  string
+		value int
+		field *int
+	}{
+		{"max-retries", *maxRetries, &policy.MaxRetries},
+		{"initial-delay", *initialDelay, &policy.InitialDelay},
+		{"max-delay", *maxDelay, &policy.MaxDelay},
+	} {
+		if setting.value == -1 {
+			continue
+		}
+
+		if setting.value < 0 {
+			return fmt.Errorf("--%s must not be negative", setting.name)
+		}
+
+		*setting.field = setting.value
+		changed = true
+	}
+
+	if changed {
+		existingBastion.Reconnect = &policy
+		profileInfo.Bastions[targetBastionName] = existingBastion
+		config.Profiles[currentProfile] = profileInfo
+	}
+
+	state := "off"
+	if policy.Enabled {
+		state = "on"
+	}
+
+	retries := "unlimited"
+	if policy.MaxRetries > 0 {
+		retries = strconv.Itoa(policy.MaxRetries)
+	}
+
+	fmt.Printf("\nReconnect for bastion '%s' (profile %s):\n", targetBastionName, currentProfile)
+	fmt.Printf("  Enabled:       %s\n", state)
+	fmt.Printf("  Max Retries:   %s\n", retries)
+	fmt.Printf("  Initial Delay: %s\n", reconnectDelay(&policy, 1))
+	fmt.Printf("  Max Delay:     %s\n", reconnectDelay(&policy, 64))
+	fmt.Println()
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// findBastionByID resolves a bastion ID, or a unique prefix of at least minBastionIDPrefix
+// characters, through the bastion lookup. It reports false when no ID matches and fails when a
+// prefix matches several bastions.
+func findBastionByID(config *Configuration, reference string) (BastionLookup, bool, error) {
+	if lookup, exists := config.BastionLookup[reference]; exists {
+		return lookup, true, nil
+	}
+
+	if len(reference) < minBastionIDPrefix {
+		return BastionLookup{}, false, nil
+	}
+
+	var matches []string
+
+	for id := range config.BastionLookup {
+		if strings.HasPrefix(id, strings.ToLower(reference)) {
+			matches = append(matches, id)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return BastionLookup{}, false, nil
+	case 1:
+		return config.BastionLookup[matches[0]], true, nil
+	}
+
+	sort.Strings(matches)
+
+	candidates := make([]string, len(matches))
+
+	for i, id := range matches {
+		lookup := config.BastionLookup[id]
+		candidates[i] = fmt.Sprintf("%s (%s/%s)", id, lookup.Profile, lookup.Name)
+	}
+
+	return BastionLookup{}, false, fmt.Errorf("bastion ID prefix '%s' is ambiguous: %s", reference, strings.Join(candidates, ", "))
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// resolveProfileBastion finds a bastion to change by name in the given or default profile, or by
+// ID or unique ID prefix in any profile. It returns the bastion's name and profile.
+func resolveProfileBastion(config *Configuration, profile *string, profileShort *string, reference string) (string, string, error) {
+	currentProfile, profileErr := ensureProfile(config, profile, profileShort)
+
+	if profileErr == nil {
+		if _, exists := config.Profiles[currentProfile].Bastions[reference]; exists {
+			return reference, currentProfile, nil
+		}
+	}
+
+	lookup, found, err := findBastionByID(config, reference)
+	if err != nil {
+		return "", "", err
+	}
+
+	if !found {
+		if profileErr != nil {
+			return "", "", profileErr
+		}
+
+		return "", "", fmt.Errorf("bastion '%s' not found in profile '%s'", reference, currentProfile)
+	}
+
+	if givenProfile := firstNonEmpty(*profile, *profileShort); givenProfile != "" && givenProfile != lookup.Profile {
+		return "", "", fmt.Errorf("bastion ID '%s' belongs to profile '%s', not '%s'", reference, lookup.Profile, givenProfile)
+	}
+
+	return lookup.Name, lookup.Profile, nil
+}
+
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
 func selectBastionByName(profileInfo Profile, name string) (Bastion, error) {
 	if len(profileInfo.Bastions) == 0 {
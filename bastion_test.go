@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// respondForBastionAdd registers the AWS responses that 'bastions add' needs to add a bastion
+// for the orders-db database through the instance named bastion-a.
+func respondForBastionAdd(fake *FakeRunner) {
+	fake.Respond("rds describe-db-instances", `{"DBInstances": [{
+		"DBInstanceIdentifier": "orders-db",
+		"Engine": "postgres",
+		"Endpoint": {"Address": "orders-db.abc.us-east-1.rds.amazonaws.com", "Port": 5432},
+		"MasterUserSecret": {"SecretArn": "arn:aws:secretsmanager:us-east-1:123:secret:orders"}
+	}]}`)
+	fake.Respond("rds describe-db-clusters", `{"DBClusters": []}`)
+	fake.Fail("elasticache", errors.New("AccessDenied"))
+	fake.Respond("ec2 describe-instances", `{"Reservations": [{"Instances": [
+		{"InstanceId": "i-0001", "State": {"Name": "running"}, "Tags": [{"Key": "Name", "Value": "bastion-a"}]}
+	]}]}`)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func newTestConfiguration() *Configuration {
+	return &Configuration{
+		DefaultProfile: "dev",
+		Profiles:       map[string]Profile{"dev": {Name: "dev"}},
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestAddBastionWithFlags(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("sts get-caller-identity", `{"Account": "123"}`)
+	respondForBastionAdd(fake)
+
+	config := newTestConfiguration()
+	args := []string{"--db-id", "orders-db", "--instance-name", "bastion-a", "--local-port", "15432"}
+
+	if err := addBastion(args, config); err != nil {
+		t.Fatalf("addBastion: %v", err)
+	}
+
+	profile := config.Profiles["dev"]
+	bastion, exists := profile.Bastions["orders-db"]
+
+	if !exists {
+		t.Fatalf("bastion orders-db was not added: %+v", profile.Bastions)
+	}
+
+	if bastion.Instance != "i-0001" || bastion.Host != "orders-db.abc.us-east-1.rds.amazonaws.com" || bastion.Port != 5432 ||
+		bastion.LocalPort != 15432 || bastion.Service != targetServiceRDS || bastion.Engine != "postgres" ||
+		bastion.Secret != "arn:aws:secretsmanager:us-east-1:123:secret:orders" {
+		t.Errorf("bastion = %+v", bastion)
+	}
+
+	if profile.DefaultBastion != "orders-db" {
+		t.Errorf("default bastion = %q, want orders-db", profile.DefaultBastion)
+	}
+
+	if lookup := config.BastionLookup[bastion.ID]; lookup.Profile != "dev" || lookup.Name != "orders-db" {
+		t.Errorf("lookup for %s = %+v", bastion.ID, lookup)
+	}
+
+	if calls := fake.CallsTo("sso login"); len(calls) != 0 {
+		t.Errorf("logged in although the session was valid: %+v", calls)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestAddBastionWithUnknownTarget(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("sts get-caller-identity", `{"Account": "123"}`)
+	respondForBastionAdd(fake)
+
+	config := newTestConfiguration()
+	args := []string{"--db-id", "missing-db", "--instance-name", "bastion-a", "--local-port", "15432"}
+
+	if err := addBastion(args, config); err == nil {
+		t.Fatal("addBastion succeeded for an unknown database")
+	}
+
+	if len(config.Profiles["dev"].Bastions) != 0 {
+		t.Errorf("bastions = %+v, want none", config.Profiles["dev"].Bastions)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// --region looks for the target and the instance in that region, and saves it with the bastion.
+func TestAddBastionWithRegion(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("sts get-caller-identity", `{"Account": "123"}`)
+	respondForBastionAdd(fake)
+
+	config := newTestConfiguration()
+	args := []string{"--db-id", "orders-db", "--instance-name", "bastion-a", "--local-port", "15432", "--region", "eu-west-1"}
+
+	if err := addBastion(args, config); err != nil {
+		t.Fatalf("addBastion: %v", err)
+	}
+
+	if bastion := config.Profiles["dev"].Bastions["orders-db"]; bastion.Region != "eu-west-1" {
+		t.Errorf("region = %q, want eu-west-1", bastion.Region)
+	}
+
+	for _, command := range []string{"rds describe-db-instances", "rds describe-db-clusters", "ec2 describe-instances"} {
+		for _, call := range fake.CallsTo(command) {
+			if !slices.Contains(call.Args, "eu-west-1") {
+				t.Errorf("%s was not sent to eu-west-1: %v", command, call.Args)
+			}
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestUpdateBastionRegion(t *testing.T) {
+	useFakeRunner(t)
+
+	config := newTestConfiguration()
+	config.Profiles["dev"] = Profile{Name: "dev", Bastions: map[string]Bastion{"db": {ID: "b1", Name: "db", Instance: "i-0001"}}}
+
+	if err := updateBastion([]string{"db", "--region", "eu-west-1"}, config); err != nil {
+		t.Fatalf("updateBastion: %v", err)
+	}
+
+	if bastion := config.Profiles["dev"].Bastions["db"]; bastion.Region != "eu-west-1" || bastion.Instance != "i-0001" {
+		t.Errorf("bastion = %+v, want the region changed and the instance kept", bastion)
+	}
+
+	if err := updateBastion([]string{"db", "--all-regions"}, config); err == nil {
+		t.Errorf("updateBastion accepted --all-regions")
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// Aurora and DocumentDB clusters come from one describe-db-clusters call.
+func TestQueryClusterTargetsSplitsEngines(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("rds describe-db-clusters", `{"DBClusters": [
+		{"DBClusterIdentifier": "docs", "Engine": "docdb", "Endpoint": "docs.cluster-abc.docdb.amazonaws.com"},
+		{"DBClusterIdentifier": "orders", "Engine": "aurora-postgresql", "Port": 5432,
+		 "Endpoint": "orders.cluster-abc.rds.amazonaws.com", "ReaderEndpoint": "orders.cluster-ro-abc.rds.amazonaws.com"},
+		{"DBClusterIdentifier": "graph", "Engine": "neptune", "Port": 8182, "Endpoint": "graph.cluster-abc.neptune.amazonaws.com"}
+	]}`)
+
+	targets, err := queryClusterTargets("dev", "")
+	if err != nil {
+		t.Fatalf("queryClusterTargets: %v", err)
+	}
+
+	if calls := fake.CallsTo("rds describe-db-clusters"); len(calls) != 1 {
+		t.Errorf("describe-db-clusters called %d times, want 1", len(calls))
+	}
+
+	expected := []BastionTarget{
+		{Service: targetServiceAuroraWriter, ID: "orders", Port: 5432},
+		{Service: targetServiceAuroraReader, ID: "orders-reader", Port: 5432},
+		{Service: targetServiceDocumentDB, ID: "docs", Port: documentDBDefaultPort},
+	}
+
+	if len(targets) != len(expected) {
+		t.Fatalf("targets = %+v, want %d", targets, len(expected))
+	}
+
+	for i, target := range targets {
+		if target.Service != expected[i].Service || target.ID != expected[i].ID || target.Port != expected[i].Port {
+			t.Errorf("target %d = %+v, want %+v", i, target, expected[i])
+		}
+	}
+}
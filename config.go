@@ -4,12 +4,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 )
 
 type Configuration struct {
 	DefaultProfile string                   `json:"defaultProfile,omitempty"`
+	Backend        string                   `json:"backend,omitempty"`       // AWS backend: "cli" (default) or "native"
+	Endpoints      map[string]string        `json:"endpoints,omitempty"`     // Service endpoint overrides for the native backend
+	SessionClient  string                   `json:"sessionClient,omitempty"` // SSM session client: "plugin" (default) or "builtin"
+	ListenAddress  string                   `json:"listenAddress,omitempty"` // Local address tunnels and the docs server bind (default 127.0.0.1)
 	Profiles       map[string]Profile       `json:"profiles,omitempty"`
-	BastionLookup  map[string]BastionLookup `json:"-"` // Map of bastion ID to profile and name
+	TunnelGroups   map[string]TunnelGroup   `json:"tunnelGroups,omitempty"`  // Groups of bastions from any profile
+	ProfileGroups  map[string][]string      `json:"profileGroups,omitempty"` // Named lists of profiles to search together
+	BastionLookup  map[string]BastionLookup `json:"-"`                       // Map of bastion ID to profile and name
 }
 
 type BastionLookup struct {
@@ -18,46 +25,107 @@ type BastionLookup struct {
 }
 
 type Profile struct {
-	Name            string              `json:"name,omitempty"`
-	DefaultInstance string              `json:"defaultInstance,omitempty"` // Default instance name
-	Bastions        map[string]Bastion  `json:"bastions,omitempty"`        // Multiple named bastions
-	DefaultBastion  string              `json:"defaultBastion,omitempty"`  // Default bastion name
-	Instances       map[string]Instance `json:"instances,omitempty"`       // Named EC2 instances
+	Name            string                 `json:"name,omitempty"`
+	DefaultInstance string                 `json:"defaultInstance,omitempty"`  // Default instance name
+	Bastions        map[string]Bastion     `json:"bastions,omitempty"`         // Multiple named bastions
+	DefaultBastion  string                 `json:"defaultBastion,omitempty"`   // Default bastion name
+	Instances       map[string]Instance    `json:"instances,omitempty"`        // Named EC2 instances
+	Backend         string                 `json:"backend,omitempty"`          // Overrides the global AWS backend
+	Discovery       *BastionDiscovery      `json:"bastionDiscovery,omitempty"` // Rules for finding bastion instances
+	TunnelGroups    map[string]TunnelGroup `json:"tunnelGroups,omitempty"`     // Groups of this profile's bastions
+}
+
+// BastionDiscovery selects the EC2 instances offered as bastions. An instance matches when its
+// Name tag matches any of the name patterns or it has any of the tags. Without names or tags,
+// instances named *bastion* match.
+type BastionDiscovery struct {
+	Names     []string          `json:"names,omitempty"`     // Name tag patterns, e.g. "jump-*"
+	Tags      map[string]string `json:"tags,omitempty"`      // Tag keys and value patterns, e.g. "Role": "bastion"
+	SSMOnline bool              `json:"ssmOnline,omitempty"` // Only instances that are online in SSM
+}
+
+// TunnelGroup names bastions whose tunnels are started together. Bastions are referenced by name,
+// as <profile>/<name>, or by bastion ID. In a profile's group, plain names refer to that profile.
+type TunnelGroup struct {
+	Name     string   `json:"name,omitempty"`
+	Bastions []string `json:"bastions,omitempty"`
 }
 
 type Instance struct {
-	Name    string `json:"name,omitempty"`
-	ID      string `json:"id,omitempty"`
-	Profile string `json:"profile,omitempty"`
-	Host    string `json:"host,omitempty"`
+	Name     string                 `json:"name,omitempty"`
+	ID       string                 `json:"id,omitempty"`
+	Profile  string                 `json:"profile,omitempty"`
+	Host     string                 `json:"host,omitempty"`
+	Region   string                 `json:"region,omitempty"`   // Empty for the profile's region
+	Forwards map[string]PortForward `json:"forwards,omitempty"` // Saved port forwards to the instance itself
 }
 
-type Bastion struct {
-	ID        string `json:"id,omitempty"`
+// PortForward forwards a local port to a port on an instance, e.g. an admin UI or a debugger.
+type PortForward struct {
 	Name      string `json:"name,omitempty"`
-	Profile   string `json:"profile,omitempty"`
-	Instance  string `json:"instance,omitempty"`
-	Host      string `json:"host,omitempty"`
-	Port      int    `json:"port,omitempty"`
+	Port      int    `json:"port,omitempty"` // Port on the instance
 	LocalPort int    `json:"localPort,omitempty"`
 }
 
-type RDSDatabase struct {
-	DBInstanceIdentifier string `json:"ID"`
-	Endpoint             string `json:"Endpoint"`
-	Port                 int    `json:"Port"`
-	Engine               string `json:"Engine"`
+type Bastion struct {
+	ID               string            `json:"id,omitempty"`
+	Name             string            `json:"name,omitempty"`
+	Profile          string            `json:"profile,omitempty"`
+	Instance         string            `json:"instance,omitempty"`         // With a resolver, the last instance it found
+	InstanceResolver *InstanceResolver `json:"instanceResolver,omitempty"` // Finds the instance when connecting
+	Region           string            `json:"region,omitempty"`           // Region of the instance, empty for the profile's region
+	Host             string            `json:"host,omitempty"`
+	Port             int               `json:"port,omitempty"`
+	LocalPort        int               `json:"localPort,omitempty"`
+	Service          string            `json:"service,omitempty"`     // Service type of the remote host, e.g. "rds" or "elasticache"
+	Engine           string            `json:"engine,omitempty"`      // Database engine of the remote host, e.g. "postgres"
+	Secret           string            `json:"secret,omitempty"`      // Secrets Manager ARN or name of the database credentials
+	Reconnect        *ReconnectPolicy  `json:"reconnect,omitempty"`   // Reconnect automatically when the session drops
+	OnDemand         bool              `json:"onDemand,omitempty"`    // Start the session when the first client connects
+	IdleTimeout      int               `json:"idleTimeout,omitempty"` // Seconds without connections before an on-demand session closes
+}
+
+// InstanceResolver finds a bastion's instance by its tags when connecting, for bastions whose
+// instances are replaced, e.g. by an Auto Scaling group. A running instance that is online in SSM
+// must match the name pattern and every tag.
+type InstanceResolver struct {
+	Name string            `json:"name,omitempty"` // Name tag pattern, e.g. "jump-*"
+	Tags map[string]string `json:"tags,omitempty"` // Tag keys and value patterns, e.g. "Role": "bastion"
+}
+
+// ReconnectPolicy controls how a bastion tunnel is re-established after its session ends.
+type ReconnectPolicy struct {
+	Enabled      bool `json:"enabled"`
+	MaxRetries   int  `json:"maxRetries,omitempty"`   // 0 retries until stopped
+	InitialDelay int  `json:"initialDelay,omitempty"` // Seconds before the first retry (default 1)
+	MaxDelay     int  `json:"maxDelay,omitempty"`     // Longest wait between retries in seconds (default 60)
+}
+
+// BastionTarget is an endpoint found by one of the target discoverers.
+type BastionTarget struct {
+	Service   string `json:"Service"` // e.g. "rds", "aurora-writer" or "elasticache"
+	ID        string `json:"ID"`
+	Endpoint  string `json:"Endpoint"`
+	Port      int    `json:"Port"`
+	Engine    string `json:"Engine"`
+	SecretArn string `json:"SecretArn,omitempty"`
 }
 
 type EC2Instance struct {
-	Instance     string `json:"Instance"`
-	Name         string `json:"Name"`
-	AZ           string `json:"AZ"`
-	Host         string `json:"Host"`
-	State        string `json:"State"`
-	InstanceType string `json:"Type"`
-	PublicIP     string `json:"PublicIP"`
-	LaunchTime   string `json:"LaunchTime"`
+	Instance     string            `json:"Instance"`
+	Name         string            `json:"Name"`
+	AZ           string            `json:"AZ"`
+	Host         string            `json:"Host"`
+	State        string            `json:"State"`
+	InstanceType string            `json:"Type"`
+	PublicIP     string            `json:"PublicIP"`
+	LaunchTime   string            `json:"LaunchTime"`
+	VPC          string            `json:"VPC,omitempty"`
+	Subnet       string            `json:"Subnet,omitempty"`
+	Tags         map[string]string `json:"Tags,omitempty"`
+	Region       string            `json:"Region,omitempty"`
+	Profile      string            `json:"Profile,omitempty"`    // Profile the instance was found with
+	PingStatus   string            `json:"PingStatus,omitempty"` // SSM agent status, e.g. "Online" or "ConnectionLost"
 }
 
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
@@ -103,11 +171,15 @@ func loadConfiguration(fileName string) (Configuration, error) {
 
 			if profile.Bastions != nil {
 				for bastionName, bastion := range profile.Bastions {
-					// Set Profile field if not already set
+					// Set Profile and Name fields if not already set
 					if bastion.Profile == "" {
 						bastion.Profile = profileName
 					}
 
+					if bastion.Name == "" {
+						bastion.Name = bastionName
+					}
+
 					// Generate ID if not present
 					if bastion.ID == "" {
 						newID, err := generateBastionID()
@@ -147,6 +219,27 @@ func saveConfiguration(fileName string, config *Configuration) {
 	os.WriteFile(fileName, configBytes, 0644)
 }
 
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// saveBastionInstance records a bastion's instance in the configuration file. The file is read
+// again first, so that changes other awsdo commands made since it was loaded are kept.
+func saveBastionInstance(fileName string, profile string, bastionName string, instance string) error {
+	config, err := loadConfiguration(fileName)
+	if err != nil {
+		return err
+	}
+
+	bastion, exists := config.Profiles[profile].Bastions[bastionName]
+	if !exists {
+		return fmt.Errorf("bastion '%s' is no longer configured for profile '%s'", bastionName, profile)
+	}
+
+	bastion.Instance = instance
+	config.Profiles[profile].Bastions[bastionName] = bastion
+
+	saveConfiguration(fileName, &config)
+	return nil
+}
+
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
 func rebuildBastionLookup(config *Configuration) {
 	// Initialize lookup map if nil
@@ -193,3 +286,16 @@ func rebuildBastionLookup(config *Configuration) {
 		}
 	}
 }
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// sortedProfileNames returns the names of all configured profiles in sorted order.
+func sortedProfileNames(config *Configuration) []string {
+	profileNames := make([]string, 0, len(config.Profiles))
+
+	for profileName := range config.Profiles {
+		profileNames = append(profileNames, profileName)
+	}
+
+	sort.Strings(profileNames)
+	return profileNames
+}
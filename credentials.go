@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	credentialFormatURL    = "url"
+	credentialFormatEnv    = "env"
+	credentialFormatPgpass = "pgpass"
+	credentialFormatMyCnf  = "mycnf"
+)
+
+// databaseCredentials are the fields of a database secret in the format used by RDS and the
+// Secrets Manager rotation templates.
+type databaseCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Engine   string `json:"engine,omitempty"`
+	DBName   string `json:"dbname,omitempty"`
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// fetchDatabaseCredentials reads the bastion's secret. The password is only ever held in memory.
+func fetchDatabaseCredentials(profile string, bastion Bastion) (databaseCredentials, error) {
+	var credentials databaseCredentials
+
+	if bastion.Secret == "" {
+		return credentials, fmt.Errorf("bastion '%s' has no secret, set one with 'awsdo bastions secret %s <secret arn or name>'", bastion.Name, bastion.Name)
+	}
+
+	secret, err := querySecretValue(profile, bastion.Secret)
+	if err != nil {
+		return credentials, fmt.Errorf("failed to read secret '%s': %v", bastion.Secret, err)
+	}
+
+	if err := json.Unmarshal([]byte(secret.SecretString), &credentials); err != nil || credentials.Username == "" {
+		return credentials, fmt.Errorf("secret '%s' does not hold database credentials (a JSON document with username and password)", bastion.Secret)
+	}
+
+	return credentials, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// bastionCredentials prints the bastion's database credentials, pointed at its local tunnel port,
+// as a connection string, environment variables, or a .pgpass or .my.cnf entry.
+func bastionCredentials(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("bastion creds", flag.ContinueOnError)
+	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
+	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
+	format := flagSet.String("format", credentialFormatURL, "--format <url|env|pgpass|mycnf>")
+	engine := flagSet.String("engine", "", "--engine <database engine>")
+	database := flagSet.String("database", "", "--database <database name>")
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:\n    awsdo bastion creds [--profile <aws cli profile>] [--format <url|env|pgpass|mycnf>]")
+		fmt.Println("                    [--engine <engine>] [--database <database>] [<bastion name>]")
+	}
+
+	positional, err := parseFlags(flagSet, args)
+	if err != nil {
+		return nil
+	}
+
+	bastionName := ""
+	if len(positional) > 0 {
+		bastionName = positional[0]
+	}
+
+	bastion, currentProfile, err := resolveBastion(config, profile, profileShort, bastionName)
+	if err != nil {
+		return err
+	}
+
+	bastionProfile := currentProfile
+	if bastion.Profile != "" {
+		bastionProfile = bastion.Profile
+	}
+
+	// Ensure that we're logged in before running the command
+	if !isLoggedIn(bastionProfile) {
+		if err := login([]string{"--profile", bastionProfile}, config); err != nil {
+			return err
+		}
+	}
+
+	credentials, err := fetchDatabaseCredentials(bastionProfile, bastion)
+	if err != nil {
+		return err
+	}
+
+	if *database != "" {
+		credentials.DBName = *database
+	}
+
+	family := databaseEngineFamily(firstNonEmpty(*engine, bastion.Engine, credentials.Engine), bastion.Port)
+
+	output, err := formatDatabaseCredentials(*format, family, bastion.LocalPort, credentials)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(output)
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// formatDatabaseCredentials renders credentials for a client connecting to the local port.
+func formatDatabaseCredentials(format string, family string, localPort int, credentials databaseCredentials) (string, error) {
+	port := strconv.Itoa(localPort)
+
+	switch format {
+	case credentialFormatURL:
+		connectionURL, err := databaseConnectionURL(family, localPort, credentials)
+		if err != nil {
+			return "", err
+		}
+
+		return connectionURL + "\n", nil
+	case credentialFormatEnv:
+		var builder strings.Builder
+
+		variables := [][2]string{}
+
+		if family == "postgres" {
+			variables = append(variables,
+				[2]string{"PGHOST", localHost()},
+				[2]string{"PGPORT", port},
+				[2]string{"PGUSER", credentials.Username},
+				[2]string{"PGPASSWORD", credentials.Password},
+			)
+
+			if credentials.DBName != "" {
+				variables = append(variables, [2]string{"PGDATABASE", credentials.DBName})
+			}
+		} else {
+			variables = append(variables,
+				[2]string{"DB_HOST", localHost()},
+				[2]string{"DB_PORT", port},
+				[2]string{"DB_USER", credentials.Username},
+				[2]string{"DB_PASSWORD", credentials.Password},
+			)
+
+			if credentials.DBName != "" {
+				variables = append(variables, [2]string{"DB_NAME", credentials.DBName})
+			}
+		}
+
+		if connectionURL, err := databaseConnectionURL(family, localPort, credentials); err == nil {
+			variables = append(variables, [2]string{"DATABASE_URL", connectionURL})
+		}
+
+		for _, variable := range variables {
+			fmt.Fprintf(&builder, "export %s=%s\n", variable[0], shellQuote(variable[1]))
+		}
+
+		return builder.String(), nil
+	case credentialFormatPgpass:
+		// hostname:port:database:username:password, with ':' and '\' escaped
+		escape := strings.NewReplacer(`\`, `\\`, `:`, `\:`).Replace
+
+		databaseName := "*"
+		if credentials.DBName != "" {
+			databaseName = escape(credentials.DBName)
+		}
+
+		return fmt.Sprintf("%s:%s:%s:%s:%s\n", escape(localHost()), port, databaseName, escape(credentials.Username), escape(credentials.Password)), nil
+	case credentialFormatMyCnf:
+		quote := func(value string) string {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+		}
+
+		var builder strings.Builder
+
+		builder.WriteString("[client]\n")
+		fmt.Fprintf(&builder, "host=%s\n", localHost())
+		fmt.Fprintf(&builder, "port=%s\n", port)
+		builder.WriteString("protocol=TCP\n")
+		fmt.Fprintf(&builder, "user=%s\n", quote(credentials.Username))
+		fmt.Fprintf(&builder, "password=%s\n", quote(credentials.Password))
+
+		if credentials.DBName != "" {
+			fmt.Fprintf(&builder, "database=%s\n", quote(credentials.DBName))
+		}
+
+		return builder.String(), nil
+	}
+
+	return "", fmt.Errorf("invalid format '%s', expected url, env, pgpass or mycnf", format)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// databaseConnectionURL builds the connection string an engine's drivers expect.
+func databaseConnectionURL(family string, localPort int, credentials databaseCredentials) (string, error) {
+	connectionURL := url.URL{
+		User: url.UserPassword(credentials.Username, credentials.Password),
+		Host: net.JoinHostPort(localHost(), strconv.Itoa(localPort)),
+	}
+
+	if credentials.DBName != "" {
+		connectionURL.Path = "/" + credentials.DBName
+	}
+
+	switch family {
+	case "postgres":
+		connectionURL.Scheme = "postgresql"
+	case "mysql":
+		connectionURL.Scheme = "mysql"
+	case "oracle":
+		connectionURL.Scheme = "oracle"
+	case "redis":
+		connectionURL.Scheme = "redis"
+	case "sqlserver":
+		connectionURL.Scheme = "sqlserver"
+		connectionURL.Path = ""
+
+		if credentials.DBName != "" {
+			connectionURL.RawQuery = url.Values{"database": {credentials.DBName}}.Encode()
+		}
+	case "docdb", "mongodb":
+		// Through a tunnel the driver must not try to discover the other replica set members
+		connectionURL.Scheme = "mongodb"
+		connectionURL.Path = "/" + credentials.DBName
+		query := url.Values{"directConnection": {"true"}}
+
+		if family == "docdb" {
+			query.Set("tls", "true")
+			query.Set("tlsAllowInvalidHostnames", "true")
+			query.Set("retryWrites", "false")
+		}
+
+		connectionURL.RawQuery = query.Encode()
+	default:
+		return "", fmt.Errorf("unknown database engine, use --engine to choose one of postgres, mysql, sqlserver, oracle, docdb, mongodb or redis")
+	}
+
+	return connectionURL.String(), nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// databasePasswordEnvironment returns the environment variable a client reads its password from,
+// so that the password does not have to appear on its command line.
+func databasePasswordEnvironment(family string) string {
+	switch family {
+	case "postgres":
+		return "PGPASSWORD"
+	case "mysql":
+		return "MYSQL_PWD"
+	case "sqlserver":
+		return "SQLCMDPASSWORD"
+	case "redis":
+		return "REDISCLI_AUTH"
+	}
+
+	return ""
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// bastionSecret shows, sets or clears the Secrets Manager secret of a bastion.
+func bastionSecret(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("bastions secret", flag.ContinueOnError)
+	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
+	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
+	clearSecret := flagSet.Bool("clear", false, "--clear")
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:\n    awsdo bastions secret [--profile <aws cli profile>] <bastion name> [<secret arn or name>] [--clear]")
+	}
+
+	positional, err := parseFlags(flagSet, args)
+	if err != nil {
+		return nil
+	}
+
+	if len(positional) == 0 || len(positional) > 2 {
+		flagSet.Usage()
+		return nil
+	}
+
+	currentProfile, err := ensureProfile(config, profile, profileShort)
+	if err != nil {
+		return err
+	}
+
+	profileInfo := config.Profiles[currentProfile]
+	targetBastionName := positional[0]
+
+	existingBastion, exists := profileInfo.Bastions[targetBastionName]
+	if !exists {
+		return fmt.Errorf("bastion '%s' not found in profile '%s'", targetBastionName, currentProfile)
+	}
+
+	switch {
+	case *clearSecret:
+		existingBastion.Secret = ""
+	case len(positional) == 2:
+		existingBastion.Secret = positional[1]
+	}
+
+	profileInfo.Bastions[targetBastionName] = existingBastion
+	config.Profiles[currentProfile] = profileInfo
+
+	if existingBastion.Secret == "" {
+		fmt.Printf("\nBastion '%s' has no secret.\n\n", targetBastionName)
+	} else {
+		fmt.Printf("\nBastion '%s' uses secret %s.\n\n", targetBastionName, existingBastion.Secret)
+	}
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// shellQuote quotes a value for a POSIX shell.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
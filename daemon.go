@@ -0,0 +1,813 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	daemonSocketName   = "awsdo_daemon.sock"
+	daemonLogDirName   = "awsdo_logs"
+	tunnelStateRunning = "running"
+	tunnelStateExited  = "exited"
+)
+
+// daemonRequest is sent to the tunnel daemon over its control socket, one JSON document per line.
+type daemonRequest struct {
+	Action      string `json:"action"` // start, stop or status
+	Profile     string `json:"profile,omitempty"`
+	Name        string `json:"name,omitempty"`
+	LocalPort   int    `json:"localPort,omitempty"`
+	Region      string `json:"region,omitempty"`
+	All         bool   `json:"all,omitempty"`
+	Reconnect   bool   `json:"reconnect,omitempty"`   // Reconnect even if the bastion does not configure it
+	OnDemand    bool   `json:"onDemand,omitempty"`    // Run the tunnel as an on-demand proxy
+	IdleTimeout int    `json:"idleTimeout,omitempty"` // Idle timeout of an on-demand tunnel in seconds
+}
+
+// daemonResponse is the daemon's answer to a request.
+type daemonResponse struct {
+	Error   string         `json:"error,omitempty"`
+	Tunnels []daemonTunnel `json:"tunnels,omitempty"`
+}
+
+// daemonTunnel describes a tunnel owned by the daemon.
+type daemonTunnel struct {
+	Profile   string       `json:"profile"`
+	Name      string       `json:"name"`
+	LocalPort int          `json:"localPort"`
+	PID       int          `json:"pid"`
+	Started   time.Time    `json:"started"`
+	State     string       `json:"state"`
+	LogFile   string       `json:"logFile"`
+	Stats     *tunnelStats `json:"stats,omitempty"` // Readiness, and traffic counters of on-demand tunnels
+}
+
+// backgroundTunnelOptions are passed on to the tunnel processes started by the daemon.
+type backgroundTunnelOptions struct {
+	Reconnect   bool
+	OnDemand    bool
+	IdleTimeout time.Duration
+}
+
+// tunnelDaemon supervises background tunnels. Each tunnel runs as a child awsdo process whose
+// output goes to a log file.
+type tunnelDaemon struct {
+	exePath  string
+	logDir   string
+	listener net.Listener
+
+	mu      sync.Mutex
+	tunnels map[string]*daemonTunnelProcess
+}
+
+// daemonTunnelProcess is a tunnel child process and its status.
+type daemonTunnelProcess struct {
+	info      daemonTunnel
+	tree      *processTree
+	done      chan struct{}
+	statsFile string
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// daemonPaths returns the control socket path and log directory, both kept next to the
+// executable like the configuration file.
+func daemonPaths() (string, string) {
+	exePath, _ := os.Executable()
+	directory := filepath.Dir(exePath)
+
+	return filepath.Join(directory, daemonSocketName), filepath.Join(directory, daemonLogDirName)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// daemonCommand implements the internal "daemon" command used by the background supervisor.
+func daemonCommand(args []string, config *Configuration) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing daemon subcommand")
+	}
+
+	switch args[0] {
+	case "run":
+		return runTunnelDaemon()
+	case "tunnel":
+		return startBastionTunnel(args[1:], config)
+	default:
+		return fmt.Errorf("invalid daemon subcommand: %s", args[0])
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// bastionUp starts one or more bastion tunnels in the background.
+func bastionUp(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("bastion up", flag.ContinueOnError)
+	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
+	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
+	reconnect := flagSet.Bool("reconnect", false, "--reconnect")
+	wait := flagSet.Bool("wait", false, "--wait")
+	timeout := flagSet.Duration("timeout", defaultTunnelReadyTimeout, "--timeout <duration>")
+	onDemand := flagSet.Bool("on-demand", false, "--on-demand")
+	idleTimeout := flagSet.Duration("idle-timeout", 0, "--idle-timeout <duration>")
+	group := flagSet.String("group", "", "--group <tunnel group>")
+
+	var portOptions localPortOptions
+	portOptions.register(flagSet)
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:\n    awsdo bastion up [--profile <aws cli profile>] [--reconnect] [--wait [--timeout <duration>]]")
+		fmt.Println("                    [--on-demand [--idle-timeout <duration>]] [--auto-port | --save-port]")
+		fmt.Println("                    [<bastion name> ... | --group <tunnel group>]")
+	}
+
+	names, err := parseFlags(flagSet, args)
+	if err != nil {
+		return nil
+	}
+
+	waitTimeout := time.Duration(0)
+	if *wait {
+		waitTimeout = *timeout
+	}
+
+	options := backgroundTunnelOptions{Reconnect: *reconnect, OnDemand: *onDemand, IdleTimeout: *idleTimeout}
+
+	if *group != "" {
+		if len(names) > 0 {
+			return fmt.Errorf("bastion names cannot be combined with --group")
+		}
+
+		bastions, err := resolveTunnelGroup(config, profile, profileShort, *group)
+		if err != nil {
+			return err
+		}
+
+		if err := ensureLocalPortsFree(bastions, portOptions, config); err != nil {
+			return err
+		}
+
+		// Log in now, while we have a terminal, since background tunnels cannot prompt
+		loginBastionProfiles(bastions, config)
+
+		return startBackgroundTunnels(bastions, options, waitTimeout)
+	}
+
+	// Without a name, the default bastion is started
+	if len(names) == 0 {
+		names = []string{""}
+	}
+
+	var bastions []Bastion
+
+	for _, name := range names {
+		bastion, currentProfile, err := resolveBastion(config, profile, profileShort, name)
+		if err != nil {
+			return err
+		}
+
+		if bastion.Instance == "" && bastion.InstanceResolver == nil {
+			return fmt.Errorf("no bastion configured for profile '%s'", currentProfile)
+		}
+
+		if bastion.Profile == "" {
+			bastion.Profile = currentProfile
+		}
+
+		bastions = append(bastions, bastion)
+	}
+
+	if err := ensureLocalPortsFree(bastions, portOptions, config); err != nil {
+		return err
+	}
+
+	// Log in now, while we have a terminal, since background tunnels cannot prompt
+	loginBastionProfiles(bastions, config)
+
+	return startBackgroundTunnels(bastions, options, waitTimeout)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// startBackgroundTunnels asks the daemon to start the bastions. With a wait timeout, it returns
+// once every tunnel accepts connections, or stops them and fails when the timeout runs out.
+func startBackgroundTunnels(bastions []Bastion, options backgroundTunnelOptions, waitTimeout time.Duration) error {
+	if err := ensureTunnelDaemon(); err != nil {
+		return err
+	}
+
+	fmt.Println()
+
+	for _, bastion := range bastions {
+		response, err := sendDaemonRequest(daemonRequest{
+			Action:      "start",
+			Profile:     bastion.Profile,
+			Name:        bastion.Name,
+			LocalPort:   bastion.LocalPort,
+			Region:      bastion.Region,
+			Reconnect:   options.Reconnect,
+			OnDemand:    options.OnDemand,
+			IdleTimeout: int(options.IdleTimeout.Seconds()),
+		})
+
+		if err != nil {
+			return fmt.Errorf("failed to start bastion '%s': %v", bastion.Name, err)
+		}
+
+		for _, tunnel := range response.Tunnels {
+			fmt.Printf("Started bastion '%s' (profile %s) on local port %d, PID %d.\n", tunnel.Name, tunnel.Profile, tunnel.LocalPort, tunnel.PID)
+		}
+	}
+
+	if waitTimeout > 0 {
+		fmt.Printf("\nWaiting up to %s for the tunnels to accept connections...\n", waitTimeout)
+
+		deadline := time.Now().Add(waitTimeout)
+
+		for _, bastion := range bastions {
+			if err := waitForBackgroundTunnel(bastion, deadline); err != nil {
+				// Don't leave half-started tunnels behind for a script that is about to fail
+				for _, started := range bastions {
+					sendDaemonRequest(daemonRequest{Action: "stop", Profile: started.Profile, Name: started.Name})
+				}
+
+				return err
+			}
+
+			fmt.Printf("Tunnel ready: %s -> %s:%d (bastion '%s')\n", localAddress(bastion.LocalPort), bastion.Host, bastion.Port, bastion.Name)
+		}
+	}
+
+	fmt.Println("\nUse 'awsdo bastion status' to list background tunnels and 'awsdo bastion down' to stop them.")
+	fmt.Println()
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// waitForBackgroundTunnel asks the daemon for a background tunnel's status until the tunnel
+// reports that it accepts connections, failing early if the tunnel process exits. The local port
+// is not probed, since a probe would use up a connection of the session, and start a session for
+// an on-demand tunnel.
+func waitForBackgroundTunnel(bastion Bastion, deadline time.Time) error {
+	for {
+		if response, err := sendDaemonRequest(daemonRequest{Action: "status"}); err == nil {
+			for _, tunnel := range response.Tunnels {
+				if tunnel.Profile != bastion.Profile || tunnel.Name != bastion.Name {
+					continue
+				}
+
+				if tunnel.State == tunnelStateExited {
+					return fmt.Errorf("bastion '%s' exited before it was ready, see %s", bastion.Name, tunnel.LogFile)
+				}
+
+				if tunnel.Stats != nil && tunnel.Stats.Ready {
+					return nil
+				}
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("bastion '%s' was not ready on local port %d in time", bastion.Name, bastion.LocalPort)
+		}
+
+		time.Sleep(tunnelStatusInterval)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// bastionDown stops background tunnels by name, or all of them.
+func bastionDown(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("bastion down", flag.ContinueOnError)
+	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
+	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
+	all := flagSet.Bool("all", false, "--all")
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:\n    awsdo bastion down [--profile <aws cli profile>] [--all] [<bastion name> ...]")
+	}
+
+	names, err := parseFlags(flagSet, args)
+	if err != nil {
+		return nil
+	}
+
+	targetProfile := *profile
+	if *profileShort != "" {
+		targetProfile = *profileShort
+	}
+
+	if len(names) == 0 && !*all && targetProfile == "" {
+		return fmt.Errorf("specify the bastions to stop, or --all to stop every background tunnel")
+	}
+
+	if _, err := sendDaemonRequest(daemonRequest{Action: "status"}); err != nil {
+		fmt.Println("\nNo background tunnels are running.")
+		fmt.Println()
+		return nil
+	}
+
+	requests := []daemonRequest{}
+
+	if len(names) == 0 {
+		requests = append(requests, daemonRequest{Action: "stop", Profile: targetProfile, All: true})
+	}
+
+	for _, name := range names {
+		requests = append(requests, daemonRequest{Action: "stop", Profile: targetProfile, Name: name})
+	}
+
+	fmt.Println()
+
+	var held []string
+
+	for _, request := range requests {
+		response, err := sendDaemonRequest(request)
+		if err != nil {
+			return err
+		}
+
+		for _, tunnel := range response.Tunnels {
+			fmt.Printf("Stopped bastion '%s' (profile %s).\n", tunnel.Name, tunnel.Profile)
+
+			// A session left running by the tunnel would keep its local port
+			if tunnel.LocalPort > 0 && !waitForLocalPortRelease(tunnel.LocalPort, localPortReleaseTimeout) {
+				held = append(held, fmt.Sprintf("local port %d of bastion '%s' is still held by %s", tunnel.LocalPort, tunnel.Name, describeLocalPortOwner(tunnel.LocalPort)))
+			}
+		}
+	}
+
+	fmt.Println()
+
+	if len(held) > 0 {
+		return fmt.Errorf("%s", strings.Join(held, "; "))
+	}
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// bastionStatus lists the tunnels owned by the daemon.
+func bastionStatus(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("bastion status", flag.ContinueOnError)
+
+	var tableFlags tableOptions
+	tableFlags.register(flagSet)
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:\n    awsdo bastion status [--columns <column>[,<column> ...]] [--sort-by [-]<column>]")
+		fmt.Println("                    [--no-header] [--no-color]")
+	}
+
+	if _, err := parseFlags(flagSet, args); err != nil {
+		return nil
+	}
+
+	headers := []string{"Name", "ID", "Profile", "LPort", "PID", "Uptime", "State", "Session", "Conns", "In", "Out"}
+
+	if err := tableFlags.validate(headers); err != nil {
+		return err
+	}
+
+	response, err := sendDaemonRequest(daemonRequest{Action: "status"})
+	if err != nil || len(response.Tunnels) == 0 {
+		fmt.Println("\nNo background tunnels are running.")
+		fmt.Println()
+		return nil
+	}
+
+	statusTable := table{headers: headers}
+
+	for _, tunnel := range response.Tunnels {
+		uptime := "-"
+		if tunnel.State == tunnelStateRunning {
+			uptime = formatUptime(time.Since(tunnel.Started))
+		}
+
+		// Only on-demand tunnels track their sessions and traffic
+		session, connections, bytesIn, bytesOut := "-", "-", "-", "-"
+
+		if tunnel.Stats != nil && tunnel.Stats.OnDemand {
+			session = "idle"
+			if tunnel.Stats.SessionUp {
+				session = "open"
+			}
+
+			connections = fmt.Sprintf("%d/%d", tunnel.Stats.Active, tunnel.Stats.Connections)
+			bytesIn = formatBytes(tunnel.Stats.BytesIn)
+			bytesOut = formatBytes(tunnel.Stats.BytesOut)
+		}
+
+		statusTable.rows = append(statusTable.rows, []string{
+			tunnel.Name,
+			firstNonEmpty(config.Profiles[tunnel.Profile].Bastions[tunnel.Name].ID, "-"),
+			tunnel.Profile,
+			strconv.Itoa(tunnel.LocalPort),
+			strconv.Itoa(tunnel.PID),
+			uptime,
+			tunnel.State,
+			session,
+			connections,
+			bytesIn,
+			bytesOut,
+		})
+	}
+
+	fmt.Println()
+
+	if err := statusTable.print(tableFlags); err != nil {
+		return err
+	}
+
+	_, logDir := daemonPaths()
+	fmt.Printf("\nTunnel logs are in %s\n", logDir)
+	fmt.Println()
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func formatUptime(d time.Duration) string {
+	d = d.Round(time.Second)
+
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	default:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// sendDaemonRequest sends a request to the running daemon and returns its response.
+func sendDaemonRequest(request daemonRequest) (daemonResponse, error) {
+	socketPath, _ := daemonPaths()
+
+	conn, err := net.DialTimeout("unix", socketPath, 2*time.Second)
+	if err != nil {
+		return daemonResponse{}, fmt.Errorf("the tunnel daemon is not running")
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return daemonResponse{}, err
+	}
+
+	var response daemonResponse
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&response); err != nil {
+		return daemonResponse{}, fmt.Errorf("invalid response from the tunnel daemon: %v", err)
+	}
+
+	if response.Error != "" {
+		return response, errors.New(response.Error)
+	}
+
+	return response, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// ensureTunnelDaemon starts the daemon in the background unless it is already running.
+func ensureTunnelDaemon() error {
+	if _, err := sendDaemonRequest(daemonRequest{Action: "status"}); err == nil {
+		return nil
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	_, logDir := daemonPaths()
+	if err := os.MkdirAll(logDir, 0700); err != nil {
+		return fmt.Errorf("failed to create log directory: %v", err)
+	}
+
+	logFile, err := os.OpenFile(filepath.Join(logDir, "daemon.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open daemon log: %v", err)
+	}
+	defer logFile.Close()
+
+	command := exec.Command(exePath, "daemon", "run")
+	command.Stdout = logFile
+	command.Stderr = logFile
+	command.SysProcAttr = detachedProcessAttributes()
+
+	if err := command.Start(); err != nil {
+		return fmt.Errorf("failed to start the tunnel daemon: %v", err)
+	}
+
+	// The daemon keeps running after we exit
+	command.Process.Release()
+
+	for range 50 {
+		time.Sleep(100 * time.Millisecond)
+
+		if _, err := sendDaemonRequest(daemonRequest{Action: "status"}); err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("the tunnel daemon did not start, see %s", filepath.Join(logDir, "daemon.log"))
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// runTunnelDaemon listens on the control socket until the last tunnel is stopped.
+func runTunnelDaemon() error {
+	socketPath, logDir := daemonPaths()
+
+	if _, err := sendDaemonRequest(daemonRequest{Action: "status"}); err == nil {
+		return fmt.Errorf("the tunnel daemon is already running")
+	}
+
+	// A socket left behind by a daemon that did not exit cleanly would block the listener
+	os.Remove(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", socketPath, err)
+	}
+	defer os.Remove(socketPath)
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	daemon := &tunnelDaemon{
+		exePath:  exePath,
+		logDir:   logDir,
+		listener: listener,
+		tunnels:  make(map[string]*daemonTunnelProcess),
+	}
+
+	fmt.Printf("%s tunnel daemon started, PID %d\n", time.Now().Format(time.RFC3339), os.Getpid())
+
+	signalChan := make(chan os.Signal, 1)
+	setupSignalHandler(signalChan)
+
+	go func() {
+		<-signalChan
+		daemon.stop(daemonRequest{All: true})
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			break
+		}
+
+		go daemon.handle(conn)
+	}
+
+	fmt.Printf("%s tunnel daemon stopped\n", time.Now().Format(time.RFC3339))
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (d *tunnelDaemon) handle(conn net.Conn) {
+	defer conn.Close()
+
+	var request daemonRequest
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&request); err != nil {
+		return
+	}
+
+	var response daemonResponse
+	var err error
+
+	switch request.Action {
+	case "start":
+		response.Tunnels, err = d.start(request)
+	case "stop":
+		response.Tunnels, err = d.stop(request)
+	case "status":
+		response.Tunnels = d.status()
+	default:
+		err = fmt.Errorf("unknown action '%s'", request.Action)
+	}
+
+	if err != nil {
+		response.Error = err.Error()
+	}
+
+	json.NewEncoder(conn).Encode(response)
+
+	// Nothing left to supervise once the last tunnel has been stopped
+	if request.Action == "stop" && d.runningCount() == 0 {
+		d.listener.Close()
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// start launches a tunnel child process for a bastion.
+func (d *tunnelDaemon) start(request daemonRequest) ([]daemonTunnel, error) {
+	key := request.Profile + "/" + request.Name
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if existing, exists := d.tunnels[key]; exists && existing.info.State == tunnelStateRunning {
+		return nil, fmt.Errorf("bastion '%s' is already running (PID %d)", request.Name, existing.info.PID)
+	}
+
+	if err := os.MkdirAll(d.logDir, 0700); err != nil {
+		return nil, err
+	}
+
+	logPath := filepath.Join(d.logDir, fmt.Sprintf("%s-%s.log", request.Profile, request.Name))
+
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// On-demand tunnels report their traffic through a stats file next to the log
+	statsPath := filepath.Join(d.logDir, fmt.Sprintf("%s-%s.stats.json", request.Profile, request.Name))
+	os.Remove(statsPath)
+
+	options := backgroundTunnelOptions{
+		Reconnect:   request.Reconnect,
+		OnDemand:    request.OnDemand,
+		IdleTimeout: time.Duration(request.IdleTimeout) * time.Second,
+	}
+
+	tunnelArgs := append(tunnelCommandArgs(request.Profile, request.Name, request.LocalPort, request.Region, options), "--stats-file", statsPath)
+
+	command := exec.Command(d.exePath, tunnelArgs...)
+	command.Stdout = logFile
+	command.Stderr = logFile
+
+	// The tunnel and the session it starts are stopped as one tree, so that no session outlives it
+	tree, err := startProcessTree(command)
+	if err != nil {
+		logFile.Close()
+		return nil, err
+	}
+
+	tunnel := &daemonTunnelProcess{
+		info: daemonTunnel{
+			Profile:   request.Profile,
+			Name:      request.Name,
+			LocalPort: request.LocalPort,
+			PID:       command.Process.Pid,
+			Started:   time.Now(),
+			State:     tunnelStateRunning,
+			LogFile:   logPath,
+		},
+		tree:      tree,
+		done:      make(chan struct{}),
+		statsFile: statsPath,
+	}
+
+	d.tunnels[key] = tunnel
+
+	fmt.Printf("%s started %s (PID %d)\n", time.Now().Format(time.RFC3339), key, tunnel.info.PID)
+
+	go func() {
+		err := command.Wait()
+		tree.release()
+		logFile.Close()
+
+		d.mu.Lock()
+		tunnel.info.State = tunnelStateExited
+		d.mu.Unlock()
+
+		fmt.Printf("%s %s exited: %v\n", time.Now().Format(time.RFC3339), key, err)
+		close(tunnel.done)
+	}()
+
+	return []daemonTunnel{tunnel.info}, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// tunnelCommandArgs returns the arguments that run a bastion's tunnel in a child awsdo process.
+// The local port may differ from the bastion's when its own port was in use, and the region is
+// passed on since the child may start before a newly found region is saved.
+func tunnelCommandArgs(profile string, name string, localPort int, region string, options backgroundTunnelOptions) []string {
+	tunnelArgs := []string{"daemon", "tunnel", "--profile", profile, "--name", name}
+
+	if localPort > 0 {
+		tunnelArgs = append(tunnelArgs, "--local", strconv.Itoa(localPort))
+	}
+
+	tunnelArgs = append(tunnelArgs, regionArgs(region)...)
+
+	if options.Reconnect {
+		tunnelArgs = append(tunnelArgs, "--reconnect")
+	}
+
+	if options.OnDemand {
+		tunnelArgs = append(tunnelArgs, "--on-demand")
+	}
+
+	if options.IdleTimeout > 0 {
+		tunnelArgs = append(tunnelArgs, "--idle-timeout", options.IdleTimeout.String())
+	}
+
+	return tunnelArgs
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// stop ends the tunnels matching the request and forgets them.
+func (d *tunnelDaemon) stop(request daemonRequest) ([]daemonTunnel, error) {
+	d.mu.Lock()
+
+	var matched []*daemonTunnelProcess
+
+	for key, tunnel := range d.tunnels {
+		if request.Profile != "" && tunnel.info.Profile != request.Profile {
+			continue
+		}
+
+		if !request.All && tunnel.info.Name != request.Name {
+			continue
+		}
+
+		matched = append(matched, tunnel)
+		delete(d.tunnels, key)
+	}
+
+	d.mu.Unlock()
+
+	if len(matched) == 0 && !request.All {
+		return nil, fmt.Errorf("no background tunnel named '%s'", request.Name)
+	}
+
+	var stopped []daemonTunnel
+
+	for _, tunnel := range matched {
+		select {
+		case <-tunnel.done:
+		default:
+			tunnel.tree.stop()
+
+			select {
+			case <-tunnel.done:
+			case <-time.After(10 * time.Second):
+				tunnel.tree.kill()
+				<-tunnel.done
+			}
+		}
+
+		stopped = append(stopped, tunnel.info)
+	}
+
+	return stopped, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (d *tunnelDaemon) status() []daemonTunnel {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tunnels := make([]daemonTunnel, 0, len(d.tunnels))
+
+	for _, tunnel := range d.tunnels {
+		info := tunnel.info
+
+		if stats, err := readTunnelStats(tunnel.statsFile); err == nil {
+			info.Stats = &stats
+		}
+
+		tunnels = append(tunnels, info)
+	}
+
+	sort.Slice(tunnels, func(i, j int) bool {
+		if tunnels[i].Profile != tunnels[j].Profile {
+			return tunnels[i].Profile < tunnels[j].Profile
+		}
+
+		return tunnels[i].Name < tunnels[j].Name
+	})
+
+	return tunnels
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (d *tunnelDaemon) runningCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	count := 0
+
+	for _, tunnel := range d.tunnels {
+		if tunnel.info.State == tunnelStateRunning {
+			count++
+		}
+	}
+
+	return count
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// databaseClientOptions are the command line settings for a database client.
+type databaseClientOptions struct {
+	Engine   string   // Overrides the bastion's engine
+	User     string   // Database user
+	Database string   // Database to connect to
+	Args     []string // Extra arguments passed to the client
+	IAMAuth  bool     // Sign in with an IAM authentication token instead of a password
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// databaseEngineFamily maps an RDS, DocumentDB, ElastiCache or Redshift engine name to the client family
+// used to connect to it. Without an engine, the well-known port of the remote host decides.
+func databaseEngineFamily(engine string, port int) string {
+	engine = strings.ToLower(engine)
+
+	switch {
+	case strings.Contains(engine, "postgres"), engine == "redshift":
+		return "postgres"
+	case strings.HasPrefix(engine, "aurora"), strings.Contains(engine, "mysql"), strings.Contains(engine, "mariadb"):
+		return "mysql"
+	case strings.HasPrefix(engine, "sqlserver"):
+		return "sqlserver"
+	case strings.HasPrefix(engine, "oracle"):
+		return "oracle"
+	case engine == "docdb":
+		return "docdb"
+	case strings.Contains(engine, "mongo"):
+		return "mongodb"
+	case engine == "redis", engine == "valkey":
+		return "redis"
+	case engine != "":
+		return ""
+	}
+
+	switch port {
+	case 5432:
+		return "postgres"
+	case 3306:
+		return "mysql"
+	case 1433:
+		return "sqlserver"
+	case 1521:
+		return "oracle"
+	case 27017:
+		return "mongodb"
+	case 6379:
+		return "redis"
+	}
+
+	return ""
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// databaseClientCommand returns the client program and arguments that connect to an engine
+// family through the local port.
+func databaseClientCommand(family string, localPort int, options databaseClientOptions) (string, []string, error) {
+	port := strconv.Itoa(localPort)
+
+	var client string
+	var args []string
+
+	switch family {
+	case "postgres":
+		client = "psql"
+		args = []string{"-h", localHost(), "-p", port}
+
+		if options.User != "" {
+			args = append(args, "-U", options.User)
+		}
+
+		if options.Database != "" {
+			args = append(args, "-d", options.Database)
+		}
+	case "mysql":
+		client = "mysql"
+		args = []string{"-h", localHost(), "-P", port, "--protocol=TCP"}
+
+		if options.User != "" {
+			args = append(args, "-u", options.User)
+		}
+
+		// IAM tokens are sent in clear text, which RDS only accepts over TLS
+		if options.IAMAuth {
+			args = append(args, "--enable-cleartext-plugin", "--ssl-mode=REQUIRED")
+		}
+
+		if options.Database != "" {
+			args = append(args, options.Database)
+		}
+	case "sqlserver":
+		client = "sqlcmd"
+		args = []string{"-S", localHost() + "," + port}
+
+		if options.User != "" {
+			args = append(args, "-U", options.User)
+		}
+
+		if options.Database != "" {
+			args = append(args, "-d", options.Database)
+		}
+	case "oracle":
+		if options.User == "" || options.Database == "" {
+			return "", nil, fmt.Errorf("connecting to Oracle needs --user and --database (the service name)")
+		}
+
+		client = "sqlplus"
+		args = []string{fmt.Sprintf("%s@//%s/%s", options.User, net.JoinHostPort(localHost(), port), options.Database)}
+	case "docdb", "mongodb":
+		client = "mongosh"
+		args = []string{"--host", localHost(), "--port", port}
+
+		// DocumentDB requires TLS, and its certificate names the cluster rather than localhost
+		if family == "docdb" {
+			args = append(args, "--tls", "--tlsAllowInvalidHostnames")
+		}
+
+		if options.User != "" {
+			args = append(args, "--username", options.User)
+		}
+
+		if options.Database != "" {
+			args = append(args, options.Database)
+		}
+	case "redis":
+		client = "redis-cli"
+		args = []string{"-h", localHost(), "-p", port}
+
+		if options.User != "" {
+			args = append(args, "--user", options.User)
+		}
+	default:
+		return "", nil, fmt.Errorf("unknown database engine, use --engine to choose one of postgres, mysql, sqlserver, oracle, docdb, mongodb or redis")
+	}
+
+	return client, append(args, options.Args...), nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// connectDatabaseClient starts a session for the bastion, waits until its local port is ready,
+// runs the database client against it, and closes the session when the client exits.
+func connectDatabaseClient(bastion Bastion, profile string, options databaseClientOptions) error {
+	// Credentials from the bastion's secret fill in the user, database and password
+	var credentials databaseCredentials
+
+	if bastion.Secret != "" && options.User == "" && !options.IAMAuth {
+		var err error
+
+		if credentials, err = fetchDatabaseCredentials(profile, bastion); err != nil {
+			return err
+		}
+
+		options.User = credentials.Username
+
+		if options.Database == "" {
+			options.Database = credentials.DBName
+		}
+	}
+
+	// Check the client first so that a missing client doesn't cost a session
+	family := databaseEngineFamily(firstNonEmpty(options.Engine, bastion.Engine, credentials.Engine), bastion.Port)
+
+	client, _, err := databaseClientCommand(family, bastion.LocalPort, options)
+	if err != nil {
+		return err
+	}
+
+	if _, err := exec.LookPath(client); err != nil {
+		return fmt.Errorf("%s is not installed or not on the PATH", client)
+	}
+
+	// An IAM authentication token takes the place of the password
+	if options.IAMAuth {
+		if family != "postgres" && family != "mysql" {
+			return fmt.Errorf("IAM authentication is only supported for PostgreSQL and MySQL databases")
+		}
+
+		if options.User == "" {
+			return fmt.Errorf("IAM authentication needs the database user, pass it with --user")
+		}
+
+		if credentials.Password, err = bastionAuthToken(profile, bastion, options.User, ""); err != nil {
+			return fmt.Errorf("failed to generate an IAM authentication token: %v", err)
+		}
+	}
+
+	// The bastion's port may already be taken, for example by its own background tunnel
+	localPort := bastion.LocalPort
+
+	if localPort == 0 || !isLocalPortAvailable(localPort) {
+		if localPort, err = freeLocalPort(); err != nil {
+			return err
+		}
+
+		if bastion.LocalPort != 0 {
+			fmt.Printf("\nLocal port %d is in use, connecting through port %d instead.\n", bastion.LocalPort, localPort)
+		}
+	}
+
+	_, clientArgs, _ := databaseClientCommand(family, localPort, options)
+
+	// Ctrl-C cancels the wait for the tunnel, and belongs to the client once it runs. The session
+	// runs detached from the console, so neither its input nor Ctrl-C reach it
+	signalChan := make(chan os.Signal, 1)
+	setupSignalHandler(signalChan)
+	defer signal.Stop(signalChan)
+
+	fmt.Printf("\nStarting port forwarding session to %s:%d via bastion %s...\n", bastion.Host, bastion.Port, bastion.Instance)
+
+	// The client owns the console, so keep the session quiet, and only watch its output for the
+	// message that its port is open. Probing the port instead would use up a connection, which
+	// the built-in session client only accepts one of.
+	readyWriter := newSessionReadyWriter(io.Discard)
+	previousOutput := sessionOutput
+	sessionOutput = readyWriter
+	defer func() { sessionOutput = previousOutput }()
+
+	process, err := startPortForwardingSession(bastion, profile, localPort)
+	if err != nil {
+		return fmt.Errorf("failed to start session: %v", err)
+	}
+
+	var sessionErr error
+	sessionEnded := make(chan struct{})
+
+	go func() {
+		sessionErr = process.Wait()
+		close(sessionEnded)
+	}()
+
+	select {
+	case <-readyWriter.ready:
+	case <-signalChan:
+		process.Kill()
+		<-sessionEnded
+
+		fmt.Println("\nCancelled.")
+		return nil
+	case <-sessionEnded:
+		if sessionErr != nil {
+			return fmt.Errorf("the tunnel did not become ready: %v", sessionErr)
+		}
+
+		return fmt.Errorf("the session ended before it opened its port")
+	case <-time.After(defaultTunnelReadyTimeout):
+		process.Kill()
+		<-sessionEnded
+
+		return fmt.Errorf("the tunnel did not become ready within %s", defaultTunnelReadyTimeout)
+	}
+
+	fmt.Printf("Tunnel ready: %s -> %s:%d\n", localAddress(localPort), bastion.Host, bastion.Port)
+	fmt.Printf("Starting %s...\n\n", client)
+
+	command := exec.Command(client, clientArgs...)
+	command.Env = os.Environ()
+
+	if variable := databasePasswordEnvironment(family); variable != "" && credentials.Password != "" {
+		command.Env = append(command.Env, variable+"="+credentials.Password)
+	}
+
+	if options.IAMAuth && family == "postgres" && os.Getenv("PGSSLMODE") == "" {
+		command.Env = append(command.Env, "PGSSLMODE=require")
+	}
+
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	clientErr := command.Run()
+
+	process.Kill()
+	<-sessionEnded
+
+	fmt.Println("\nTunnel closed.")
+
+	if clientErr != nil {
+		var exitErr *exec.ExitError
+		if errors.As(clientErr, &exitErr) {
+			return fmt.Errorf("%s exited with code %d", client, exitErr.ExitCode())
+		}
+
+		return fmt.Errorf("failed to run %s: %v", client, clientErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// bastionDiscovery shows or changes the rules that 'bastions add' and 'bastions update' use to
+// find bastion instances, and with --test lists the instances they match.
+func bastionDiscovery(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("bastions discovery", flag.ContinueOnError)
+	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
+	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
+	ssmOnline := flagSet.Bool("ssm-online", false, "--ssm-online[=false]")
+	clearRules := flagSet.Bool("clear", false, "--clear")
+	test := flagSet.Bool("test", false, "--test")
+
+	var names stringListFlag
+	var tags stringListFlag
+
+	flagSet.Var(&names, "name", "--name <name pattern>")
+	flagSet.Var(&tags, "tag", "--tag <key>=<value pattern>")
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:\n    awsdo bastions discovery [--profile <aws cli profile>] [--name <name pattern> ...]")
+		fmt.Println("                    [--tag <key>=<value pattern> ...] [--ssm-online[=false]] [--clear] [--test]")
+	}
+
+	positional, err := parseFlags(flagSet, args)
+	if err != nil {
+		return nil
+	}
+
+	if len(positional) > 0 {
+		flagSet.Usage()
+		return nil
+	}
+
+	currentProfile, err := ensureProfile(config, profile, profileShort)
+	if err != nil {
+		return err
+	}
+
+	profileInfo := config.Profiles[currentProfile]
+
+	rules := BastionDiscovery{}
+	if profileInfo.Discovery != nil && !*clearRules {
+		rules = *profileInfo.Discovery
+	}
+
+	changed := *clearRules
+
+	// Repeated --name and --tag flags replace the current patterns rather than adding to them
+	if len(names) > 0 {
+		rules.Names = names
+		changed = true
+	}
+
+	if len(tags) > 0 {
+		rules.Tags = make(map[string]string)
+
+		for _, tag := range tags {
+			key, value, _ := strings.Cut(tag, "=")
+
+			if key == "" {
+				return fmt.Errorf("invalid tag filter '%s', expected <key>=<value pattern>", tag)
+			}
+
+			rules.Tags[key] = value
+		}
+
+		changed = true
+	}
+
+	flagSet.Visit(func(f *flag.Flag) {
+		if f.Name == "ssm-online" {
+			rules.SSMOnline = *ssmOnline
+			changed = true
+		}
+	})
+
+	if changed {
+		if len(rules.Names) == 0 && len(rules.Tags) == 0 && !rules.SSMOnline {
+			profileInfo.Discovery = nil
+		} else {
+			profileInfo.Discovery = &rules
+		}
+
+		config.Profiles[currentProfile] = profileInfo
+	}
+
+	fmt.Printf("\nBastion discovery for profile %s:\n", currentProfile)
+
+	if len(rules.Names) == 0 && len(rules.Tags) == 0 {
+		fmt.Println("  Names:      *bastion* (default)")
+	} else {
+		if len(rules.Names) > 0 {
+			fmt.Printf("  Names:      %s\n", strings.Join(rules.Names, ", "))
+		}
+
+		for _, key := range sortedKeys(rules.Tags) {
+			fmt.Printf("  Tag:        %s=%s\n", key, firstNonEmpty(rules.Tags[key], "*"))
+		}
+	}
+
+	if rules.SSMOnline {
+		fmt.Println("  SSM Online: required")
+	} else {
+		fmt.Println("  SSM Online: not required")
+	}
+
+	fmt.Println()
+
+	if !*test {
+		return nil
+	}
+
+	// Ensure that we're logged in before running the command
+	if !isLoggedIn(currentProfile) {
+		if err := login([]string{"--profile", currentProfile}, config); err != nil {
+			return err
+		}
+	}
+
+	instances, err := queryBastionInstances(currentProfile, "", &rules)
+	if err != nil {
+		return fmt.Errorf("failed to query bastion instances: %v", err)
+	}
+
+	if len(instances) == 0 {
+		fmt.Println("No matching instances found.")
+		fmt.Println()
+		return nil
+	}
+
+	fmt.Println("Matching instances:")
+
+	for _, instance := range instances {
+		fmt.Printf("  %s (%s) - %s, SSM: %s\n", instance.Name, instance.Instance, instance.State, firstNonEmpty(instance.PingStatus, "unknown"))
+	}
+
+	fmt.Println()
+
+	return nil
+}
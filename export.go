@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	exportFormatEnv     = "env"
+	exportFormatCompose = "compose"
+	exportFormatJSON    = "json"
+
+	// dockerHost is how containers reach the tunnels listening on the host
+	dockerHost = "host.docker.internal"
+)
+
+// exportedTunnel describes where a bastion's tunnel can be reached, for other tools.
+type exportedTunnel struct {
+	Name       string `json:"name"`
+	ID         string `json:"id,omitempty"`
+	Profile    string `json:"profile"`
+	Variable   string `json:"variable"` // Prefix of the environment variables in the env and compose formats
+	LocalHost  string `json:"localHost"`
+	LocalPort  int    `json:"localPort"`
+	RemoteHost string `json:"remoteHost"`
+	RemotePort int    `json:"remotePort"`
+	Engine     string `json:"engine,omitempty"`
+	Service    string `json:"service,omitempty"`
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// exportBastions writes the local addresses of the configured bastions' tunnels as a .env file, a
+// docker-compose override or JSON, so that other tools follow changes to the local ports.
+func exportBastions(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("bastions export", flag.ContinueOnError)
+	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
+	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
+	group := flagSet.String("group", "", "--group <tunnel group>")
+	format := flagSet.String("format", exportFormatEnv, "--format <env|compose|json>")
+	file := flagSet.String("file", "", "--file <output file>")
+
+	var services stringListFlag
+	flagSet.Var(&services, "service", "--service <compose service>")
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:\n    awsdo bastions export [--profile <aws cli profile>] [--group <tunnel group>]")
+		fmt.Println("                    [--format <env|compose|json>] [--service <compose service> ...]")
+		fmt.Println("                    [--file <output file>]")
+	}
+
+	if _, err := parseFlags(flagSet, args); err != nil {
+		return nil
+	}
+
+	bastions, err := exportedBastions(config, profile, profileShort, *group)
+	if err != nil {
+		return err
+	}
+
+	if len(services) == 0 {
+		services = stringListFlag{"app"}
+	}
+
+	output, err := formatExportedTunnels(*format, exportedTunnels(bastions), services)
+	if err != nil {
+		return err
+	}
+
+	// The warning goes to stderr, so that the override written to stdout stays valid
+	if *format == exportFormatCompose && isLoopbackListenAddress() {
+		fmt.Fprintf(os.Stderr, "Warning: tunnels listen on %s, which containers on Linux cannot reach through %s. Use 'awsdo backend --listen-address 0.0.0.0' to make them reachable.\n", listenAddress, dockerHost)
+	}
+
+	if *file == "" {
+		fmt.Print(output)
+		return nil
+	}
+
+	if err := os.WriteFile(*file, []byte(output), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", *file, err)
+	}
+
+	fmt.Printf("\nExported %d bastions to %s\n\n", len(bastions), *file)
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// exportedBastions returns the bastions of a tunnel group, of one profile, or of all profiles.
+func exportedBastions(config *Configuration, profile *string, profileShort *string, group string) ([]Bastion, error) {
+	if group != "" {
+		return resolveTunnelGroup(config, profile, profileShort, group)
+	}
+
+	targetProfile := firstNonEmpty(*profile, *profileShort)
+
+	if _, exists := config.Profiles[targetProfile]; targetProfile != "" && !exists {
+		return nil, fmt.Errorf("profile '%s' not found", targetProfile)
+	}
+
+	var bastions []Bastion
+
+	for _, profileName := range sortedProfileNames(config) {
+		if targetProfile != "" && profileName != targetProfile {
+			continue
+		}
+
+		profileBastions := config.Profiles[profileName].Bastions
+
+		for _, name := range sortedKeys(profileBastions) {
+			bastion := profileBastions[name]
+			bastion.Profile = firstNonEmpty(bastion.Profile, profileName)
+
+			bastions = append(bastions, bastion)
+		}
+	}
+
+	if len(bastions) == 0 {
+		return nil, fmt.Errorf("no bastions configured")
+	}
+
+	return bastions, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// exportedTunnels describes the bastions' tunnels. Variable names are qualified with the profile
+// when the bastions span profiles, like the labels of tunnel groups.
+func exportedTunnels(bastions []Bastion) []exportedTunnel {
+	qualified := false
+
+	for _, bastion := range bastions {
+		if bastion.Profile != bastions[0].Profile {
+			qualified = true
+			break
+		}
+	}
+
+	tunnels := make([]exportedTunnel, 0, len(bastions))
+
+	for _, bastion := range bastions {
+		variable := bastion.Name
+		if qualified {
+			variable = bastion.Profile + "_" + bastion.Name
+		}
+
+		tunnels = append(tunnels, exportedTunnel{
+			Name:       bastion.Name,
+			ID:         bastion.ID,
+			Profile:    bastion.Profile,
+			Variable:   environmentVariableName(variable),
+			LocalHost:  localHost(),
+			LocalPort:  bastion.LocalPort,
+			RemoteHost: bastion.Host,
+			RemotePort: bastion.Port,
+			Engine:     bastion.Engine,
+			Service:    bastion.Service,
+		})
+	}
+
+	return tunnels
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// formatExportedTunnels renders the tunnels as a .env file, a docker-compose override for the
+// services, or JSON.
+func formatExportedTunnels(format string, tunnels []exportedTunnel, services []string) (string, error) {
+	var builder strings.Builder
+
+	switch format {
+	case exportFormatEnv:
+		builder.WriteString("# Bastion tunnels exported by 'awsdo bastions export'\n")
+
+		for _, tunnel := range tunnels {
+			fmt.Fprintf(&builder, "%s_HOST=%s\n", tunnel.Variable, tunnel.LocalHost)
+			fmt.Fprintf(&builder, "%s_PORT=%d\n", tunnel.Variable, tunnel.LocalPort)
+		}
+
+		return builder.String(), nil
+	case exportFormatCompose:
+		// Containers reach the host's tunnels through host.docker.internal, which Linux hosts
+		// only resolve with the host-gateway mapping
+		builder.WriteString("# Bastion tunnels exported by 'awsdo bastions export --format compose'\n")
+		builder.WriteString("# Use with: docker compose -f docker-compose.yml -f <this file> up\n")
+		builder.WriteString("services:\n")
+
+		for _, service := range services {
+			fmt.Fprintf(&builder, "  %s:\n", service)
+			builder.WriteString("    extra_hosts:\n")
+			fmt.Fprintf(&builder, "      - %s\n", yamlQuote(dockerHost+":host-gateway"))
+			builder.WriteString("    environment:\n")
+
+			for _, tunnel := range tunnels {
+				fmt.Fprintf(&builder, "      %s_HOST: %s\n", tunnel.Variable, yamlQuote(dockerHost))
+				fmt.Fprintf(&builder, "      %s_PORT: %s\n", tunnel.Variable, yamlQuote(strconv.Itoa(tunnel.LocalPort)))
+			}
+		}
+
+		return builder.String(), nil
+	case exportFormatJSON:
+		data, err := json.MarshalIndent(tunnels, "", "  ")
+		if err != nil {
+			return "", err
+		}
+
+		return string(data) + "\n", nil
+	}
+
+	return "", fmt.Errorf("invalid format '%s', expected env, compose or json", format)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// isLoopbackListenAddress reports whether tunnels only listen on a loopback address. The
+// host-gateway mapping of Linux containers leads to the host's bridge address, which does not
+// reach them there.
+func isLoopbackListenAddress() bool {
+	if ip := net.ParseIP(listenAddress); ip != nil {
+		return ip.IsLoopback()
+	}
+
+	return strings.EqualFold(listenAddress, "localhost")
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// environmentVariableName turns a bastion name such as "orders-db" into "ORDERS_DB".
+func environmentVariableName(name string) string {
+	var builder strings.Builder
+
+	for _, r := range strings.ToUpper(name) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			builder.WriteRune(r)
+		} else {
+			builder.WriteRune('_')
+		}
+	}
+
+	variable := builder.String()
+
+	// Variable names cannot start with a digit
+	if variable == "" || (variable[0] >= '0' && variable[0] <= '9') {
+		variable = "BASTION_" + variable
+	}
+
+	return variable
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// yamlQuote writes a YAML double-quoted string, which JSON string syntax is a subset of.
+func yamlQuote(value string) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// instanceFilter is one condition on EC2 instances. 'instances find' combines them with AND.
+type instanceFilter struct {
+	name    string // EC2 filter name, e.g. "instance-state-name" or "tag:env"
+	pattern string // Value pattern with * and ? wildcards
+	negate  bool   // Match instances whose value does not match the pattern
+}
+
+// instanceFilterFlags are the repeatable filter flags of 'instances find'.
+type instanceFilterFlags struct {
+	tags       stringListFlag
+	states     stringListFlag
+	types      stringListFlag
+	zones      stringListFlag
+	vpcs       stringListFlag
+	subnets    stringListFlag
+	privateIPs stringListFlag
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (f *instanceFilterFlags) register(flagSet *flag.FlagSet) {
+	flagSet.Var(&f.tags, "tag", "--tag <key>[=<value pattern>]")
+	flagSet.Var(&f.states, "state", "--state <state>")
+	flagSet.Var(&f.types, "type", "--type <instance type pattern>")
+	flagSet.Var(&f.zones, "az", "--az <availability zone pattern>")
+	flagSet.Var(&f.vpcs, "vpc", "--vpc <vpc id>")
+	flagSet.Var(&f.subnets, "subnet", "--subnet <subnet id>")
+	flagSet.Var(&f.privateIPs, "private-ip", "--private-ip <private ip pattern>")
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// filters converts the flags to instance filters. Tags are given as key=pattern, key!=pattern,
+// or key alone for instances that have the tag at all.
+func (f *instanceFilterFlags) filters() ([]instanceFilter, error) {
+	var filters []instanceFilter
+
+	for _, tag := range f.tags {
+		key, pattern, hasValue := strings.Cut(tag, "=")
+		negate := hasValue && strings.HasSuffix(key, "!")
+		key = strings.TrimSuffix(key, "!")
+
+		if key == "" {
+			return nil, fmt.Errorf("invalid tag filter '%s', expected <key>=<value pattern>", tag)
+		}
+
+		if !hasValue {
+			pattern = "*"
+		}
+
+		filters = append(filters, instanceFilter{name: "tag:" + key, pattern: pattern, negate: negate})
+	}
+
+	attributes := []struct {
+		name   string
+		values stringListFlag
+	}{
+		{"instance-state-name", f.states},
+		{"instance-type", f.types},
+		{"availability-zone", f.zones},
+		{"vpc-id", f.vpcs},
+		{"subnet-id", f.subnets},
+		{"private-ip-address", f.privateIPs},
+	}
+
+	for _, attribute := range attributes {
+		for _, value := range attribute.values {
+			filters = append(filters, instanceFilter{name: attribute.name, pattern: value})
+		}
+	}
+
+	return filters, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// findEC2Instances returns the instances matching every filter. EC2 applies what it can: the
+// first condition on each attribute. Negated and repeated conditions are matched here, since EC2
+// combines the values of one filter with OR and has no negation.
+func findEC2Instances(profile string, region string, filters []instanceFilter) ([]EC2Instance, error) {
+	var serverFilters []string
+	var clientFilters []instanceFilter
+
+	serverNames := make(map[string]bool)
+
+	for _, filter := range filters {
+		// Values are separated by commas in the shorthand syntax
+		if filter.negate || serverNames[filter.name] || strings.Contains(filter.pattern, ",") {
+			clientFilters = append(clientFilters, filter)
+			continue
+		}
+
+		serverNames[filter.name] = true
+		serverFilters = append(serverFilters, fmt.Sprintf("Name=%s,Values=%s", filter.name, filter.pattern))
+	}
+
+	instances, err := describeEC2Instances(profile, region, serverFilters...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(clientFilters) == 0 {
+		return instances, nil
+	}
+
+	var matching []EC2Instance
+
+	for _, instance := range instances {
+		if instanceMatchesFilters(instance, clientFilters) {
+			matching = append(matching, instance)
+		}
+	}
+
+	return matching, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// instanceMatchesFilters reports whether an instance matches every filter.
+func instanceMatchesFilters(instance EC2Instance, filters []instanceFilter) bool {
+	for _, filter := range filters {
+		value, present := instanceFilterValue(instance, filter.name)
+		matches := present && wildcardMatch(filter.pattern, value)
+
+		if matches == filter.negate {
+			return false
+		}
+	}
+
+	return true
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// instanceFilterValue returns the value an EC2 filter name refers to, and whether the instance
+// has it.
+func instanceFilterValue(instance EC2Instance, name string) (string, bool) {
+	if key, isTag := strings.CutPrefix(name, "tag:"); isTag {
+		if key == "Name" {
+			return instance.Name, instance.Name != ""
+		}
+
+		value, present := instance.Tags[key]
+		return value, present
+	}
+
+	switch name {
+	case "instance-id":
+		return instance.Instance, true
+	case "instance-state-name":
+		return instance.State, true
+	case "instance-type":
+		return instance.InstanceType, true
+	case "availability-zone":
+		return instance.AZ, true
+	case "vpc-id":
+		return instance.VPC, true
+	case "subnet-id":
+		return instance.Subnet, true
+	case "private-ip-address":
+		return instance.Host, true
+	}
+
+	return "", false
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// wildcardMatch matches a value against a pattern with EC2's * and ? wildcards.
+func wildcardMatch(pattern string, value string) bool {
+	expression := regexp.QuoteMeta(pattern)
+	expression = strings.ReplaceAll(expression, `\*`, ".*")
+	expression = strings.ReplaceAll(expression, `\?`, ".")
+
+	matched, _ := regexp.MatchString("^"+expression+"$", value)
+	return matched
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+)
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// forwardCommand forwards a local port to a port on a configured instance, and manages the
+// forwards saved with instances.
+func forwardCommand(args []string, config *Configuration) error {
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "list", "ls":
+			return listForwards(args[1:], config)
+		case "add":
+			return addForward(args[1:], config)
+		case "remove", "rm":
+			return removeForward(args[1:], config)
+		}
+	}
+
+	return startForward(args, config)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// startForward runs a saved forward, or one given with --port, until Ctrl-C is pressed.
+func startForward(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("forward", flag.ContinueOnError)
+	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
+	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
+	instanceName := flagSet.String("instance", "", "--instance <instance name>")
+	instanceNameShort := flagSet.String("i", "", "--instance <instance name>")
+	port := flagSet.Int("port", 0, "--port <instance port>")
+	localPort := flagSet.Int("local-port", 0, "--local-port <local port>")
+	save := flagSet.String("save", "", "--save <forward name>")
+	reconnect := flagSet.Bool("reconnect", false, "--reconnect")
+
+	var portOptions localPortOptions
+	portOptions.register(flagSet)
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:")
+		fmt.Println("    awsdo forward [--profile <aws cli profile>] [--instance <instance name>] <forward name>")
+		fmt.Println("                    [--local-port <local port>] [--auto-port | --save-port] [--reconnect]")
+		fmt.Println("    awsdo forward [--profile <aws cli profile>] [--instance <instance name>] --port <instance port>")
+		fmt.Println("                    [--local-port <local port>] [--save <forward name>] [--auto-port] [--reconnect]")
+		fmt.Println("    awsdo forward list [--profile <aws cli profile>]")
+		fmt.Println("    awsdo forward add [--profile <aws cli profile>] [--instance <instance name>]")
+		fmt.Println("                    --port <instance port> [--local-port <local port>] <forward name>")
+		fmt.Println("    awsdo forward remove [--profile <aws cli profile>] [--instance <instance name>] <forward name>")
+	}
+
+	positional, err := parseFlags(flagSet, args)
+	if err != nil {
+		return nil
+	}
+
+	if len(positional) == 0 && *port == 0 {
+		flagSet.Usage()
+		return nil
+	}
+
+	if len(positional) > 0 && *port != 0 {
+		return fmt.Errorf("give either a forward name or --port, not both")
+	}
+
+	instance, instanceProfile, err := findForwardInstance(config, profile, profileShort, firstNonEmpty(*instanceName, *instanceNameShort))
+	if err != nil {
+		return err
+	}
+
+	if instance.ID == "" {
+		return fmt.Errorf("instance '%s' has no instance ID", instance.Name)
+	}
+
+	// A saved forward, or one given on the command line that may be saved under a name
+	var forward PortForward
+
+	if len(positional) > 0 {
+		saved, exists := instance.Forwards[positional[0]]
+		if !exists {
+			return fmt.Errorf("forward '%s' not found for instance '%s'", positional[0], instance.Name)
+		}
+
+		forward = saved
+	} else {
+		forward = PortForward{Name: *save, Port: *port}
+	}
+
+	if *localPort > 0 {
+		forward.LocalPort = *localPort
+	}
+
+	if forward.LocalPort == 0 {
+		if forward.LocalPort, err = suggestForwardLocalPort(forward.Port, config); err != nil {
+			return err
+		}
+	}
+
+	// Check the local port before logging in, rather than have the session fail to bind it
+	owner := fmt.Sprintf("instance '%s'", instance.Name)
+	if forward.Name != "" {
+		owner = fmt.Sprintf("forward '%s' of instance '%s'", forward.Name, instance.Name)
+	}
+
+	chosenPort, savePort, err := chooseLocalPort(forward.LocalPort, owner, portOptions, nil, config)
+	if err != nil {
+		return err
+	}
+
+	forward.LocalPort = chosenPort
+
+	// --save stores a new forward, --save-port only updates the port of a saved one
+	if *save != "" || (savePort && len(positional) > 0) {
+		if err := saveForward(config, instanceProfile, instance.Name, forward); err != nil {
+			return err
+		}
+
+		fmt.Printf("Saved forward '%s' of instance '%s': port %d -> local port %d\n", forward.Name, instance.Name, forward.Port, forward.LocalPort)
+	}
+
+	// The Session Manager plugin is only needed when it is configured as the session client
+	if sessionClientFor(config) == sessionClientPlugin {
+		pluginCheck := exec.Command("session-manager-plugin")
+
+		if err := pluginCheck.Run(); err != nil {
+			return fmt.Errorf("AWS Session Manager plugin is not installed. Please install it first, or use the built-in session client with 'awsdo backend --session-client builtin'")
+		}
+	}
+
+	// Ensure that we're logged in before running the command
+	if !isLoggedIn(instanceProfile) {
+		loginArgs := []string{}
+
+		if len(instanceProfile) != 0 {
+			loginArgs = append(loginArgs, "--profile", instanceProfile)
+		}
+
+		login(loginArgs, config)
+	}
+
+	var policy *ReconnectPolicy
+	if *reconnect {
+		policy = &ReconnectPolicy{Enabled: true}
+	}
+
+	// A tunnel without a remote host forwards to the port on the instance itself
+	tunnel := Bastion{
+		Name:      firstNonEmpty(forward.Name, instance.Name),
+		Profile:   instanceProfile,
+		Instance:  instance.ID,
+		Region:    instance.Region,
+		Port:      forward.Port,
+		LocalPort: forward.LocalPort,
+	}
+
+	// Set up signal handling to catch Ctrl-C
+	signalChan := make(chan os.Signal, 1)
+	setupSignalHandler(signalChan)
+	defer signal.Stop(signalChan)
+
+	return runTunnel(tunnel, instanceProfile, policy, "", signalChan, config)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// listForwards prints the saved forwards of every instance.
+func listForwards(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("forward list", flag.ContinueOnError)
+	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
+	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
+
+	var tableFlags tableOptions
+	tableFlags.register(flagSet)
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:\n    awsdo forward list [--profile <aws cli profile>] [--columns <column>[,<column> ...]]")
+		fmt.Println("                    [--sort-by [-]<column>] [--no-header] [--no-color]")
+	}
+
+	if _, err := parseFlags(flagSet, args); err != nil {
+		return nil
+	}
+
+	targetProfile := firstNonEmpty(*profile, *profileShort)
+	forwardTable := table{headers: []string{"Profile", "Instance", "Forward", "Port", "Local Port"}}
+
+	for _, profileName := range sortedProfileNames(config) {
+		if targetProfile != "" && profileName != targetProfile {
+			continue
+		}
+
+		instances := config.Profiles[profileName].Instances
+
+		for _, instanceName := range sortedKeys(instances) {
+			forwards := instances[instanceName].Forwards
+
+			for _, forwardName := range sortedKeys(forwards) {
+				forward := forwards[forwardName]
+
+				forwardTable.rows = append(forwardTable.rows, []string{
+					profileName,
+					instanceName,
+					forwardName,
+					strconv.Itoa(forward.Port),
+					strconv.Itoa(forward.LocalPort),
+				})
+			}
+		}
+	}
+
+	if len(forwardTable.rows) == 0 {
+		fmt.Println("\nNo forwards configured. Use 'awsdo forward add' to add one.")
+		fmt.Println()
+		return nil
+	}
+
+	fmt.Println()
+
+	if err := forwardTable.print(tableFlags); err != nil {
+		return err
+	}
+
+	fmt.Println()
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// addForward saves a forward with an instance, replacing a forward with the same name.
+func addForward(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("forward add", flag.ContinueOnError)
+	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
+	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
+	instanceName := flagSet.String("instance", "", "--instance <instance name>")
+	instanceNameShort := flagSet.String("i", "", "--instance <instance name>")
+	port := flagSet.Int("port", 0, "--port <instance port>")
+	localPort := flagSet.Int("local-port", 0, "--local-port <local port>")
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:")
+		fmt.Println("    awsdo forward add [--profile <aws cli profile>] [--instance <instance name>]")
+		fmt.Println("                    --port <instance port> [--local-port <local port>] <forward name>")
+	}
+
+	positional, err := parseFlags(flagSet, args)
+	if err != nil {
+		return nil
+	}
+
+	if len(positional) != 1 || *port <= 0 {
+		flagSet.Usage()
+		return nil
+	}
+
+	instance, instanceProfile, err := findForwardInstance(config, profile, profileShort, firstNonEmpty(*instanceName, *instanceNameShort))
+	if err != nil {
+		return err
+	}
+
+	forward := PortForward{Name: positional[0], Port: *port, LocalPort: *localPort}
+
+	if forward.LocalPort == 0 {
+		if forward.LocalPort, err = suggestForwardLocalPort(forward.Port, config); err != nil {
+			return err
+		}
+	}
+
+	if err := saveForward(config, instanceProfile, instance.Name, forward); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nSaved forward '%s' of instance '%s': port %d -> local port %d\n\n", forward.Name, instance.Name, forward.Port, forward.LocalPort)
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// removeForward removes a saved forward from an instance.
+func removeForward(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("forward remove", flag.ContinueOnError)
+	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
+	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
+	instanceName := flagSet.String("instance", "", "--instance <instance name>")
+	instanceNameShort := flagSet.String("i", "", "--instance <instance name>")
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:\n    awsdo forward remove [--profile <aws cli profile>] [--instance <instance name>] <forward name>")
+	}
+
+	positional, err := parseFlags(flagSet, args)
+	if err != nil {
+		return nil
+	}
+
+	if len(positional) != 1 {
+		flagSet.Usage()
+		return nil
+	}
+
+	instance, instanceProfile, err := findForwardInstance(config, profile, profileShort, firstNonEmpty(*instanceName, *instanceNameShort))
+	if err != nil {
+		return err
+	}
+
+	if _, exists := instance.Forwards[positional[0]]; !exists {
+		return fmt.Errorf("forward '%s' not found for instance '%s'", positional[0], instance.Name)
+	}
+
+	delete(instance.Forwards, positional[0])
+	config.Profiles[instanceProfile].Instances[instance.Name] = instance
+
+	fmt.Printf("\nRemoved forward '%s' of instance '%s'\n\n", positional[0], instance.Name)
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// findForwardInstance finds a configured instance by name, or the default instance when no name
+// is given. Without a profile, the default profile is searched first and then all profiles.
+func findForwardInstance(config *Configuration, profile *string, profileShort *string, name string) (Instance, string, error) {
+	if *profile != "" || *profileShort != "" || name == "" {
+		currentProfile, err := ensureProfile(config, profile, profileShort)
+		if err != nil {
+			return Instance{}, "", err
+		}
+
+		instance, err := selectInstanceByName(config.Profiles[currentProfile], name)
+		if err != nil {
+			return Instance{}, "", fmt.Errorf("%v in profile '%s'", err, currentProfile)
+		}
+
+		return instance, currentProfile, nil
+	}
+
+	profileNames := sortedProfileNames(config)
+
+	if config.DefaultProfile != "" {
+		profileNames = append([]string{config.DefaultProfile}, profileNames...)
+	}
+
+	for _, profileName := range profileNames {
+		if instance, exists := config.Profiles[profileName].Instances[name]; exists {
+			return instance, profileName, nil
+		}
+	}
+
+	return Instance{}, "", fmt.Errorf("instance '%s' not found in any profile", name)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// saveForward stores a forward with an instance of a profile.
+func saveForward(config *Configuration, profileName string, instanceName string, forward PortForward) error {
+	instance, exists := config.Profiles[profileName].Instances[instanceName]
+	if !exists {
+		return fmt.Errorf("instance '%s' not found in profile '%s'", instanceName, profileName)
+	}
+
+	if instance.Forwards == nil {
+		instance.Forwards = make(map[string]PortForward)
+	}
+
+	instance.Forwards[forward.Name] = forward
+	config.Profiles[profileName].Instances[instanceName] = instance
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// suggestForwardLocalPort picks a local port for a forward: the instance port itself when it is
+// unprivileged and free, and otherwise a free port from 7000 up. Ports saved for bastions and
+// other forwards are skipped.
+func suggestForwardLocalPort(port int, config *Configuration) (int, error) {
+	reserved := configuredLocalPorts(config)
+
+	if port >= 1024 && !reserved[port] && isLocalPortAvailable(port) {
+		return port, nil
+	}
+
+	return nextFreeLocalPort(7000, reserved)
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+)
+
+// tunnelGroupExit reports that a group member's tunnel process has ended.
+type tunnelGroupExit struct {
+	label string
+	err   error
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// tunnelGroupCommand lists, adds and removes tunnel groups.
+func tunnelGroupCommand(args []string, config *Configuration) error {
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "list", "ls":
+			return listTunnelGroups(args[1:], config)
+		case "add":
+			return addTunnelGroup(args[1:], config)
+		case "remove", "rm":
+			return removeTunnelGroup(args[1:], config)
+		default:
+			return fmt.Errorf("invalid group subcommand: %s", args[0])
+		}
+	}
+
+	return listTunnelGroups(args, config)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// listTunnelGroups prints the cross-profile groups and the groups of every profile.
+func listTunnelGroups(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("bastions group list", flag.ContinueOnError)
+
+	var tableFlags tableOptions
+	tableFlags.register(flagSet)
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:\n    awsdo bastions group [list] [--columns <column>[,<column> ...]] [--sort-by [-]<column>]")
+		fmt.Println("                    [--no-header] [--no-color]")
+	}
+
+	if _, err := parseFlags(flagSet, args); err != nil {
+		return nil
+	}
+
+	// Cross-profile groups come first, without a profile
+	groupTable := table{headers: []string{"Group", "Profile", "Bastions"}}
+
+	addGroups := func(profileName string, groups map[string]TunnelGroup) {
+		for _, name := range sortedKeys(groups) {
+			groupTable.rows = append(groupTable.rows, []string{name, firstNonEmpty(profileName, "(any)"), strings.Join(groups[name].Bastions, ", ")})
+		}
+	}
+
+	addGroups("", config.TunnelGroups)
+
+	for _, profileName := range sortedProfileNames(config) {
+		addGroups(profileName, config.Profiles[profileName].TunnelGroups)
+	}
+
+	if len(groupTable.rows) == 0 {
+		fmt.Println("\nNo tunnel groups configured. Use 'awsdo bastions group add' to add one.")
+		fmt.Println()
+		return nil
+	}
+
+	fmt.Println()
+
+	if err := groupTable.print(tableFlags); err != nil {
+		return err
+	}
+
+	fmt.Println()
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// addTunnelGroup saves a group of bastions, replacing a group with the same name. With a profile
+// the group belongs to that profile, otherwise it may hold bastions from any profile.
+func addTunnelGroup(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("bastions group add", flag.ContinueOnError)
+	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
+	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:\n    awsdo bastions group add [--profile <aws cli profile>] <group name> <bastion> [<bastion> ...]")
+	}
+
+	positional, err := parseFlags(flagSet, args)
+	if err != nil {
+		return nil
+	}
+
+	if len(positional) < 2 {
+		flagSet.Usage()
+		return nil
+	}
+
+	group := TunnelGroup{Name: positional[0], Bastions: positional[1:]}
+
+	groupProfile := ""
+	if *profile != "" || *profileShort != "" {
+		if groupProfile, err = ensureProfile(config, profile, profileShort); err != nil {
+			return err
+		}
+	}
+
+	// Check the references now rather than when the group is started
+	if _, err := resolveTunnelGroupBastions(config, groupProfile, group); err != nil {
+		return err
+	}
+
+	if groupProfile == "" {
+		if config.TunnelGroups == nil {
+			config.TunnelGroups = make(map[string]TunnelGroup)
+		}
+
+		config.TunnelGroups[group.Name] = group
+		fmt.Printf("\nSaved tunnel group '%s': %s\n\n", group.Name, strings.Join(group.Bastions, ", "))
+
+		return nil
+	}
+
+	profileInfo := config.Profiles[groupProfile]
+
+	if profileInfo.TunnelGroups == nil {
+		profileInfo.TunnelGroups = make(map[string]TunnelGroup)
+	}
+
+	profileInfo.TunnelGroups[group.Name] = group
+	config.Profiles[groupProfile] = profileInfo
+
+	fmt.Printf("\nSaved tunnel group '%s' for profile %s: %s\n\n", group.Name, groupProfile, strings.Join(group.Bastions, ", "))
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// removeTunnelGroup deletes a group. The bastions in it are not changed.
+func removeTunnelGroup(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("bastions group remove", flag.ContinueOnError)
+	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
+	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:\n    awsdo bastions group remove [--profile <aws cli profile>] <group name>")
+	}
+
+	positional, err := parseFlags(flagSet, args)
+	if err != nil {
+		return nil
+	}
+
+	if len(positional) != 1 {
+		flagSet.Usage()
+		return nil
+	}
+
+	group, groupProfile, err := findTunnelGroup(config, profile, profileShort, positional[0])
+	if err != nil {
+		return err
+	}
+
+	if groupProfile == "" {
+		delete(config.TunnelGroups, group.Name)
+		fmt.Printf("\nRemoved tunnel group '%s'.\n\n", group.Name)
+
+		return nil
+	}
+
+	delete(config.Profiles[groupProfile].TunnelGroups, group.Name)
+	fmt.Printf("\nRemoved tunnel group '%s' from profile %s.\n\n", group.Name, groupProfile)
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// findTunnelGroup finds a group by name and returns it with the profile it belongs to, which is
+// empty for cross-profile groups. The given or default profile's groups are searched first, then
+// the cross-profile groups and, without a profile, the groups of all other profiles.
+func findTunnelGroup(config *Configuration, profile *string, profileShort *string, name string) (TunnelGroup, string, error) {
+	currentProfile := config.DefaultProfile
+	profileGiven := *profile != "" || *profileShort != ""
+
+	if profileGiven {
+		var err error
+
+		if currentProfile, err = ensureProfile(config, profile, profileShort); err != nil {
+			return TunnelGroup{}, "", err
+		}
+	}
+
+	if group, exists := config.Profiles[currentProfile].TunnelGroups[name]; exists {
+		return group, currentProfile, nil
+	}
+
+	if group, exists := config.TunnelGroups[name]; exists {
+		return group, "", nil
+	}
+
+	if !profileGiven {
+		for _, profileName := range sortedProfileNames(config) {
+			if group, exists := config.Profiles[profileName].TunnelGroups[name]; exists {
+				return group, profileName, nil
+			}
+		}
+	}
+
+	return TunnelGroup{}, "", fmt.Errorf("tunnel group '%s' not found", name)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// resolveTunnelGroup finds a group and the bastions it references.
+func resolveTunnelGroup(config *Configuration, profile *string, profileShort *string, name string) ([]Bastion, error) {
+	group, groupProfile, err := findTunnelGroup(config, profile, profileShort, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveTunnelGroupBastions(config, groupProfile, group)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// resolveTunnelGroupBastions looks up the bastions in a group. Two of them cannot share a local
+// port, since their tunnels run at the same time.
+func resolveTunnelGroupBastions(config *Configuration, groupProfile string, group TunnelGroup) ([]Bastion, error) {
+	if len(group.Bastions) == 0 {
+		return nil, fmt.Errorf("tunnel group '%s' has no bastions", group.Name)
+	}
+
+	var bastions []Bastion
+	localPorts := make(map[int]string)
+
+	for _, reference := range group.Bastions {
+		bastion, err := resolveTunnelGroupBastion(config, groupProfile, reference)
+		if err != nil {
+			return nil, fmt.Errorf("tunnel group '%s': %v", group.Name, err)
+		}
+
+		if bastion.Instance == "" && bastion.InstanceResolver == nil {
+			return nil, fmt.Errorf("tunnel group '%s': bastion '%s' has no instance", group.Name, reference)
+		}
+
+		if other, exists := localPorts[bastion.LocalPort]; exists && bastion.LocalPort != 0 {
+			return nil, fmt.Errorf("tunnel group '%s': bastions '%s' and '%s' both use local port %d", group.Name, other, reference, bastion.LocalPort)
+		}
+
+		localPorts[bastion.LocalPort] = reference
+		bastions = append(bastions, bastion)
+	}
+
+	return bastions, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// resolveTunnelGroupBastion finds a bastion by ID, by <profile>/<name>, or by name in the group's
+// profile. Names in cross-profile groups are looked up like 'awsdo bastion <name>'.
+func resolveTunnelGroupBastion(config *Configuration, groupProfile string, reference string) (Bastion, error) {
+	if lookup, exists := config.BastionLookup[reference]; exists {
+		if bastion, exists := config.Profiles[lookup.Profile].Bastions[lookup.Name]; exists {
+			return bastion, nil
+		}
+	}
+
+	profileName, name, qualified := strings.Cut(reference, "/")
+	if !qualified {
+		profileName, name = groupProfile, reference
+	}
+
+	if profileName == "" {
+		noProfile := ""
+		bastion, _, err := resolveBastion(config, &noProfile, &noProfile, name)
+
+		return bastion, err
+	}
+
+	bastion, exists := config.Profiles[profileName].Bastions[name]
+	if !exists {
+		return Bastion{}, fmt.Errorf("bastion '%s' not found in profile '%s'", name, profileName)
+	}
+
+	return bastion, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// loginBastionProfiles logs in to each profile used by the bastions that does not have a valid
+// session, since tunnels running in child processes cannot prompt.
+func loginBastionProfiles(bastions []Bastion, config *Configuration) {
+	checkedProfiles := make(map[string]bool)
+
+	for _, bastion := range bastions {
+		if checkedProfiles[bastion.Profile] {
+			continue
+		}
+
+		checkedProfiles[bastion.Profile] = true
+
+		if !isLoggedIn(bastion.Profile) {
+			login([]string{"--profile", bastion.Profile}, config)
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// runTunnelGroup runs the tunnels of a group side by side until Ctrl-C is pressed. Each tunnel
+// runs in a child process, like background tunnels do, and its output is prefixed with its name.
+func runTunnelGroup(groupName string, bastions []Bastion, options backgroundTunnelOptions, config *Configuration) error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	loginBastionProfiles(bastions, config)
+
+	// Names are qualified with their profile when the group spans profiles
+	labels := make([]string, len(bastions))
+	width := 0
+
+	for i, bastion := range bastions {
+		labels[i] = bastion.Name
+
+		if bastion.Profile != bastions[0].Profile {
+			for j := range bastions {
+				labels[j] = bastions[j].Profile + "/" + bastions[j].Name
+			}
+
+			break
+		}
+	}
+
+	for _, label := range labels {
+		width = max(width, len(label)+2)
+	}
+
+	// Set up signal handling before the children start, so Ctrl-C cannot slip through
+	signalChan := make(chan os.Signal, 1)
+	setupSignalHandler(signalChan)
+	defer signal.Stop(signalChan)
+
+	var outputMutex sync.Mutex
+	var processes []*processTree
+
+	exited := make(chan tunnelGroupExit, len(bastions))
+
+	fmt.Printf("\nStarting tunnel group '%s' with %d bastions...\n", groupName, len(bastions))
+	fmt.Println("Press Ctrl-C to stop all tunnels in the group.")
+	fmt.Println()
+
+	for i, bastion := range bastions {
+		label := fmt.Sprintf("%-*s", width, "["+labels[i]+"]")
+
+		reader, writer := io.Pipe()
+
+		command := exec.Command(exePath, tunnelCommandArgs(bastion.Profile, bastion.Name, bastion.LocalPort, bastion.Region, options)...)
+		command.Stdout = writer
+		command.Stderr = writer
+
+		process, err := startProcessTree(command)
+		if err != nil {
+			for _, process := range processes {
+				process.stop()
+			}
+
+			return fmt.Errorf("failed to start bastion '%s': %v", bastion.Name, err)
+		}
+
+		processes = append(processes, process)
+
+		outputDone := make(chan struct{})
+
+		go func() {
+			defer close(outputDone)
+
+			scanner := bufio.NewScanner(reader)
+
+			for scanner.Scan() {
+				line := strings.TrimRight(scanner.Text(), " \r")
+
+				if line == "" {
+					continue
+				}
+
+				outputMutex.Lock()
+				fmt.Printf("%s %s\n", label, line)
+				outputMutex.Unlock()
+			}
+		}()
+
+		go func() {
+			err := command.Wait()
+			process.release()
+			writer.Close()
+			<-outputDone
+
+			exited <- tunnelGroupExit{label: labels[i], err: err}
+		}()
+	}
+
+	stopping := false
+
+	for running := len(processes); running > 0; {
+		select {
+		case <-signalChan:
+			if !stopping {
+				stopping = true
+				fmt.Printf("\nStopping tunnel group '%s'...\n", groupName)
+
+				for _, process := range processes {
+					process.stop()
+				}
+			}
+		case result := <-exited:
+			running--
+
+			if stopping {
+				continue
+			}
+
+			outputMutex.Lock()
+			if result.err != nil {
+				fmt.Printf("\nBastion '%s' stopped: %v. %d of %d tunnels still running.\n\n", result.label, result.err, running, len(processes))
+			} else {
+				fmt.Printf("\nBastion '%s' stopped. %d of %d tunnels still running.\n\n", result.label, running, len(processes))
+			}
+			outputMutex.Unlock()
+		}
+	}
+
+	if !stopping {
+		return fmt.Errorf("all tunnels in group '%s' have stopped", groupName)
+	}
+
+	return nil
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"time"
 )
 
@@ -26,12 +28,18 @@ var helpInstances string
 //go:embed help/terminal.txt
 var helpTerminal string
 
+//go:embed help/forward.txt
+var helpForward string
+
 //go:embed help/bastion.txt
 var helpBastion string
 
 //go:embed help/bastions.txt
 var helpBastions string
 
+//go:embed help/backend.txt
+var helpBackend string
+
 //go:embed help/help.txt
 var helpHelp string
 
@@ -71,16 +79,16 @@ func showDocs() {
 		}
 	})
 
-	// Start server on localhost
+	// Start server on the listen address
 	port, err := findAvailableLocalPort(8080)
 	if err != nil {
 		fmt.Printf("Error finding available local port: %v\n", err)
 		os.Exit(1)
 	}
 
-	url := fmt.Sprintf("http://localhost:%d", port)
+	url := "http://" + net.JoinHostPort(localHost(), strconv.Itoa(port))
 
-	fmt.Printf("Starting documentation server on http://localhost:%d...\n", port)
+	fmt.Printf("Starting documentation server on %s...\n", url)
 	fmt.Println("Press Ctrl+C to stop the documentation server.")
 
 	// Set up signal handling for graceful shutdown
@@ -91,7 +99,7 @@ func showDocs() {
 	go openBrowser(url)
 
 	// Start HTTP server in a goroutine
-	server := &http.Server{Addr: fmt.Sprintf(":%d", port)}
+	server := &http.Server{Addr: localAddress(port)}
 	go func() {
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			fmt.Printf("Error starting documentation server: %v\n", err)
@@ -149,7 +157,9 @@ func showHelp(command string) {
 		fmt.Print(helpInstances)
 	case "terminal":
 		fmt.Print(helpTerminal)
-	case "bastion":
+	case "forward":
+		fmt.Print(helpForward)
+	case "bastion", "db":
 		fmt.Print(helpBastion)
 	case "bastions":
 		fmt.Print(helpBastions)
@@ -157,6 +167,8 @@ func showHelp(command string) {
 		fmt.Print(helpBastions)
 	case "bastions add":
 		fmt.Print(helpBastions)
+	case "backend":
+		fmt.Print(helpBackend)
 	case "docs":
 		fmt.Print(helpDocs)
 	case "repl":
@@ -48,8 +48,14 @@ func initCommand(config *Configuration) error {
 
 	fmt.Println()
 
+	// The native backend talks to AWS directly, so the AWS CLI is optional
+	if !awsCLIInstalled && config.Backend == backendNative {
+		fmt.Println("Skipping AWS CLI installation because the native backend is selected.")
+		fmt.Println()
+	}
+
 	// Install AWS CLI if needed
-	if !awsCLIInstalled {
+	if !awsCLIInstalled && config.Backend != backendNative {
 		fmt.Println("Installing AWS CLI...")
 
 		if err := installAWSCLI(); err != nil {
@@ -60,8 +66,14 @@ func initCommand(config *Configuration) error {
 		fmt.Println()
 	}
 
+	// The built-in session client replaces the SSM plugin
+	if !ssmPluginInstalled && sessionClientFor(config) == sessionClientBuiltin {
+		fmt.Println("Skipping SSM Plugin installation because the built-in session client is selected.")
+		fmt.Println()
+	}
+
 	// Install SSM plugin if needed
-	if !ssmPluginInstalled {
+	if !ssmPluginInstalled && sessionClientFor(config) == sessionClientPlugin {
 		fmt.Println("Installing SSM Plugin...")
 
 		if err := installSSMPlugin(); err != nil {
@@ -707,12 +719,7 @@ func setupProfile(config *Configuration) error {
 	fmt.Println("You will be prompted to log in to AWS SSO.")
 	fmt.Println()
 
-	testCmd := exec.Command("aws", "sso", "login", "--profile", profileName)
-	testCmd.Stdout = os.Stdout
-	testCmd.Stderr = os.Stderr
-	testCmd.Stdin = os.Stdin
-
-	if err := testCmd.Run(); err != nil {
+	if err := awsRunner.Run(profileName, "sso", "login"); err != nil {
 		fmt.Println()
 		fmt.Printf("Login test failed, but profile has been configured. You can try logging in later with: awsdo login -p %s\n", profileName)
 		return nil
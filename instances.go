@@ -2,11 +2,9 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
-	"os/exec"
 	"sort"
 	"strconv"
 	"strings"
@@ -34,6 +32,35 @@ func formatLaunchTime(launchTimeStr string) string {
 	return t.Format("2006-01-02 15:04")
 }
 
+// ec2InstanceHeaders are the columns of the tables of EC2 instances, see ec2InstanceRow.
+var ec2InstanceHeaders = []string{"Name", "Instance ID", "Host", "State", "Type", "Public IP", "Launch Time"}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// ec2InstanceRow returns the values of an EC2 instance for the columns of ec2InstanceHeaders.
+func ec2InstanceRow(inst EC2Instance) []string {
+	return []string{
+		firstNonEmpty(inst.Name, "(no name)"),
+		inst.Instance,
+		firstNonEmpty(inst.Host, "(no host)"),
+		firstNonEmpty(inst.State, "(unknown)"),
+		firstNonEmpty(inst.InstanceType, "(unknown)"),
+		firstNonEmpty(inst.PublicIP, "(none)"),
+		formatLaunchTime(inst.LaunchTime),
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// printInstanceChoices prints numbered EC2 instances to select from.
+func printInstanceChoices(instances []EC2Instance) {
+	choices := table{headers: append([]string{"#"}, ec2InstanceHeaders...)}
+
+	for i, inst := range instances {
+		choices.rows = append(choices.rows, append([]string{strconv.Itoa(i + 1)}, ec2InstanceRow(inst)...))
+	}
+
+	choices.print(tableOptions{})
+}
+
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
 func findInstances(args []string, config *Configuration) error {
 	flagSet := flag.NewFlagSet("instances find", flag.ContinueOnError)
@@ -42,20 +69,59 @@ func findInstances(args []string, config *Configuration) error {
 	filterFlag := flagSet.String("filter", "", "--filter <filter text>")
 	filterShort := flagSet.String("f", "", "--filter <filter text>")
 
+	var filterFlags instanceFilterFlags
+	filterFlags.register(flagSet)
+
+	var regions regionFlags
+	regions.register(flagSet)
+
+	var profileSet profileSetFlags
+	profileSet.register(flagSet)
+
+	var tableFlags tableOptions
+	tableFlags.register(flagSet)
+
 	flagSet.Usage = func() {
 		fmt.Println("USAGE:\n    awsdo instances find [--profile <aws cli profile>] [--filter <filter text>]")
+		fmt.Println("                    [--tag <key>[=<value pattern>] ...] [--state <state> ...]")
+		fmt.Println("                    [--type <type pattern> ...] [--az <zone pattern> ...]")
+		fmt.Println("                    [--vpc <vpc id> ...] [--subnet <subnet id> ...]")
+		fmt.Println("                    [--private-ip <ip pattern> ...]")
+		fmt.Println("                    [--region <region> ... | --all-regions]")
+		fmt.Println("                    [--profiles <profile>[,<profile> ...] | --profile-group <group> | --all-profiles]")
+		fmt.Println("                    [--columns <column>[,<column> ...]] [--sort-by [-]<column>]")
+		fmt.Println("                    [--no-header] [--no-color]")
 	}
 
 	if err := flagSet.Parse(args); err != nil {
 		return nil
 	}
 
+	filters, err := filterFlags.filters()
+	if err != nil {
+		return err
+	}
+
+	// The profile and region are shown when several may have been searched
+	headers := append([]string(nil), ec2InstanceHeaders...)
+	if profileSet.given() {
+		headers = append([]string{"Profile"}, headers...)
+	}
+
+	if regions.given() {
+		headers = append(headers, "Region")
+	}
+
+	if err := tableFlags.validate(headers); err != nil {
+		return err
+	}
+
 	var filter string
 	if *filterFlag != "" {
 		filter = *filterFlag
 	} else if *filterShort != "" {
 		filter = *filterShort
-	} else {
+	} else if len(filters) == 0 {
 		// Prompt user for filter text
 		reader := bufio.NewReader(os.Stdin)
 		fmt.Print("Enter filter text: ")
@@ -67,100 +133,72 @@ func findInstances(args []string, config *Configuration) error {
 		}
 	}
 
-	currentProfile, err := ensureProfile(config, profile, profileShort)
-	if err != nil {
-		return err
-	}
-
-	commandArgs := []string{
-		"ec2",
-		"describe-instances",
-		"--query",
-		"Reservations[*].Instances[*].{Instance:InstanceId,AZ:Placement.AvailabilityZone,Name:Tags[?Key=='Name']|[0].Value,Host:PrivateIpAddress,State:State.Name,Type:InstanceType,PublicIP:PublicIpAddress,LaunchTime:LaunchTime}",
-		"--filters",
-		fmt.Sprintf("Name=tag:Name,Values=*%s*", filter),
-		"--output=json",
+	// The filter text matches part of the Name tag, like the other conditions it is combined with
+	if filter != "" {
+		filters = append([]instanceFilter{{name: "tag:Name", pattern: "*" + filter + "*"}}, filters...)
 	}
 
-	commandArgs = append(commandArgs, "--profile", currentProfile)
-
-	fmt.Printf("\nInstances (%s)\n", currentProfile)
-
-	// Ensure that we're logged in before running the command.
-	if !isLoggedIn(currentProfile) {
-		args := []string{}
-		args = append(args, "--profile", currentProfile)
+	var instances []EC2Instance
 
-		login(args, config)
-	}
+	if profileSet.given() {
+		if firstNonEmpty(*profile, *profileShort) != "" {
+			return fmt.Errorf("--profile cannot be combined with --profiles, --profile-group or --all-profiles")
+		}
 
-	command := exec.Command("aws", commandArgs...)
-	outputStream, err := command.StdoutPipe()
-	if err != nil {
-		return err
-	}
+		profiles, err := profileSet.list(config)
+		if err != nil {
+			return err
+		}
 
-	errorStream, err := command.StderrPipe()
-	if err != nil {
-		return err
-	}
+		if !machineOutput() {
+			fmt.Printf("\nInstances (%s)\n", strings.Join(profiles, ", "))
+		}
 
-	go func() {
-		scanner := bufio.NewScanner(errorStream)
-		scanner.Split(bufio.ScanLines)
+		loginProfiles(profiles, config)
 
-		for scanner.Scan() {
-			fmt.Println(scanner.Text())
+		if instances, err = findEC2InstancesInProfiles(profiles, regions, filters); err != nil {
+			return err
+		}
+	} else {
+		currentProfile, err := ensureProfile(config, profile, profileShort)
+		if err != nil {
+			return err
 		}
-	}()
 
-	err = command.Start()
-	if err != nil {
-		return err
-	}
+		if !machineOutput() {
+			fmt.Printf("\nInstances (%s)\n", currentProfile)
+		}
 
-	scanner := bufio.NewScanner(outputStream)
-	scanner.Split(bufio.ScanLines)
-	outputDoc := strings.Builder{}
+		// Ensure that we're logged in before running the command.
+		if !isLoggedIn(currentProfile) {
+			args := []string{}
+			args = append(args, "--profile", currentProfile)
 
-	for scanner.Scan() {
-		outputDoc.WriteString(strings.Trim(scanner.Text(), " "))
-	}
+			login(args, config)
+		}
 
-	command.Wait()
-	output := outputDoc.String()
+		searchRegions, err := regions.list(currentProfile)
+		if err != nil {
+			return err
+		}
 
-	/* Output is an array of an array of instance documents like below.
-	[
-		[
-			{
-				"Instance": "i-0001",
-				"AZ": "us-east-1a",
-				"Name": "my-instance-1"
-			}
-		],
-		[
-			{
-				"Instance": "i-0002",
-				"AZ": "us-east-1a",
-				"Name": "my-instance-2"
-			}
-		]
-	]
-	*/
+		if instances, err = findEC2InstancesInRegions(currentProfile, searchRegions, filters); err != nil {
+			return err
+		}
 
-	if len(output) == 0 {
-		fmt.Println("AWS command failed to return data")
+		for i := range instances {
+			instances[i].Profile = currentProfile
+		}
 	}
 
-	var instanceList [][]map[string]string
+	// Set the default instance if there is only one instance in the query results
+	if len(instances) == 1 {
+		currentProfile := instances[0].Profile
 
-	if err := json.Unmarshal([]byte(output), &instanceList); err != nil {
-		return err
-	}
+		if config.Profiles == nil {
+			config.Profiles = make(map[string]Profile)
+		}
 
-	// Set the default instance if there is only one instance in the query results
-	if len(instanceList) == 1 {
 		profileInfo := config.Profiles[currentProfile]
 		profileInfo.Name = currentProfile
 
@@ -170,205 +208,52 @@ func findInstances(args []string, config *Configuration) error {
 		}
 
 		// Create a "default" entry in Instances map
-		instanceID := instanceList[0][0]["Instance"]
-		instanceName := instanceList[0][0]["Name"]
-		if instanceName == "" {
-			instanceName = "default"
-		}
+		instanceID := instances[0].Instance
 
 		// Get host (private IP) from the query result
-		host := instanceList[0][0]["Host"]
+		host := instances[0].Host
 		if host == "" {
 			host = instanceID // Fallback to instance ID if no private IP available
 		}
 
+		// The forwards saved with the default instance are kept for the instance replacing it
 		profileInfo.Instances["default"] = Instance{
-			Name:    "default",
-			ID:      instanceID,
-			Profile: currentProfile,
-			Host:    host,
+			Name:     "default",
+			ID:       instanceID,
+			Profile:  currentProfile,
+			Host:     host,
+			Region:   instances[0].Region,
+			Forwards: profileInfo.Instances["default"].Forwards,
 		}
 
 		config.Profiles[currentProfile] = profileInfo
 	}
 
-	// Format instances as a table
-	if len(instanceList) > 0 {
-		// Calculate maximum column widths
-		maxNameWidth := len("Name")
-		maxInstanceWidth := len("Instance ID")
-		maxHostWidth := len("Host")
-		maxStateWidth := len("State")
-		maxTypeWidth := len("Type")
-		maxPublicIPWidth := len("Public IP")
-		maxLaunchTimeWidth := len("Launch Time")
-
-		for i := range len(instanceList) {
-			name := instanceList[i][0]["Name"]
-
-			if name == "" {
-				name = "(no name)"
-			}
-
-			if len(name) > maxNameWidth {
-				maxNameWidth = len(name)
-			}
-
-			instanceID := instanceList[i][0]["Instance"]
-
-			if len(instanceID) > maxInstanceWidth {
-				maxInstanceWidth = len(instanceID)
-			}
-
-			host := instanceList[i][0]["Host"]
-
-			if host == "" {
-				host = "(no host)"
-			}
-
-			if len(host) > maxHostWidth {
-				maxHostWidth = len(host)
-			}
-
-			state := instanceList[i][0]["State"]
-
-			if state == "" {
-				state = "(unknown)"
-			}
-
-			if len(state) > maxStateWidth {
-				maxStateWidth = len(state)
-			}
-
-			instanceType := instanceList[i][0]["Type"]
-
-			if instanceType == "" {
-				instanceType = "(unknown)"
-			}
-
-			if len(instanceType) > maxTypeWidth {
-				maxTypeWidth = len(instanceType)
-			}
-
-			publicIP := instanceList[i][0]["PublicIP"]
-
-			if publicIP == "" {
-				publicIP = "(none)"
-			}
+	if machineOutput() {
+		return writeRecords(instances, func(instance EC2Instance) string { return instance.Instance })
+	}
 
-			if len(publicIP) > maxPublicIPWidth {
-				maxPublicIPWidth = len(publicIP)
-			}
+	// Format instances as a table
+	if len(instances) > 0 {
+		instanceTable := table{headers: headers}
 
-			launchTime := formatLaunchTime(instanceList[i][0]["LaunchTime"])
+		for _, inst := range instances {
+			row := ec2InstanceRow(inst)
 
-			if len(launchTime) > maxLaunchTimeWidth {
-				maxLaunchTimeWidth = len(launchTime)
+			if profileSet.given() {
+				row = append([]string{inst.Profile}, row...)
 			}
-		}
 
-		// Add 2 characters padding for readability
-		const padding = 2
-		colNameWidth := maxNameWidth + padding
-		colInstanceWidth := maxInstanceWidth + padding
-		colHostWidth := maxHostWidth + padding
-		colStateWidth := maxStateWidth + padding
-		colTypeWidth := maxTypeWidth + padding
-		colPublicIPWidth := maxPublicIPWidth + padding
-		colLaunchTimeWidth := maxLaunchTimeWidth + padding
-
-		// Helper function to truncate string to width
-		truncate := func(s string, width int) string {
-			if len(s) > width {
-				return s[:width-3] + "..."
+			if regions.given() {
+				row = append(row, inst.Region)
 			}
 
-			return s + strings.Repeat(" ", width-len(s))
+			instanceTable.rows = append(instanceTable.rows, row)
 		}
 
-		// ANSI escape codes for bold
-		bold := "\033[1m"
-		reset := "\033[0m"
-
-		// Print top border
-		fmt.Printf("┌%s┬%s┬%s┬%s┬%s┬%s┬%s┐\n",
-			strings.Repeat("─", colNameWidth),
-			strings.Repeat("─", colInstanceWidth),
-			strings.Repeat("─", colHostWidth),
-			strings.Repeat("─", colStateWidth),
-			strings.Repeat("─", colTypeWidth),
-			strings.Repeat("─", colPublicIPWidth),
-			strings.Repeat("─", colLaunchTimeWidth))
-
-		// Print header row
-		fmt.Printf("│%s%s%s│%s%s%s│%s%s%s│%s%s%s│%s%s%s│%s%s%s│%s%s%s│\n",
-			bold, truncate("Name", colNameWidth), reset,
-			bold, truncate("Instance ID", colInstanceWidth), reset,
-			bold, truncate("Host", colHostWidth), reset,
-			bold, truncate("State", colStateWidth), reset,
-			bold, truncate("Type", colTypeWidth), reset,
-			bold, truncate("Public IP", colPublicIPWidth), reset,
-			bold, truncate("Launch Time", colLaunchTimeWidth), reset)
-
-		// Print separator between header and data
-		fmt.Printf("├%s┼%s┼%s┼%s┼%s┼%s┼%s┤\n",
-			strings.Repeat("─", colNameWidth),
-			strings.Repeat("─", colInstanceWidth),
-			strings.Repeat("─", colHostWidth),
-			strings.Repeat("─", colStateWidth),
-			strings.Repeat("─", colTypeWidth),
-			strings.Repeat("─", colPublicIPWidth),
-			strings.Repeat("─", colLaunchTimeWidth))
-
-		// Print data rows
-		for i := range len(instanceList) {
-			name := instanceList[i][0]["Name"]
-			if name == "" {
-				name = "(no name)"
-			}
-
-			instanceID := instanceList[i][0]["Instance"]
-			host := instanceList[i][0]["Host"]
-			if host == "" {
-				host = "(no host)"
-			}
-
-			state := instanceList[i][0]["State"]
-			if state == "" {
-				state = "(unknown)"
-			}
-
-			instanceType := instanceList[i][0]["Type"]
-			if instanceType == "" {
-				instanceType = "(unknown)"
-			}
-
-			publicIP := instanceList[i][0]["PublicIP"]
-			if publicIP == "" {
-				publicIP = "(none)"
-			}
-
-			launchTime := formatLaunchTime(instanceList[i][0]["LaunchTime"])
-
-			fmt.Printf("│%s│%s│%s│%s│%s│%s│%s│\n",
-				truncate(name, colNameWidth),
-				truncate(instanceID, colInstanceWidth),
-				truncate(host, colHostWidth),
-				truncate(state, colStateWidth),
-				truncate(instanceType, colTypeWidth),
-				truncate(publicIP, colPublicIPWidth),
-				truncate(launchTime, colLaunchTimeWidth))
+		if err := instanceTable.print(tableFlags); err != nil {
+			return err
 		}
-
-		// Print bottom border
-		fmt.Printf("└%s┴%s┴%s┴%s┴%s┴%s┴%s┘\n",
-			strings.Repeat("─", colNameWidth),
-			strings.Repeat("─", colInstanceWidth),
-			strings.Repeat("─", colHostWidth),
-			strings.Repeat("─", colStateWidth),
-			strings.Repeat("─", colTypeWidth),
-			strings.Repeat("─", colPublicIPWidth),
-			strings.Repeat("─", colLaunchTimeWidth))
 	}
 
 	fmt.Println()
@@ -376,25 +261,34 @@ func findInstances(args []string, config *Configuration) error {
 	return nil
 }
 
+// listedInstance is a configured instance as 'instances list' writes it with --output.
+type listedInstance struct {
+	Instance
+	Default bool `json:"default,omitempty"` // The profile's default instance
+}
+
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
 func listInstances(args []string, config *Configuration) error {
 	flagSet := flag.NewFlagSet("instances list", flag.ContinueOnError)
 	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
 	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
 
+	var tableFlags tableOptions
+	tableFlags.register(flagSet)
+
 	flagSet.Usage = func() {
-		fmt.Println("USAGE:\n    awsdo instances list [--profile <aws cli profile>]")
+		fmt.Println("USAGE:\n    awsdo instances list [--profile <aws cli profile>] [--columns <column>[,<column> ...]]")
+		fmt.Println("                    [--sort-by [-]<column>] [--no-header] [--no-color]")
 	}
 
 	if err := flagSet.Parse(args); err != nil {
 		return nil
 	}
 
-	// List all instances across all profiles
-	if config.Profiles == nil {
-		fmt.Println("\nNo instances configured.")
-		fmt.Println()
-		return nil
+	headers := []string{"Name", "Instance ID", "Host"}
+
+	if err := tableFlags.validate(headers); err != nil {
+		return err
 	}
 
 	// Collect all instances grouped by profile
@@ -442,121 +336,55 @@ func listInstances(args []string, config *Configuration) error {
 		}
 	}
 
-	if len(profileGroups) == 0 {
-		fmt.Println("\nNo instances configured.")
-		fmt.Println()
-		return nil
-	}
-
 	// Get sorted list of profile names
-	var profileNames []string
-
-	for profileName := range profileGroups {
-		profileNames = append(profileNames, profileName)
-	}
-
-	sort.Strings(profileNames)
-
-	// Calculate maximum column widths from all instances
-	maxNameWidth := len("Name") // Start with header width
-	maxINstanceWidth := len("Instance ID")
-	maxHostWidth := len("Host")
-
-	// Iterate through all instances to find maximum widths
-	for _, instances := range profileGroups {
-		for _, row := range instances {
-			// Calculate name width (including "*" for default)
-			name := row.InstanceName
-
-			if row.IsDefault {
-				name = "*" + name
-			}
+	profileNames := sortedKeys(profileGroups)
 
-			if len(name) > maxNameWidth {
-				maxNameWidth = len(name)
-			}
+	if machineOutput() {
+		var records []listedInstance
 
-			// Calculate instance ID width
-			if len(row.Instance.ID) > maxINstanceWidth {
-				maxINstanceWidth = len(row.Instance.ID)
-			}
+		for _, profileName := range profileNames {
+			for _, row := range profileGroups[profileName] {
+				instance := row.Instance
+				instance.Name = row.InstanceName
+				instance.Profile = firstNonEmpty(instance.Profile, profileName)
 
-			// Calculate host width
-			if len(row.Instance.Host) > maxHostWidth {
-				maxHostWidth = len(row.Instance.Host)
+				records = append(records, listedInstance{Instance: instance, Default: row.IsDefault})
 			}
 		}
-	}
 
-	// Add 2 characters padding for readability
-	const padding = 2
-	colNameWidth := maxNameWidth + padding
-	colInstanceWidth := maxINstanceWidth + padding
-	colHostWidth := maxHostWidth + padding
-
-	// Helper function to truncate string to width
-	truncate := func(s string, width int) string {
-		if len(s) > width {
-			return s[:width-3] + "..."
-		}
-
-		return s + strings.Repeat(" ", width-len(s))
+		return writeRecords(records, func(record listedInstance) string { return record.ID })
 	}
 
-	// ANSI escape codes for bold
-	bold := "\033[1m"
-	reset := "\033[0m"
+	if len(profileGroups) == 0 {
+		fmt.Println("\nNo instances configured.")
+		fmt.Println()
+		return nil
+	}
 
 	fmt.Println()
 
 	// Display each profile group
 	for i, profileName := range profileNames {
-		instances := profileGroups[profileName]
-
 		// Print profile header
 		if i > 0 {
 			fmt.Println()
 		}
 
-		fmt.Printf("%sProfile: %s%s\n", bold, profileName, reset)
-
-		// Print top border
-		fmt.Printf("┌%s┬%s┬%s┐\n",
-			strings.Repeat("─", colNameWidth),
-			strings.Repeat("─", colInstanceWidth),
-			strings.Repeat("─", colHostWidth))
+		fmt.Println(tableFlags.bold("Profile: " + profileName))
 
-		// Print header row
-		fmt.Printf("│%s%s%s│%s%s%s│%s%s%s│\n",
-			bold, truncate("Name", colNameWidth), reset,
-			bold, truncate("Instance ID", colInstanceWidth), reset,
-			bold, truncate("Host", colHostWidth), reset)
+		instanceTable := table{headers: headers}
 
-		// Print separator between header and data
-		fmt.Printf("├%s┼%s┼%s┤\n",
-			strings.Repeat("─", colNameWidth),
-			strings.Repeat("─", colInstanceWidth),
-			strings.Repeat("─", colHostWidth))
-
-		// Print data rows
-		for _, row := range instances {
+		for _, row := range profileGroups[profileName] {
 			name := row.InstanceName
 
 			if row.IsDefault {
 				name = "*" + name
 			}
 
-			fmt.Printf("│%s│%s│%s│\n",
-				truncate(name, colNameWidth),
-				truncate(row.Instance.ID, colInstanceWidth),
-				truncate(row.Instance.Host, colHostWidth))
+			instanceTable.rows = append(instanceTable.rows, []string{name, row.Instance.ID, row.Instance.Host})
 		}
 
-		// Print bottom border
-		fmt.Printf("└%s┴%s┴%s┘\n",
-			strings.Repeat("─", colNameWidth),
-			strings.Repeat("─", colInstanceWidth),
-			strings.Repeat("─", colHostWidth))
+		instanceTable.print(tableFlags)
 	}
 
 	fmt.Println()
@@ -634,196 +462,7 @@ func addInstance(args []string, config *Configuration) error {
 	// Display instances in a formatted table
 	fmt.Println("\nAvailable EC2 instances:")
 
-	// Calculate maximum column widths
-	maxNumWidth := len("#")
-	maxNameWidth := len("Name")
-	maxInstanceWidth := len("Instance ID")
-	maxHostWidth := len("Host")
-	maxStateWidth := len("State")
-	maxTypeWidth := len("Type")
-	maxPublicIPWidth := len("Public IP")
-	maxLaunchTimeWidth := len("Launch Time")
-
-	for i, inst := range instances {
-		// Number width (for selection)
-		numStr := strconv.Itoa(i + 1)
-		if len(numStr) > maxNumWidth {
-			maxNumWidth = len(numStr)
-		}
-
-		name := inst.Name
-		if name == "" {
-			name = "(no name)"
-		}
-
-		if len(name) > maxNameWidth {
-			maxNameWidth = len(name)
-		}
-
-		if len(inst.Instance) > maxInstanceWidth {
-			maxInstanceWidth = len(inst.Instance)
-		}
-
-		host := inst.Host
-		if host == "" {
-			host = "(no host)"
-		}
-
-		if len(host) > maxHostWidth {
-			maxHostWidth = len(host)
-		}
-
-		state := inst.State
-		if state == "" {
-			state = "(unknown)"
-		}
-
-		if len(state) > maxStateWidth {
-			maxStateWidth = len(state)
-		}
-
-		instanceType := inst.InstanceType
-		if instanceType == "" {
-			instanceType = "(unknown)"
-		}
-
-		if len(instanceType) > maxTypeWidth {
-			maxTypeWidth = len(instanceType)
-		}
-
-		publicIP := inst.PublicIP
-		if publicIP == "" {
-			publicIP = "(none)"
-		}
-
-		if len(publicIP) > maxPublicIPWidth {
-			maxPublicIPWidth = len(publicIP)
-		}
-
-		launchTime := formatLaunchTime(inst.LaunchTime)
-		if len(launchTime) > maxLaunchTimeWidth {
-			maxLaunchTimeWidth = len(launchTime)
-		}
-	}
-
-	// Add 2 characters padding for readability
-	const padding = 2
-	colNumWidth := maxNumWidth + padding
-	colNameWidth := maxNameWidth + padding
-	colInstanceWidth := maxInstanceWidth + padding
-	colHostWidth := maxHostWidth + padding
-	colStateWidth := maxStateWidth + padding
-	colTypeWidth := maxTypeWidth + padding
-	colPublicIPWidth := maxPublicIPWidth + padding
-	colLaunchTimeWidth := maxLaunchTimeWidth + padding
-
-	// Helper function to truncate string to width
-	truncate := func(s string, width int) string {
-		if len(s) > width {
-			return s[:width-3] + "..."
-		}
-
-		return s + strings.Repeat(" ", width-len(s))
-	}
-
-	// Helper function to format integer to string with padding
-	formatInt := func(n int, width int) string {
-		s := strconv.Itoa(n)
-
-		if len(s) > width {
-			return s[:width-3] + "..."
-		}
-
-		return s + strings.Repeat(" ", width-len(s))
-	}
-
-	// ANSI escape codes for bold
-	bold := "\033[1m"
-	reset := "\033[0m"
-
-	// Print top border
-	fmt.Printf("┌%s┬%s┬%s┬%s┬%s┬%s┬%s┬%s┐\n",
-		strings.Repeat("─", colNumWidth),
-		strings.Repeat("─", colNameWidth),
-		strings.Repeat("─", colInstanceWidth),
-		strings.Repeat("─", colHostWidth),
-		strings.Repeat("─", colStateWidth),
-		strings.Repeat("─", colTypeWidth),
-		strings.Repeat("─", colPublicIPWidth),
-		strings.Repeat("─", colLaunchTimeWidth))
-
-	// Print header row
-	fmt.Printf("│%s%s%s│%s%s%s│%s%s%s│%s%s%s│%s%s%s│%s%s%s│%s%s%s│%s%s%s│\n",
-		bold, truncate("#", colNumWidth), reset,
-		bold, truncate("Name", colNameWidth), reset,
-		bold, truncate("Instance ID", colInstanceWidth), reset,
-		bold, truncate("Host", colHostWidth), reset,
-		bold, truncate("State", colStateWidth), reset,
-		bold, truncate("Type", colTypeWidth), reset,
-		bold, truncate("Public IP", colPublicIPWidth), reset,
-		bold, truncate("Launch Time", colLaunchTimeWidth), reset)
-
-	// Print separator between header and data
-	fmt.Printf("├%s┼%s┼%s┼%s┼%s┼%s┼%s┼%s┤\n",
-		strings.Repeat("─", colNumWidth),
-		strings.Repeat("─", colNameWidth),
-		strings.Repeat("─", colInstanceWidth),
-		strings.Repeat("─", colHostWidth),
-		strings.Repeat("─", colStateWidth),
-		strings.Repeat("─", colTypeWidth),
-		strings.Repeat("─", colPublicIPWidth),
-		strings.Repeat("─", colLaunchTimeWidth))
-
-	// Print data rows
-	for i, inst := range instances {
-		name := inst.Name
-		if name == "" {
-			name = "(no name)"
-		}
-
-		host := inst.Host
-		if host == "" {
-			host = "(no host)"
-		}
-
-		state := inst.State
-		if state == "" {
-			state = "(unknown)"
-		}
-
-		instanceType := inst.InstanceType
-		if instanceType == "" {
-			instanceType = "(unknown)"
-		}
-
-		publicIP := inst.PublicIP
-		if publicIP == "" {
-			publicIP = "(none)"
-		}
-
-		launchTime := formatLaunchTime(inst.LaunchTime)
-
-		fmt.Printf("│%s│%s│%s│%s│%s│%s│%s│%s│\n",
-			formatInt(i+1, colNumWidth),
-			truncate(name, colNameWidth),
-			truncate(inst.Instance, colInstanceWidth),
-			truncate(host, colHostWidth),
-			truncate(state, colStateWidth),
-			truncate(instanceType, colTypeWidth),
-			truncate(publicIP, colPublicIPWidth),
-			truncate(launchTime, colLaunchTimeWidth))
-	}
-
-	// Print bottom border
-	fmt.Printf("└%s┴%s┴%s┴%s┴%s┴%s┴%s┴%s┘\n",
-		strings.Repeat("─", colNumWidth),
-		strings.Repeat("─", colNameWidth),
-		strings.Repeat("─", colInstanceWidth),
-		strings.Repeat("─", colHostWidth),
-		strings.Repeat("─", colStateWidth),
-		strings.Repeat("─", colTypeWidth),
-		strings.Repeat("─", colPublicIPWidth),
-		strings.Repeat("─", colLaunchTimeWidth))
+	printInstanceChoices(instances)
 
 	fmt.Print("\nSelect instance number: ")
 	instSelection, _ := reader.ReadString('\n')
@@ -975,195 +614,7 @@ func updateInstance(args []string, config *Configuration) {
 	// Display instances in a formatted table
 	fmt.Println("\nAvailable EC2 instances:")
 
-	// Calculate maximum column widths
-	maxNumWidth := len("#")
-	maxNameWidth := len("Name")
-	maxInstanceWidth := len("Instance ID")
-	maxHostWidth := len("Host")
-	maxStateWidth := len("State")
-	maxTypeWidth := len("Type")
-	maxPublicIPWidth := len("Public IP")
-	maxLaunchTimeWidth := len("Launch Time")
-
-	for i, inst := range instances {
-		// Number width (for selection)
-		numStr := strconv.Itoa(i + 1)
-		if len(numStr) > maxNumWidth {
-			maxNumWidth = len(numStr)
-		}
-
-		name := inst.Name
-		if name == "" {
-			name = "(no name)"
-		}
-
-		if len(name) > maxNameWidth {
-			maxNameWidth = len(name)
-		}
-
-		if len(inst.Instance) > maxInstanceWidth {
-			maxInstanceWidth = len(inst.Instance)
-		}
-
-		host := inst.Host
-		if host == "" {
-			host = "(no host)"
-		}
-
-		if len(host) > maxHostWidth {
-			maxHostWidth = len(host)
-		}
-
-		state := inst.State
-		if state == "" {
-			state = "(unknown)"
-		}
-
-		if len(state) > maxStateWidth {
-			maxStateWidth = len(state)
-		}
-
-		instanceType := inst.InstanceType
-		if instanceType == "" {
-			instanceType = "(unknown)"
-		}
-
-		if len(instanceType) > maxTypeWidth {
-			maxTypeWidth = len(instanceType)
-		}
-
-		publicIP := inst.PublicIP
-		if publicIP == "" {
-			publicIP = "(none)"
-		}
-
-		if len(publicIP) > maxPublicIPWidth {
-			maxPublicIPWidth = len(publicIP)
-		}
-
-		launchTime := formatLaunchTime(inst.LaunchTime)
-		if len(launchTime) > maxLaunchTimeWidth {
-			maxLaunchTimeWidth = len(launchTime)
-		}
-	}
-
-	// Add 2 characters padding for readability
-	const padding = 2
-	colNumWidth := maxNumWidth + padding
-	colNameWidth := maxNameWidth + padding
-	colInstanceWidth := maxInstanceWidth + padding
-	colHostWidth := maxHostWidth + padding
-	colStateWidth := maxStateWidth + padding
-	colTypeWidth := maxTypeWidth + padding
-	colPublicIPWidth := maxPublicIPWidth + padding
-	colLaunchTimeWidth := maxLaunchTimeWidth + padding
-
-	// Helper function to truncate string to width
-	truncate := func(s string, width int) string {
-		if len(s) > width {
-			return s[:width-3] + "..."
-		}
-
-		return s + strings.Repeat(" ", width-len(s))
-	}
-
-	// Helper function to format integer to string with padding
-	formatInt := func(n int, width int) string {
-		s := strconv.Itoa(n)
-		if len(s) > width {
-			return s[:width-3] + "..."
-		}
-
-		return s + strings.Repeat(" ", width-len(s))
-	}
-
-	// ANSI escape codes for bold
-	bold := "\033[1m"
-	reset := "\033[0m"
-
-	// Print top border
-	fmt.Printf("┌%s┬%s┬%s┬%s┬%s┬%s┬%s┬%s┐\n",
-		strings.Repeat("─", colNumWidth),
-		strings.Repeat("─", colNameWidth),
-		strings.Repeat("─", colInstanceWidth),
-		strings.Repeat("─", colHostWidth),
-		strings.Repeat("─", colStateWidth),
-		strings.Repeat("─", colTypeWidth),
-		strings.Repeat("─", colPublicIPWidth),
-		strings.Repeat("─", colLaunchTimeWidth))
-
-	// Print header row
-	fmt.Printf("│%s%s%s│%s%s%s│%s%s%s│%s%s%s│%s%s%s│%s%s%s│%s%s%s│%s%s%s│\n",
-		bold, truncate("#", colNumWidth), reset,
-		bold, truncate("Name", colNameWidth), reset,
-		bold, truncate("Instance ID", colInstanceWidth), reset,
-		bold, truncate("Host", colHostWidth), reset,
-		bold, truncate("State", colStateWidth), reset,
-		bold, truncate("Type", colTypeWidth), reset,
-		bold, truncate("Public IP", colPublicIPWidth), reset,
-		bold, truncate("Launch Time", colLaunchTimeWidth), reset)
-
-	// Print separator between header and data
-	fmt.Printf("├%s┼%s┼%s┼%s┼%s┼%s┼%s┼%s┤\n",
-		strings.Repeat("─", colNumWidth),
-		strings.Repeat("─", colNameWidth),
-		strings.Repeat("─", colInstanceWidth),
-		strings.Repeat("─", colHostWidth),
-		strings.Repeat("─", colStateWidth),
-		strings.Repeat("─", colTypeWidth),
-		strings.Repeat("─", colPublicIPWidth),
-		strings.Repeat("─", colLaunchTimeWidth))
-
-	// Print data rows
-	for i, inst := range instances {
-		name := inst.Name
-		if name == "" {
-			name = "(no name)"
-		}
-
-		host := inst.Host
-		if host == "" {
-			host = "(no host)"
-		}
-
-		state := inst.State
-		if state == "" {
-			state = "(unknown)"
-		}
-
-		instanceType := inst.InstanceType
-		if instanceType == "" {
-			instanceType = "(unknown)"
-		}
-
-		publicIP := inst.PublicIP
-		if publicIP == "" {
-			publicIP = "(none)"
-		}
-
-		launchTime := formatLaunchTime(inst.LaunchTime)
-
-		fmt.Printf("│%s│%s│%s│%s│%s│%s│%s│%s│\n",
-			formatInt(i+1, colNumWidth),
-			truncate(name, colNameWidth),
-			truncate(inst.Instance, colInstanceWidth),
-			truncate(host, colHostWidth),
-			truncate(state, colStateWidth),
-			truncate(instanceType, colTypeWidth),
-			truncate(publicIP, colPublicIPWidth),
-			truncate(launchTime, colLaunchTimeWidth))
-	}
-
-	// Print bottom border
-	fmt.Printf("└%s┴%s┴%s┴%s┴%s┴%s┴%s┴%s┘\n",
-		strings.Repeat("─", colNumWidth),
-		strings.Repeat("─", colNameWidth),
-		strings.Repeat("─", colInstanceWidth),
-		strings.Repeat("─", colHostWidth),
-		strings.Repeat("─", colStateWidth),
-		strings.Repeat("─", colTypeWidth),
-		strings.Repeat("─", colPublicIPWidth),
-		strings.Repeat("─", colLaunchTimeWidth))
+	printInstanceChoices(instances)
 
 	fmt.Print("\nSelect instance number: ")
 	instSelection, _ := reader.ReadString('\n')
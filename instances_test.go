@@ -0,0 +1,215 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+// testInstancesOutput is a describe-instances document with two bastions and a web server.
+const testInstancesOutput = `{
+    "Reservations": [
+        {
+            "Instances": [
+                {
+                    "InstanceId": "i-0001",
+                    "InstanceType": "t3.micro",
+                    "PrivateIpAddress": "10.0.0.1",
+                    "Placement": {"AvailabilityZone": "us-east-1a"},
+                    "State": {"Name": "running"},
+                    "Tags": [{"Key": "Name", "Value": "bastion-a"}, {"Key": "env", "Value": "prod"}]
+                },
+                {
+                    "InstanceId": "i-0002",
+                    "InstanceType": "t3.micro",
+                    "Placement": {"AvailabilityZone": "us-east-1b"},
+                    "State": {"Name": "running"},
+                    "Tags": [{"Key": "Name", "Value": "bastion-b"}, {"Key": "env", "Value": "dev"}]
+                }
+            ]
+        },
+        {
+            "Instances": [
+                {
+                    "InstanceId": "i-0003",
+                    "InstanceType": "m5.large",
+                    "Placement": {"AvailabilityZone": "us-east-1a"},
+                    "State": {"Name": "stopped"},
+                    "Tags": [{"Key": "Name", "Value": "web"}]
+                }
+            ]
+        }
+    ]
+}`
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func instanceIDs(instances []EC2Instance) []string {
+	ids := make([]string, len(instances))
+	for i, instance := range instances {
+		ids[i] = instance.Instance
+	}
+
+	return ids
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestDescribeEC2InstancesFlattensReservations(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("ec2 describe-instances", testInstancesOutput)
+
+	instances, err := queryEC2Instances("dev", "bastion")
+	if err != nil {
+		t.Fatalf("queryEC2Instances: %v", err)
+	}
+
+	if ids := instanceIDs(instances); !slices.Equal(ids, []string{"i-0001", "i-0002", "i-0003"}) {
+		t.Errorf("instances = %v", ids)
+	}
+
+	first := instances[0]
+	if first.Name != "bastion-a" || first.AZ != "us-east-1a" || first.Host != "10.0.0.1" || first.State != "running" || first.Tags["env"] != "prod" {
+		t.Errorf("first instance = %+v", first)
+	}
+
+	calls := fake.CallsTo("ec2 describe-instances")
+	if len(calls) != 1 || calls[0].Profile != "dev" || !slices.Contains(calls[0].Args, "Name=tag:Name,Values=*bastion*") {
+		t.Errorf("calls = %+v", calls)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// Negated filters cannot be expressed as EC2 filters, so they are applied to the results.
+func TestFindEC2InstancesAppliesNegatedFilters(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("ec2 describe-instances", testInstancesOutput)
+
+	filters := []instanceFilter{
+		{name: "instance-state-name", pattern: "running"},
+		{name: "tag:env", pattern: "prod", negate: true},
+	}
+
+	instances, err := findEC2Instances("dev", "", filters)
+	if err != nil {
+		t.Fatalf("findEC2Instances: %v", err)
+	}
+
+	// The fake ignores the server side filter, so only the negated one narrows the list here
+	if ids := instanceIDs(instances); !slices.Equal(ids, []string{"i-0002", "i-0003"}) {
+		t.Errorf("instances = %v", ids)
+	}
+
+	args := fake.CallsTo("ec2 describe-instances")[0].Args
+	if !slices.Contains(args, "Name=instance-state-name,Values=running") || slices.Contains(args, "Name=tag:env,Values=prod") {
+		t.Errorf("describe-instances arguments = %v", args)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestQueryBastionInstancesKeepsOnlineInstances(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("ec2 describe-instances", testInstancesOutput)
+	fake.Respond("ssm describe-instance-information", `{"InstanceInformationList": [
+		{"InstanceId": "i-0001", "PingStatus": "Online"},
+		{"InstanceId": "i-0002", "PingStatus": "ConnectionLost"}
+	]}`)
+
+	rules := &BastionDiscovery{Names: []string{"bastion-*"}, Tags: map[string]string{"Role": ""}}
+
+	instances, err := queryBastionInstances("dev", "", rules)
+	if err != nil {
+		t.Fatalf("queryBastionInstances: %v", err)
+	}
+
+	// Each rule is queried separately and the results merged without duplicates
+	if calls := fake.CallsTo("ec2 describe-instances"); len(calls) != 2 {
+		t.Errorf("describe-instances was called %d times, want 2", len(calls))
+	}
+
+	statuses := map[string]string{}
+	for _, instance := range instances {
+		statuses[instance.Instance] = instance.PingStatus
+	}
+
+	want := map[string]string{"i-0001": "Online", "i-0002": "ConnectionLost", "i-0003": "Not registered"}
+	if len(instances) != 3 || !maps.Equal(statuses, want) {
+		t.Errorf("ping statuses = %v, want %v", statuses, want)
+	}
+
+	rules.SSMOnline = true
+
+	instances, err = queryBastionInstances("dev", "", rules)
+	if err != nil {
+		t.Fatalf("queryBastionInstances: %v", err)
+	}
+
+	if ids := instanceIDs(instances); !slices.Equal(ids, []string{"i-0001"}) {
+		t.Errorf("online instances = %v", ids)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestFindEC2InstancesInProfilesQueriesEachRegion(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("ec2 describe-instances", testInstancesOutput)
+
+	regions := regionFlags{regions: stringListFlag{"us-east-1", "eu-west-1"}}
+
+	instances, err := findEC2InstancesInProfiles([]string{"dev", "prod"}, regions, nil)
+	if err != nil {
+		t.Fatalf("findEC2InstancesInProfiles: %v", err)
+	}
+
+	queried := map[string]int{}
+	for _, call := range fake.CallsTo("ec2 describe-instances") {
+		region := call.Args[slices.Index(call.Args, "--region")+1]
+		queried[call.Profile+" "+region]++
+	}
+
+	want := map[string]int{"dev us-east-1": 1, "dev eu-west-1": 1, "prod us-east-1": 1, "prod eu-west-1": 1}
+	if !maps.Equal(queried, want) {
+		t.Errorf("queried = %v, want %v", queried, want)
+	}
+
+	var profiles []string
+	for _, instance := range instances {
+		profiles = append(profiles, instance.Profile)
+	}
+
+	// Three instances per region, in the order of the profiles
+	wantProfiles := slices.Concat(slices.Repeat([]string{"dev"}, 6), slices.Repeat([]string{"prod"}, 6))
+	if !slices.Equal(profiles, wantProfiles) {
+		t.Errorf("instance profiles = %v, want %v", profiles, wantProfiles)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// A search with a single result replaces the default instance, but keeps the forwards saved
+// with it.
+func TestFindInstancesKeepsDefaultForwards(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("sts get-caller-identity", `{"Account": "123"}`)
+	fake.Respond("ec2 describe-instances", `{"Reservations": [{"Instances": [{
+		"InstanceId": "i-0004",
+		"PrivateIpAddress": "10.0.0.4",
+		"State": {"Name": "running"},
+		"Tags": [{"Key": "Name", "Value": "web"}]
+	}]}]}`)
+
+	config := newTestConfiguration()
+	config.Profiles["dev"] = Profile{Name: "dev", Instances: map[string]Instance{
+		"default": {Name: "default", ID: "i-0003", Forwards: map[string]PortForward{"debugger": {Name: "debugger", Port: 9229}}},
+	}}
+
+	if err := findInstances([]string{"-p", "dev", "-f", "web"}, config); err != nil {
+		t.Fatalf("findInstances: %v", err)
+	}
+
+	instance := config.Profiles["dev"].Instances["default"]
+	if instance.ID != "i-0004" || instance.Host != "10.0.0.4" {
+		t.Errorf("default instance = %+v, want i-0004", instance)
+	}
+
+	if _, exists := instance.Forwards["debugger"]; !exists {
+		t.Errorf("the forwards of the default instance were lost: %+v", instance.Forwards)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -19,27 +20,17 @@ func login(args []string, config *Configuration) error {
 		return fmt.Errorf("USAGE: awsdo login [--profile <aws cli profile>]")
 	}
 
-	commandArgs := []string{"sso", "login"}
+	var profile string
 
 	if len(*profileFlag) != 0 {
-		commandArgs = append(commandArgs, "--profile", *profileFlag)
+		profile = *profileFlag
 	} else if len(*profileShort) != 0 {
-		commandArgs = append(commandArgs, "--profile", *profileShort)
+		profile = *profileShort
 	} else if len(config.DefaultProfile) != 0 {
-		commandArgs = append(commandArgs, "--profile", config.DefaultProfile)
+		profile = config.DefaultProfile
 	}
 
-	command := exec.Command("aws", commandArgs...)
-	command.Stdout = os.Stdout
-	command.Stderr = os.Stderr
-	command.Stdin = os.Stdin
-	err := command.Start()
-
-	if err != nil {
-		return err
-	}
-
-	if err := command.Wait(); err != nil {
+	if err := awsRunner.Run(profile, "sso", "login"); err != nil {
 		return err
 	}
 
@@ -48,25 +39,15 @@ func login(args []string, config *Configuration) error {
 
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
 func isLoggedIn(profile string) bool {
-	//aws sts get-caller-identity --profile spg --query Account
+	//aws sts get-caller-identity --profile spg
 	// if exit code is non-zero, then we're not logged in.
 
-	args := []string{"sts", "get-caller-identity", "--query", "Account"}
+	err := awsRunner.Check(profile, "sts", "get-caller-identity")
 
-	if len(profile) != 0 {
-		args = append(args, "--profile", profile)
-	}
-
-	command := exec.Command("aws", args...)
-
-	if err := command.Start(); err != nil {
+	if errors.Is(err, exec.ErrNotFound) {
 		fmt.Printf("Failed to authenticate %s", err.Error())
 		os.Exit(1)
 	}
 
-	if err := command.Wait(); err != nil {
-		return false
-	}
-
-	return true
+	return err == nil
 }
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// Commands log in to the profile first when its session has expired.
+func TestAddBastionLogsInWhenSessionExpired(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Fail("sts get-caller-identity", errors.New("the SSO session has expired"))
+	fake.Respond("sso login", "")
+	respondForBastionAdd(fake)
+
+	config := newTestConfiguration()
+	args := []string{"--profile", "dev", "--db-id", "orders-db", "--instance-name", "bastion-a", "--local-port", "15432"}
+
+	if err := addBastion(args, config); err != nil {
+		t.Fatalf("addBastion: %v", err)
+	}
+
+	logins := fake.CallsTo("sso login")
+	if len(logins) != 1 || logins[0].Profile != "dev" || logins[0].Method != "Run" {
+		t.Errorf("logins = %+v, want one for profile dev", logins)
+	}
+
+	// The login happens before the profile's resources are queried
+	calls := fake.Calls()
+	for _, call := range calls {
+		if hasCommandPrefix(call.Args, "sso login") {
+			break
+		}
+
+		if !hasCommandPrefix(call.Args, "sts get-caller-identity") {
+			t.Errorf("%v was called before logging in", call.Args)
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestAddBastionStopsWhenLoginFails(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Fail("sts get-caller-identity", errors.New("the SSO session has expired"))
+	fake.Fail("sso login", errors.New("login canceled"))
+	respondForBastionAdd(fake)
+
+	config := newTestConfiguration()
+	args := []string{"--db-id", "orders-db", "--instance-name", "bastion-a", "--local-port", "15432"}
+
+	if err := addBastion(args, config); err == nil || err.Error() != "login canceled" {
+		t.Fatalf("addBastion error = %v, want the login error", err)
+	}
+
+	if calls := fake.CallsTo("ec2"); len(calls) != 0 {
+		t.Errorf("instances were queried after the login failed: %+v", calls)
+	}
+}
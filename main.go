@@ -25,6 +25,16 @@ func main() {
 	exePath, _ := os.Executable()
 	configFile := filepath.Join(filepath.Dir(exePath), "awsdo_config.json")
 
+	// --output applies to every command and may appear anywhere on the command line
+	args, format, err := extractOutputOption(os.Args[1:])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	os.Args = append(os.Args[:1], args...)
+	outputFormat = format
+
 	if len(os.Args) < 2 {
 		showHelp("")
 		os.Exit(1)
@@ -36,6 +46,8 @@ func main() {
 		os.Exit(1)
 	}
 
+	awsRunner = newBackendRunner(&config)
+	listenAddress = listenAddressFor(&config)
 	command := strings.ToLower(os.Args[1])
 
 	switch command {
@@ -51,14 +63,23 @@ func main() {
 	case "instances":
 		if len(os.Args) < 3 {
 			// Default to 'list' if no subcommand provided
-			listInstances([]string{}, &config)
+			if err := listInstances([]string{}, &config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
 		} else {
 			subcommand := strings.ToLower(os.Args[2])
 			switch subcommand {
 			case "find":
-				findInstances(os.Args[3:], &config)
+				if err := findInstances(os.Args[3:], &config); err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
 			case "list", "ls":
-				listInstances(os.Args[3:], &config)
+				if err := listInstances(os.Args[3:], &config); err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
 			case "add":
 				addInstance(os.Args[3:], &config)
 			case "update":
@@ -73,29 +94,97 @@ func main() {
 		}
 	case "terminal":
 		startSSMSession(os.Args[2:], &config)
+	case "forward":
+		if err := forwardCommand(os.Args[2:], &config); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
 	case "bastion":
-		startBastionTunnel(os.Args[2:], &config)
+		if err := bastionCommand(os.Args[2:], &config); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
 	case "bastions":
 		if len(os.Args) < 3 {
 			// Default to 'list' if no subcommand provided
-			listBastions([]string{}, &config)
+			if err := listBastions([]string{}, &config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
 		} else {
 			subcommand := strings.ToLower(os.Args[2])
 			switch subcommand {
 			case "list", "ls":
-				listBastions(os.Args[3:], &config)
+				if err := listBastions(os.Args[3:], &config); err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
 			case "add":
-				addBastion(os.Args[3:], &config)
+				if err := addBastion(os.Args[3:], &config); err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
 			case "update", "up":
-				updateBastion(os.Args[3:], &config)
+				if err := updateBastion(os.Args[3:], &config); err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
 			case "remove", "rm":
-				removeBastion(os.Args[3:], &config)
+				if err := removeBastion(os.Args[3:], &config); err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+			case "reconnect":
+				if err := reconnectBastion(os.Args[3:], &config); err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+			case "discovery":
+				if err := bastionDiscovery(os.Args[3:], &config); err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+			case "secret":
+				if err := bastionSecret(os.Args[3:], &config); err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+			case "group", "groups":
+				if err := tunnelGroupCommand(os.Args[3:], &config); err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+			case "export":
+				if err := exportBastions(os.Args[3:], &config); err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
 			default:
 				fmt.Printf("Invalid bastions subcommand: %s\n", subcommand)
 				fmt.Println("Use 'awsdo bastions list' to list bastions, 'awsdo bastions add' to add a new bastion, 'awsdo bastions update' to update an existing bastion, or 'awsdo bastions remove' to remove a bastion.")
 				os.Exit(1)
 			}
 		}
+	case "db":
+		if err := bastionCommand(append([]string{"--connect"}, os.Args[2:]...), &config); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "backend":
+		if err := backendCommand(os.Args[2:], &config); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "daemon":
+		// Internal command used by the background tunnel daemon. It runs until stopped, so the
+		// bastion instances it refreshes are saved as they change rather than on exit.
+		instanceCacheFile = configFile
+
+		if err := daemonCommand(os.Args[2:], &config); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	case "docs":
 		showDocs()
 		return
@@ -113,9 +202,15 @@ func main() {
 		object := strings.ToLower(os.Args[2])
 		switch object {
 		case "instances", "instance":
-			listInstances(os.Args[3:], &config)
+			if err := listInstances(os.Args[3:], &config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
 		case "bastions", "bastion":
-			listBastions(os.Args[3:], &config)
+			if err := listBastions(os.Args[3:], &config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
 		default:
 			fmt.Printf("Invalid object: %s\n", object)
 			fmt.Println("Use 'awsdo ls instances' or 'awsdo ls bastions'")
@@ -131,7 +226,10 @@ func main() {
 		case "instance", "instances":
 			addInstance(os.Args[3:], &config)
 		case "bastion", "bastions":
-			addBastion(os.Args[3:], &config)
+			if err := addBastion(os.Args[3:], &config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
 		default:
 			fmt.Printf("Invalid object: %s\n", object)
 			fmt.Println("Use 'awsdo add instance' or 'awsdo add bastion'")
@@ -147,7 +245,10 @@ func main() {
 		case "instance", "instances":
 			removeInstance(os.Args[3:], &config)
 		case "bastion", "bastions":
-			removeBastion(os.Args[3:], &config)
+			if err := removeBastion(os.Args[3:], &config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
 		default:
 			fmt.Printf("Invalid object: %s\n", object)
 			fmt.Println("Use 'awsdo rm instance' or 'awsdo rm bastion'")
@@ -161,7 +262,10 @@ func main() {
 		object := strings.ToLower(os.Args[2])
 		switch object {
 		case "instance", "instances":
-			findInstances(os.Args[3:], &config)
+			if err := findInstances(os.Args[3:], &config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
 		default:
 			fmt.Printf("Invalid object: %s\n", object)
 			fmt.Println("Use 'awsdo find instance'")
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputCSV   = "csv"
+	outputTSV   = "tsv"
+	outputIDs   = "ids"
+)
+
+// outputFormat is the format of the global --output option, empty for the default table.
+var outputFormat string
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// extractOutputOption removes the global --output option from a command line and returns the
+// remaining arguments with the format. Arguments after "--" belong to another program and are
+// left alone.
+func extractOutputOption(args []string) ([]string, string, error) {
+	var remaining []string
+	format := ""
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--" {
+			remaining = append(remaining, args[i:]...)
+			break
+		}
+
+		value, isOption := strings.CutPrefix(arg, "--output=")
+
+		if arg == "--output" || arg == "-output" {
+			if i+1 >= len(args) {
+				return nil, "", fmt.Errorf("--output requires a format: table, json, yaml, csv, tsv or ids")
+			}
+
+			i++
+			value, isOption = args[i], true
+		}
+
+		if !isOption {
+			remaining = append(remaining, arg)
+			continue
+		}
+
+		switch value = strings.ToLower(value); value {
+		case outputTable, outputJSON, outputYAML, outputCSV, outputTSV, outputIDs:
+			format = value
+		default:
+			return nil, "", fmt.Errorf("invalid output format '%s', expected table, json, yaml, csv, tsv or ids", value)
+		}
+	}
+
+	return remaining, format, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// machineOutput reports whether listings are written in a machine-readable format rather than as
+// a table, so that headings and messages meant for people are left out.
+func machineOutput() bool {
+	return outputFormat != "" && outputFormat != outputTable
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// writeRecords prints records in the machine-readable output format. Field names are the JSON
+// names of the record's fields, and id returns the identifier the ids format prints.
+func writeRecords[T any](records []T, id func(T) string) error {
+	if records == nil {
+		records = []T{}
+	}
+
+	switch outputFormat {
+	case outputJSON:
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(data))
+	case outputYAML:
+		data, err := json.Marshal(records)
+		if err != nil {
+			return err
+		}
+
+		text, err := jsonToYAML(data)
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(text)
+	case outputCSV, outputTSV:
+		columns := recordColumns(reflect.TypeFor[T]())
+		rows := [][]string{columns}
+
+		for _, record := range records {
+			rows = append(rows, recordCells(reflect.ValueOf(record)))
+		}
+
+		return writeDelimited(rows, outputFormat == outputTSV)
+	case outputIDs:
+		for _, record := range records {
+			fmt.Println(id(record))
+		}
+	default:
+		return fmt.Errorf("invalid output format '%s'", outputFormat)
+	}
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// writeDelimited prints rows as CSV, or as tab-separated values without quoting, in which case
+// tabs and line breaks inside values become spaces.
+func writeDelimited(rows [][]string, tabs bool) error {
+	if !tabs {
+		writer := csv.NewWriter(os.Stdout)
+		writer.WriteAll(rows)
+
+		return writer.Error()
+	}
+
+	replacer := strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = replacer.Replace(cell)
+		}
+
+		fmt.Println(strings.Join(cells, "\t"))
+	}
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// recordColumns returns the JSON names of a struct's fields, including those of embedded
+// structs. Every field is a column, also the ones JSON omits when empty.
+func recordColumns(recordType reflect.Type) []string {
+	var columns []string
+
+	for i := range recordType.NumField() {
+		field := recordType.Field(i)
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			columns = append(columns, recordColumns(field.Type)...)
+			continue
+		}
+
+		columns = append(columns, firstNonEmpty(name, field.Name))
+	}
+
+	return columns
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// recordCells returns the values of a struct's fields in the order of recordColumns. Maps of
+// strings become key=value pairs separated by semicolons, other nested values become JSON.
+func recordCells(record reflect.Value) []string {
+	var cells []string
+
+	for i := range record.NumField() {
+		field := record.Type().Field(i)
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+
+		value := record.Field(i)
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			cells = append(cells, recordCells(value)...)
+			continue
+		}
+
+		cells = append(cells, recordCell(value))
+	}
+
+	return cells
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// recordCell formats one field value for CSV and TSV output.
+func recordCell(value reflect.Value) string {
+	switch value.Kind() {
+	case reflect.String:
+		return value.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10)
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool())
+	case reflect.Pointer:
+		if value.IsNil() {
+			return ""
+		}
+	case reflect.Map:
+		if value.Len() == 0 {
+			return ""
+		}
+
+		if values, ok := value.Interface().(map[string]string); ok {
+			pairs := make([]string, 0, len(values))
+
+			for _, key := range sortedKeys(values) {
+				pairs = append(pairs, key+"="+values[key])
+			}
+
+			return strings.Join(pairs, ";")
+		}
+	}
+
+	data, _ := json.Marshal(value.Interface())
+	return string(data)
+}
+
+// yamlEntry is a key and value of a JSON object, which jsonToYAML keeps in their original order.
+type yamlEntry struct {
+	key   string
+	value any
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// jsonToYAML converts a JSON document to YAML in block style. Keys keep the order of the JSON,
+// which follows the field order of the structs it was encoded from.
+func jsonToYAML(data []byte) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	value, err := decodeOrderedJSON(decoder)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(yamlLines(value), "\n") + "\n", nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// decodeOrderedJSON decodes the next JSON value. Objects become []yamlEntry, arrays []any and
+// scalars their YAML text.
+func decodeOrderedJSON(decoder *json.Decoder) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '{' {
+			entries := []yamlEntry{}
+
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+
+				value, err := decodeOrderedJSON(decoder)
+				if err != nil {
+					return nil, err
+				}
+
+				entries = append(entries, yamlEntry{key: yamlKey(key.(string)), value: value})
+			}
+
+			_, err := decoder.Token()
+			return entries, err
+		}
+
+		items := []any{}
+
+		for decoder.More() {
+			item, err := decodeOrderedJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, item)
+		}
+
+		_, err := decoder.Token()
+		return items, err
+	case string:
+		return yamlQuote(token), nil
+	case json.Number:
+		return token.String(), nil
+	case bool:
+		return strconv.FormatBool(token), nil
+	}
+
+	return "null", nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// yamlLines renders a decoded value as YAML lines without indentation. Nested blocks are indented
+// by two spaces, and empty objects and arrays are written inline.
+func yamlLines(value any) []string {
+	var lines []string
+
+	switch value := value.(type) {
+	case []yamlEntry:
+		if len(value) == 0 {
+			return []string{"{}"}
+		}
+
+		for _, entry := range value {
+			nested := yamlLines(entry.value)
+
+			if isYAMLScalar(entry.value) {
+				lines = append(lines, entry.key+": "+nested[0])
+				continue
+			}
+
+			lines = append(lines, entry.key+":")
+
+			for _, line := range nested {
+				lines = append(lines, "  "+line)
+			}
+		}
+	case []any:
+		if len(value) == 0 {
+			return []string{"[]"}
+		}
+
+		for _, item := range value {
+			nested := yamlLines(item)
+			lines = append(lines, "- "+nested[0])
+
+			for _, line := range nested[1:] {
+				lines = append(lines, "  "+line)
+			}
+		}
+	case string:
+		lines = append(lines, value)
+	}
+
+	return lines
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// isYAMLScalar reports whether a decoded value is written on the line of its key.
+func isYAMLScalar(value any) bool {
+	switch value := value.(type) {
+	case []yamlEntry:
+		return len(value) == 0
+	case []any:
+		return len(value) == 0
+	}
+
+	return true
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// yamlKey writes keys made of letters, digits, dashes and underscores plainly, and quotes others.
+func yamlKey(key string) string {
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return yamlQuote(key)
+		}
+	}
+
+	if key == "" {
+		return yamlQuote(key)
+	}
+
+	return key
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultListenAddress keeps tunnels and the docs server off the network.
+const defaultListenAddress = "127.0.0.1"
+
+// localPortReleaseTimeout is how long a stopped tunnel's local port may take to be released.
+const localPortReleaseTimeout = 5 * time.Second
+
+// listenAddress is the local address that tunnels, on-demand proxies and the docs server bind.
+// It is set from the configuration at startup.
+var listenAddress = defaultListenAddress
+
+// localPortOptions choose what happens when a bastion's or forward's local port is already in use.
+type localPortOptions struct {
+	autoPort bool // Use the next free port for this run
+	savePort bool // Use the next free port and save it with the bastion or forward
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (o *localPortOptions) register(flagSet *flag.FlagSet) {
+	flagSet.BoolVar(&o.autoPort, "auto-port", false, "--auto-port")
+	flagSet.BoolVar(&o.savePort, "save-port", false, "--save-port")
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// ensureLocalPortFree checks that the bastion's local port can be bound before a session is
+// started for it. When the port is taken, the next free port is used if the options allow it or
+// the user agrees, and otherwise the owner of the port is reported. Ports in reserved are
+// skipped, so that bastions started together do not pick the same port.
+func ensureLocalPortFree(bastion *Bastion, options localPortOptions, reserved map[int]bool, config *Configuration) error {
+	port, save, err := chooseLocalPort(bastion.LocalPort, fmt.Sprintf("bastion '%s'", bastion.Name), options, reserved, config)
+	if err != nil {
+		return err
+	}
+
+	bastion.LocalPort = port
+
+	if save {
+		profileInfo, exists := config.Profiles[bastion.Profile]
+
+		if saved, found := profileInfo.Bastions[bastion.Name]; exists && found {
+			saved.LocalPort = port
+			profileInfo.Bastions[bastion.Name] = saved
+
+			fmt.Printf("Saved local port %d for bastion '%s'.\n", port, bastion.Name)
+		}
+	}
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// chooseLocalPort returns the port to use in place of a local port that may be taken, and whether
+// it should be saved. owner describes what the port belongs to in messages, e.g. "bastion 'db'".
+func chooseLocalPort(port int, owner string, options localPortOptions, reserved map[int]bool, config *Configuration) (int, bool, error) {
+	if port == 0 || isLocalPortAvailable(port) {
+		return port, false, nil
+	}
+
+	user := describeLocalPortOwner(port)
+
+	// Ports saved for other bastions and forwards are skipped too, since they would clash once
+	// those start
+	skipped := configuredLocalPorts(config)
+
+	for reservedPort := range reserved {
+		skipped[reservedPort] = true
+	}
+
+	next, err := nextFreeLocalPort(port+1, skipped)
+	if err != nil {
+		return 0, false, fmt.Errorf("local port %d is already in use by %s, and %v", port, user, err)
+	}
+
+	save := options.savePort
+
+	if !options.autoPort && !options.savePort {
+		if !isInteractive() {
+			return 0, false, fmt.Errorf("local port %d of %s is already in use by %s; use --auto-port to use the next free port, or --save-port to also save it", port, owner, user)
+		}
+
+		fmt.Printf("\nLocal port %d of %s is already in use by %s.\n", port, owner, user)
+		fmt.Printf("Use local port %d instead? (y)es, (s)ave it, (n)o: ", next)
+
+		reader := bufio.NewReader(os.Stdin)
+		answer, _ := reader.ReadString('\n')
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+		case "s", "save":
+			save = true
+		default:
+			return 0, false, fmt.Errorf("local port %d is already in use", port)
+		}
+	} else {
+		fmt.Printf("\nLocal port %d of %s is already in use by %s.\n", port, owner, user)
+	}
+
+	fmt.Printf("Using local port %d for %s.\n", next, owner)
+
+	return next, save, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// ensureLocalPortsFree checks the local ports of bastions that are started together.
+func ensureLocalPortsFree(bastions []Bastion, options localPortOptions, config *Configuration) error {
+	reserved := make(map[int]bool)
+
+	for _, bastion := range bastions {
+		reserved[bastion.LocalPort] = true
+	}
+
+	for i := range bastions {
+		if err := ensureLocalPortFree(&bastions[i], options, reserved, config); err != nil {
+			return err
+		}
+
+		reserved[bastions[i].LocalPort] = true
+	}
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// configuredLocalPorts returns the local ports of all configured bastions and instance forwards.
+func configuredLocalPorts(config *Configuration) map[int]bool {
+	ports := make(map[int]bool)
+
+	for _, profileInfo := range config.Profiles {
+		for _, bastion := range profileInfo.Bastions {
+			if bastion.LocalPort != 0 {
+				ports[bastion.LocalPort] = true
+			}
+		}
+
+		for _, instance := range profileInfo.Instances {
+			for _, forward := range instance.Forwards {
+				if forward.LocalPort != 0 {
+					ports[forward.LocalPort] = true
+				}
+			}
+		}
+	}
+
+	return ports
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// nextFreeLocalPort returns the first port from startPort up that can be bound and is not
+// reserved.
+func nextFreeLocalPort(startPort int, reserved map[int]bool) (int, error) {
+	for port := startPort; port < startPort+1000; port++ {
+		if reserved[port] {
+			continue
+		}
+
+		if isLocalPortAvailable(port) {
+			return port, nil
+		}
+	}
+
+	return 0, fmt.Errorf("could not find available port starting from %d", startPort)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// waitForLocalPortRelease reports whether a local port can be bound again within the timeout,
+// once whatever listened on it has been stopped.
+func waitForLocalPortRelease(port int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+
+	for !isLocalPortAvailable(port) {
+		if time.Now().After(deadline) {
+			return false
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return true
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// describeLocalPortOwner names what is listening on a local port: one of our background tunnels,
+// or the process found by the operating system, where it can be found.
+func describeLocalPortOwner(port int) string {
+	if response, err := sendDaemonRequest(daemonRequest{Action: "status"}); err == nil {
+		for _, tunnel := range response.Tunnels {
+			if tunnel.LocalPort == port && tunnel.State == tunnelStateRunning {
+				return fmt.Sprintf("the background tunnel of bastion '%s' (profile %s, PID %d)", tunnel.Name, tunnel.Profile, tunnel.PID)
+			}
+		}
+	}
+
+	if pid, name := listeningProcess(port); pid != 0 {
+		return fmt.Sprintf("%s (PID %d)", firstNonEmpty(name, "a process"), pid)
+	}
+
+	return "another process"
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// listenAddressFor returns the configured listen address, or the loopback default.
+func listenAddressFor(config *Configuration) string {
+	if config.ListenAddress != "" {
+		return config.ListenAddress
+	}
+
+	return defaultListenAddress
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// validateListenAddress accepts IPv4 and IPv6 addresses, e.g. 127.0.0.1, ::1 or 0.0.0.0.
+func validateListenAddress(address string) error {
+	if net.ParseIP(address) == nil {
+		return fmt.Errorf("invalid listen address '%s', expected an IP address such as 127.0.0.1, ::1 or 0.0.0.0", address)
+	}
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// localAddress returns the host:port a local listener binds.
+func localAddress(port int) string {
+	return net.JoinHostPort(listenAddress, strconv.Itoa(port))
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// localHost returns the host that clients on this machine connect to: the listen address, or
+// the loopback address of the same family when listening on all interfaces.
+func localHost() string {
+	ip := net.ParseIP(listenAddress)
+
+	switch {
+	case ip == nil:
+		return defaultListenAddress
+	case ip.IsUnspecified() && ip.To4() != nil:
+		return "127.0.0.1"
+	case ip.IsUnspecified():
+		return "::1"
+	default:
+		return listenAddress
+	}
+}
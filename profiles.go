@@ -0,0 +1,202 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// profileSetFlags are the flags of 'instances find' that search several profiles at once.
+type profileSetFlags struct {
+	profiles stringListFlag
+	group    string
+	all      bool
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (f *profileSetFlags) register(flagSet *flag.FlagSet) {
+	flagSet.Var(&f.profiles, "profiles", "--profiles <profile>[,<profile> ...]")
+	flagSet.StringVar(&f.group, "profile-group", "", "--profile-group <profile group>")
+	flagSet.BoolVar(&f.all, "all-profiles", false, "--all-profiles")
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// given reports whether any of the flags was used.
+func (f *profileSetFlags) given() bool {
+	return f.all || f.group != "" || len(f.profiles) > 0
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// list returns the profiles to search: every configured profile, the profiles of a group from
+// the configuration file, or the listed profiles. Listed profiles are separated by commas or
+// given with repeated flags, and need not be configured in awsdo.
+func (f *profileSetFlags) list(config *Configuration) ([]string, error) {
+	options := 0
+
+	for _, used := range []bool{f.all, f.group != "", len(f.profiles) > 0} {
+		if used {
+			options++
+		}
+	}
+
+	if options > 1 {
+		return nil, fmt.Errorf("use only one of --profiles, --profile-group and --all-profiles")
+	}
+
+	var profiles []string
+
+	switch {
+	case f.all:
+		profiles = sortedProfileNames(config)
+
+		if len(profiles) == 0 {
+			return nil, fmt.Errorf("no profiles configured")
+		}
+	case f.group != "":
+		groupProfiles, exists := config.ProfileGroups[f.group]
+		if !exists {
+			return nil, fmt.Errorf("profile group '%s' not found", f.group)
+		}
+
+		profiles = groupProfiles
+	default:
+		for _, value := range f.profiles {
+			profiles = append(profiles, strings.Split(value, ",")...)
+		}
+	}
+
+	// Keep the order given, without blanks and duplicates
+	var unique []string
+	seen := make(map[string]bool)
+
+	for _, profile := range profiles {
+		profile = strings.TrimSpace(profile)
+
+		if profile != "" && !seen[profile] {
+			seen[profile] = true
+			unique = append(unique, profile)
+		}
+	}
+
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("no profiles to search")
+	}
+
+	return unique, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// loginProfiles logs in to each profile that does not have a valid session. Sessions are checked
+// at the same time, but logins happen one after the other since they may open a browser, and a
+// login may renew the SSO session of the profiles after it.
+func loginProfiles(profiles []string, config *Configuration) {
+	loggedIn := make([]bool, len(profiles))
+
+	forEachConcurrently(len(profiles), maxConcurrentQueries, func(i int) {
+		loggedIn[i] = isLoggedIn(profiles[i])
+	})
+
+	renewed := false
+
+	for i, profile := range profiles {
+		if loggedIn[i] || (renewed && isLoggedIn(profile)) {
+			continue
+		}
+
+		if err := login([]string{"--profile", profile}, config); err == nil {
+			renewed = true
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// findEC2InstancesInProfiles searches several profiles at the same time, in the regions the
+// flags select for each, and returns the instances in the order of the profiles. All the
+// profile and region pairs share one pool of queries. A profile that cannot be searched is
+// skipped unless none can.
+func findEC2InstancesInProfiles(profiles []string, regions regionFlags, filters []instanceFilter) ([]EC2Instance, error) {
+	profileRegions := make([][]string, len(profiles))
+	errs := make([]error, len(profiles))
+
+	forEachConcurrently(len(profiles), maxConcurrentQueries, func(i int) {
+		profileRegions[i], errs[i] = regions.list(profiles[i])
+	})
+
+	type searchQuery struct {
+		profile int
+		region  string
+	}
+
+	var queries []searchQuery
+	firstQuery := make([]int, len(profiles))
+
+	for i := range profiles {
+		firstQuery[i] = len(queries)
+
+		if errs[i] != nil {
+			continue
+		}
+
+		// Without regions, the profile's region is searched
+		if len(profileRegions[i]) == 0 {
+			queries = append(queries, searchQuery{profile: i})
+		}
+
+		for _, region := range profileRegions[i] {
+			queries = append(queries, searchQuery{profile: i, region: region})
+		}
+	}
+
+	queryResults := make([][]EC2Instance, len(queries))
+	queryErrs := make([]error, len(queries))
+
+	forEachConcurrently(len(queries), maxConcurrentQueries, func(q int) {
+		profile := profiles[queries[q].profile]
+		queryResults[q], queryErrs[q] = findEC2Instances(profile, queries[q].region, filters)
+
+		for j := range queryResults[q] {
+			queryResults[q][j].Profile = profile
+		}
+	})
+
+	results := make([][]EC2Instance, len(profiles))
+
+	for i := range profiles {
+		if errs[i] != nil {
+			continue
+		}
+
+		first := firstQuery[i]
+
+		if len(profileRegions[i]) == 0 {
+			results[i], errs[i] = queryResults[first], queryErrs[first]
+			continue
+		}
+
+		last := first + len(profileRegions[i])
+		results[i], errs[i] = mergeRegionResults(profileRegions[i], queryResults[first:last], queryErrs[first:last])
+	}
+
+	var instances []EC2Instance
+	var failed []string
+
+	for i, profile := range profiles {
+		if errs[i] != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", profile, errs[i]))
+			continue
+		}
+
+		instances = append(instances, results[i]...)
+	}
+
+	if len(failed) == len(profiles) {
+		return nil, fmt.Errorf("failed to query instances: %s", strings.Join(failed, "; "))
+	}
+
+	for _, failure := range failed {
+		fmt.Fprintf(os.Stderr, "Skipping profile %s\n", failure)
+	}
+
+	return instances, nil
+}
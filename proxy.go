@@ -0,0 +1,543 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultProxyIdleTimeout = 5 * time.Minute
+	proxySessionTimeout     = 30 * time.Second
+	proxyStatsInterval      = 2 * time.Second
+)
+
+// tunnelStats are the state and, for on-demand tunnels, the traffic counters of a tunnel.
+// Background tunnels write them to a file that the daemon reads for 'bastion status' and
+// 'bastion up --wait'.
+type tunnelStats struct {
+	Ready       bool  `json:"ready"`       // The local port accepts connections
+	OnDemand    bool  `json:"onDemand"`    // The counters below are kept
+	Connections int64 `json:"connections"` // Connections accepted since the tunnel started
+	Active      int64 `json:"active"`      // Connections currently open
+	BytesIn     int64 `json:"bytesIn"`     // Bytes received from the remote host
+	BytesOut    int64 `json:"bytesOut"`    // Bytes sent to the remote host
+	Sessions    int64 `json:"sessions"`    // SSM sessions started
+	SessionUp   bool  `json:"sessionUp"`
+}
+
+// tunnelProxy listens on a bastion's local port and only keeps an SSM session open while clients
+// are connected. The session forwards an internal port that the proxy relays connections to.
+type tunnelProxy struct {
+	bastion     Bastion
+	profile     string
+	idleTimeout time.Duration
+	statsFile   string
+
+	connections atomic.Int64
+	active      atomic.Int64
+	bytesIn     atomic.Int64
+	bytesOut    atomic.Int64
+	sessions    atomic.Int64
+
+	mu          sync.Mutex
+	process     AWSProcess
+	sessionPort int
+	sessionDone chan struct{}
+	starting    *proxySessionStart
+	idleTimer   *time.Timer
+}
+
+// proxySessionStart is a session being started, which connections made meanwhile wait for.
+type proxySessionStart struct {
+	done chan struct{}
+	port int
+	err  error
+}
+
+// sessionReadyWriter passes the console output of a session through and closes ready once the
+// session waits for connections, which session-manager-plugin and the built-in client both
+// report. Unlike probing the port, this does not use up a forwarded connection.
+type sessionReadyWriter struct {
+	writer io.Writer
+	ready  chan struct{}
+	mu     sync.Mutex
+	tail   []byte
+}
+
+// sessionReadyMessage is printed by the session once its local port accepts connections.
+const sessionReadyMessage = "Waiting for connections"
+
+// countingWriter adds the number of bytes written to each of its counters.
+type countingWriter struct {
+	writer   io.Writer
+	counters []*atomic.Int64
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (w countingWriter) Write(data []byte) (int, error) {
+	count, err := w.writer.Write(data)
+
+	for _, counter := range w.counters {
+		counter.Add(int64(count))
+	}
+
+	return count, err
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func newSessionReadyWriter(writer io.Writer) *sessionReadyWriter {
+	return &sessionReadyWriter{writer: writer, ready: make(chan struct{})}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (w *sessionReadyWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+
+	if !w.isReady() {
+		// Keep the end of the previous write, in case the message is split across writes
+		w.tail = append(w.tail, data...)
+
+		if bytes.Contains(w.tail, []byte(sessionReadyMessage)) {
+			close(w.ready)
+			w.tail = nil
+		} else if len(w.tail) > len(sessionReadyMessage) {
+			w.tail = w.tail[len(w.tail)-len(sessionReadyMessage):]
+		}
+	}
+
+	w.mu.Unlock()
+
+	return w.writer.Write(data)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (w *sessionReadyWriter) isReady() bool {
+	select {
+	case <-w.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// runTunnelProxy serves the bastion's local port until Ctrl-C is pressed, starting the session
+// when the first client connects and closing it once no client has been connected for the idle
+// timeout.
+func runTunnelProxy(bastion Bastion, profile string, idleTimeout time.Duration, statsFile string, signalChan chan os.Signal) error {
+	listener, err := net.Listen("tcp", localAddress(bastion.LocalPort))
+	if err != nil {
+		return fmt.Errorf("unable to listen on local port %d: %v", bastion.LocalPort, err)
+	}
+
+	proxy := &tunnelProxy{
+		bastion:     bastion,
+		profile:     profile,
+		idleTimeout: idleTimeout,
+		statsFile:   statsFile,
+	}
+
+	fmt.Printf("\nListening on %s for %s:%d via bastion %s.\n", localAddress(bastion.LocalPort), bastion.Host, bastion.Port, bastion.Instance)
+	fmt.Printf("The session starts on the first connection and closes after %s without connections.\n", idleTimeout)
+	fmt.Println("Press Ctrl-C to stop the tunnel and return to the REPL.")
+
+	stopped := make(chan struct{})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go proxy.handle(conn)
+		}
+	}()
+
+	if statsFile != "" {
+		go func() {
+			ticker := time.NewTicker(proxyStatsInterval)
+			defer ticker.Stop()
+
+			for {
+				proxy.writeStats()
+
+				select {
+				case <-stopped:
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+
+	<-signalChan
+	close(stopped)
+
+	fmt.Println("\nStopping bastion tunnel...")
+	listener.Close()
+
+	// A session that is still starting is stopped once it is up
+	proxy.mu.Lock()
+	start := proxy.starting
+	proxy.mu.Unlock()
+
+	if start != nil {
+		<-start.done
+	}
+
+	proxy.stopSession()
+
+	stats := proxy.snapshot()
+	fmt.Printf("Served %d connection(s) over %d session(s): %s received, %s sent.\n", stats.Connections, stats.Sessions, formatBytes(stats.BytesIn), formatBytes(stats.BytesOut))
+
+	proxy.writeStats()
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// tunnelIdleTimeout picks the idle timeout from the command line, then the bastion, then the
+// default.
+func tunnelIdleTimeout(bastion Bastion, override time.Duration) time.Duration {
+	if override > 0 {
+		return override
+	}
+
+	if bastion.IdleTimeout > 0 {
+		return time.Duration(bastion.IdleTimeout) * time.Second
+	}
+
+	return defaultProxyIdleTimeout
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// handle relays one client connection through the session, starting the session if needed.
+func (p *tunnelProxy) handle(conn net.Conn) {
+	defer conn.Close()
+
+	p.connectionOpened()
+	defer p.connectionClosed()
+
+	port, err := p.ensureSession()
+	if err != nil {
+		fmt.Printf("\nUnable to open the tunnel for %s: %v\n", conn.RemoteAddr(), err)
+		return
+	}
+
+	remote, err := net.Dial("tcp", net.JoinHostPort(localHost(), strconv.Itoa(port)))
+	if err != nil {
+		fmt.Printf("\nUnable to reach the session for %s: %v\n", conn.RemoteAddr(), err)
+		return
+	}
+	defer remote.Close()
+
+	var bytesIn, bytesOut atomic.Int64
+	copied := make(chan struct{}, 2)
+
+	go func() {
+		io.Copy(countingWriter{writer: remote, counters: []*atomic.Int64{&bytesOut, &p.bytesOut}}, conn)
+		copied <- struct{}{}
+	}()
+
+	go func() {
+		io.Copy(countingWriter{writer: conn, counters: []*atomic.Int64{&bytesIn, &p.bytesIn}}, remote)
+		copied <- struct{}{}
+	}()
+
+	// Either side closing ends the connection
+	<-copied
+	conn.Close()
+	remote.Close()
+	<-copied
+
+	fmt.Printf("\nConnection from %s closed: %s received, %s sent.\n", conn.RemoteAddr(), formatBytes(bytesIn.Load()), formatBytes(bytesOut.Load()))
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// ensureSession returns the internal port of the running session, starting one if there is none.
+// Connections made while a session starts wait for that session instead of starting another.
+func (p *tunnelProxy) ensureSession() (int, error) {
+	p.mu.Lock()
+
+	if p.process != nil {
+		port := p.sessionPort
+		p.mu.Unlock()
+
+		return port, nil
+	}
+
+	start := p.starting
+	if start != nil {
+		p.mu.Unlock()
+		<-start.done
+
+		return start.port, start.err
+	}
+
+	start = &proxySessionStart{done: make(chan struct{})}
+	p.starting = start
+	p.mu.Unlock()
+
+	// The session is started without holding the lock, so that connections and the idle timer
+	// are not held up for as long as it takes to come up
+	start.port, start.err = p.startSession()
+
+	p.mu.Lock()
+	p.starting = nil
+	p.mu.Unlock()
+
+	close(start.done)
+
+	return start.port, start.err
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// startSession starts a session forwarding a free internal port and waits until it accepts
+// connections. Only ensureSession calls it, one at a time.
+func (p *tunnelProxy) startSession() (int, error) {
+	port, err := freeLocalPort()
+	if err != nil {
+		return 0, err
+	}
+
+	if !isLoggedIn(p.profile) {
+		return 0, fmt.Errorf("the AWS session for profile '%s' has expired, log in with 'awsdo login'", p.profile)
+	}
+
+	// The instance may have been replaced since the last session
+	if err := refreshBastionInstance(&p.bastion, p.profile, nil); err != nil {
+		return 0, err
+	}
+
+	fmt.Printf("\nStarting port forwarding session to %s:%d via bastion %s...\n", p.bastion.Host, p.bastion.Port, p.bastion.Instance)
+
+	// The session's output is watched for the message that its port is open
+	readyWriter := newSessionReadyWriter(sessionOutput)
+	previousOutput := sessionOutput
+	sessionOutput = readyWriter
+
+	process, err := startPortForwardingSession(p.bastion, p.profile, port)
+	sessionOutput = previousOutput
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to start session: %v", err)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		err := process.Wait()
+
+		p.mu.Lock()
+		if p.process == process {
+			p.process = nil
+		}
+		p.mu.Unlock()
+
+		if err != nil {
+			fmt.Printf("\nSession ended: %v\n", err)
+		} else {
+			fmt.Println("\nSession ended.")
+		}
+
+		close(done)
+	}()
+
+	select {
+	case <-readyWriter.ready:
+	case <-done:
+		return 0, fmt.Errorf("the session ended before it opened its port")
+	case <-time.After(proxySessionTimeout):
+		process.Kill()
+		return 0, fmt.Errorf("the session did not open its port within %s", proxySessionTimeout)
+	}
+
+	p.mu.Lock()
+	p.process = process
+	p.sessionPort = port
+	p.sessionDone = done
+	p.mu.Unlock()
+
+	p.sessions.Add(1)
+
+	fmt.Printf("\nTunnel ready: %s -> %s:%d\n", localAddress(p.bastion.LocalPort), p.bastion.Host, p.bastion.Port)
+
+	return port, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (p *tunnelProxy) connectionOpened() {
+	p.connections.Add(1)
+	p.active.Add(1)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.idleTimer != nil {
+		p.idleTimer.Stop()
+		p.idleTimer = nil
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// connectionClosed starts the idle timer when the last client disconnects.
+func (p *tunnelProxy) connectionClosed() {
+	if p.active.Add(-1) > 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.idleTimer != nil {
+		p.idleTimer.Stop()
+	}
+
+	p.idleTimer = time.AfterFunc(p.idleTimeout, p.closeIdleSession)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// closeIdleSession ends the session when the idle timer fires, unless a client connected
+// meanwhile. The check and the detach happen under one lock, which connectionOpened also takes,
+// so a client either keeps the session or gets a new one from ensureSession.
+func (p *tunnelProxy) closeIdleSession() {
+	p.mu.Lock()
+
+	if p.active.Load() > 0 || p.process == nil {
+		p.mu.Unlock()
+		return
+	}
+
+	process, done := p.detachSession()
+	p.mu.Unlock()
+
+	fmt.Printf("\nNo connections for %s, closing the session.\n", p.idleTimeout)
+
+	process.Kill()
+	<-done
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// stopSession ends the running session, if any, and waits for it to finish.
+func (p *tunnelProxy) stopSession() {
+	p.mu.Lock()
+	process, done := p.detachSession()
+	p.mu.Unlock()
+
+	if process != nil {
+		process.Kill()
+		<-done
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// detachSession marks the running session as stopping, so that ensureSession starts a new one
+// rather than hand out its port, and returns it for the caller to end. The caller holds p.mu.
+func (p *tunnelProxy) detachSession() (AWSProcess, chan struct{}) {
+	process, done := p.process, p.sessionDone
+	p.process = nil
+
+	if p.idleTimer != nil {
+		p.idleTimer.Stop()
+		p.idleTimer = nil
+	}
+
+	return process, done
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (p *tunnelProxy) snapshot() tunnelStats {
+	p.mu.Lock()
+	sessionUp := p.process != nil
+	p.mu.Unlock()
+
+	// The proxy accepts connections for as long as it runs, starting a session when needed
+	return tunnelStats{
+		Ready:       true,
+		OnDemand:    true,
+		Connections: p.connections.Load(),
+		Active:      p.active.Load(),
+		BytesIn:     p.bytesIn.Load(),
+		BytesOut:    p.bytesOut.Load(),
+		Sessions:    p.sessions.Load(),
+		SessionUp:   sessionUp,
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (p *tunnelProxy) writeStats() {
+	writeTunnelStats(p.statsFile, p.snapshot())
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// writeTunnelStats writes a background tunnel's stats for the daemon. Tunnels in the foreground
+// have no stats file.
+func writeTunnelStats(fileName string, stats tunnelStats) {
+	if fileName == "" {
+		return
+	}
+
+	statsBytes, _ := json.Marshal(stats)
+	os.WriteFile(fileName, statsBytes, 0600)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// readTunnelStats reads the stats written by a background tunnel.
+func readTunnelStats(fileName string) (tunnelStats, error) {
+	var stats tunnelStats
+
+	statsBytes, err := os.ReadFile(fileName)
+	if err != nil {
+		return stats, err
+	}
+
+	err = json.Unmarshal(statsBytes, &stats)
+	return stats, err
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// freeLocalPort asks the operating system for an unused loopback port.
+func freeLocalPort() (int, error) {
+	listener, err := net.Listen("tcp", localAddress(0))
+	if err != nil {
+		return 0, fmt.Errorf("could not find a free local port: %v", err)
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	return port, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func formatBytes(count int64) string {
+	const unit = 1024
+
+	if count < unit {
+		return fmt.Sprintf("%d B", count)
+	}
+
+	value := float64(count)
+	suffixes := []string{"KB", "MB", "GB", "TB"}
+	suffix := ""
+
+	for _, next := range suffixes {
+		value /= unit
+		suffix = next
+
+		if value < unit {
+			break
+		}
+	}
+
+	return fmt.Sprintf("%.1f %s", value, suffix)
+}
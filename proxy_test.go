@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// newTestTunnelProxy returns an on-demand tunnel whose sessions are started by a FakeRunner and
+// report that they wait for connections straight away.
+func newTestTunnelProxy(t *testing.T, idleTimeout time.Duration) (*tunnelProxy, *FakeRunner) {
+	fake := useFakeRunner(t)
+	fake.Respond("sts get-caller-identity", `{"Account": "123456789012"}`)
+	fake.Respond("ssm start-session", "Waiting for connections...\n")
+
+	previousOutput := sessionOutput
+	sessionOutput = io.Discard
+	t.Cleanup(func() { sessionOutput = previousOutput })
+
+	proxy := &tunnelProxy{
+		bastion:     Bastion{Name: "db", Instance: "i-0001", Host: "db.internal", Port: 5432},
+		profile:     "dev",
+		idleTimeout: idleTimeout,
+	}
+
+	return proxy, fake
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// Once the last client disconnects and the idle timeout passes, the session process is ended
+// rather than only forgotten.
+func TestTunnelProxyEndsIdleSession(t *testing.T) {
+	proxy, fake := newTestTunnelProxy(t, 10*time.Millisecond)
+
+	proxy.connectionOpened()
+
+	if _, err := proxy.ensureSession(); err != nil {
+		t.Fatalf("ensureSession: %v", err)
+	}
+
+	processes := fake.Processes()
+	if len(processes) != 1 {
+		t.Fatalf("started %d sessions, want 1", len(processes))
+	}
+
+	proxy.connectionClosed()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !processes[0].Ended() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if !processes[0].Ended() {
+		t.Fatalf("the idle session is still running")
+	}
+
+	if proxy.snapshot().SessionUp {
+		t.Errorf("the proxy still reports the session as up")
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// A background tunnel reports that it is ready once its session says it waits for connections,
+// without connecting to the local port, and stops reporting it once the session ends.
+func TestRunTunnelSessionReportsReady(t *testing.T) {
+	newTestTunnelProxy(t, time.Minute)
+
+	statsFile := filepath.Join(t.TempDir(), "db.stats.json")
+	signalChan := make(chan os.Signal, 1)
+	finished := make(chan struct{})
+
+	go func() {
+		runTunnelSession(Bastion{Name: "db", Instance: "i-0001", Host: "db.internal", Port: 5432, LocalPort: 15432}, "dev", statsFile, signalChan)
+		close(finished)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if stats, err := readTunnelStats(statsFile); err == nil && stats.Ready {
+			break
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if stats, err := readTunnelStats(statsFile); err != nil || !stats.Ready {
+		t.Fatalf("stats = %+v (%v), want the tunnel ready", stats, err)
+	}
+
+	signalChan <- os.Interrupt
+	<-finished
+
+	if stats, _ := readTunnelStats(statsFile); stats.Ready {
+		t.Errorf("the stopped tunnel still reports that it is ready")
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// An idle timer that fires just as a client connects leaves the session to that client, and a
+// client connecting just after the session was closed gets a new one.
+func TestTunnelProxyIdleTimerRace(t *testing.T) {
+	proxy, fake := newTestTunnelProxy(t, time.Hour)
+
+	proxy.connectionOpened()
+
+	if _, err := proxy.ensureSession(); err != nil {
+		t.Fatalf("ensureSession: %v", err)
+	}
+
+	proxy.connectionClosed()
+	proxy.connectionOpened()
+	proxy.closeIdleSession()
+
+	if first := fake.Processes()[0]; first.Ended() {
+		t.Fatalf("the idle timer closed the session of a connected client")
+	}
+
+	proxy.connectionClosed()
+	proxy.closeIdleSession()
+
+	if first := fake.Processes()[0]; !first.Ended() {
+		t.Fatalf("the idle session is still running")
+	}
+
+	proxy.connectionOpened()
+	defer proxy.stopSession()
+
+	if _, err := proxy.ensureSession(); err != nil {
+		t.Fatalf("ensureSession: %v", err)
+	}
+
+	if processes := fake.Processes(); len(processes) != 2 || processes[1].Ended() {
+		t.Errorf("a client connecting after the idle timeout did not get a new session")
+	}
+}
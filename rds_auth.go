@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rdsAuthTokenLifetime is how long RDS accepts an IAM authentication token.
+const rdsAuthTokenLifetime = 15 * time.Minute
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// generateRDSAuthToken presigns an rds-db:connect request for a database user. The token is the
+// presigned URL without its scheme and is used as the password. It is computed offline.
+func generateRDSAuthToken(host string, port int, region string, user string, creds awsCredentials, now time.Time) string {
+	endpoint := &url.URL{
+		Scheme:   "https",
+		Host:     net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:     "/",
+		RawQuery: url.Values{"Action": {"connect"}, "DBUser": {user}}.Encode(),
+	}
+
+	signed := presignURL("GET", endpoint, creds, "rds-db", region, rdsAuthTokenLifetime, now)
+
+	return strings.TrimPrefix(signed.String(), "https://")
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// rdsEndpointRegion returns the region in an RDS endpoint such as
+// mydb.abc123.eu-west-1.rds.amazonaws.com, or an empty string for other host names.
+func rdsEndpointRegion(host string) string {
+	labels := strings.Split(strings.ToLower(host), ".")
+
+	for i := 1; i+1 < len(labels); i++ {
+		if labels[i+1] == "rds" {
+			return labels[i]
+		}
+	}
+
+	return ""
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// bastionAuthToken generates an IAM authentication token for the bastion's database with the
+// profile's credentials. Without a region, the one in the endpoint, the bastion's or the
+// profile's is used.
+func bastionAuthToken(profile string, bastion Bastion, user string, region string) (string, error) {
+	if bastion.Host == "" || bastion.Port == 0 {
+		return "", fmt.Errorf("bastion '%s' has no remote host and port", bastion.Name)
+	}
+
+	if region == "" {
+		region = firstNonEmpty(rdsEndpointRegion(bastion.Host), bastion.Region)
+	}
+
+	if region == "" {
+		settings, err := loadAWSProfile(profile)
+		if err != nil {
+			return "", err
+		}
+
+		if region, err = resolveRegion("", settings); err != nil {
+			return "", fmt.Errorf("%v, or pass --region", err)
+		}
+	}
+
+	creds, err := queryProfileCredentials(profile)
+	if err != nil {
+		return "", err
+	}
+
+	return generateRDSAuthToken(bastion.Host, bastion.Port, region, user, creds, time.Now()), nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// bastionToken prints an IAM authentication token for the bastion's database.
+func bastionToken(args []string, config *Configuration) error {
+	flagSet := flag.NewFlagSet("bastion token", flag.ContinueOnError)
+	profile := flagSet.String("profile", "", "--profile <aws cli profile>")
+	profileShort := flagSet.String("p", "", "--profile <aws cli profile>")
+	user := flagSet.String("user", "", "--user <database user>")
+	region := flagSet.String("region", "", "--region <aws region>")
+
+	flagSet.Usage = func() {
+		fmt.Println("USAGE:\n    awsdo bastion token [--profile <aws cli profile>] --user <database user>")
+		fmt.Println("                    [--region <aws region>] [<bastion name>]")
+	}
+
+	positional, err := parseFlags(flagSet, args)
+	if err != nil {
+		return nil
+	}
+
+	if *user == "" {
+		flagSet.Usage()
+		return nil
+	}
+
+	bastionName := ""
+	if len(positional) > 0 {
+		bastionName = positional[0]
+	}
+
+	bastion, currentProfile, err := resolveBastion(config, profile, profileShort, bastionName)
+	if err != nil {
+		return err
+	}
+
+	bastionProfile := currentProfile
+	if bastion.Profile != "" {
+		bastionProfile = bastion.Profile
+	}
+
+	// Ensure that we're logged in before running the command
+	if !isLoggedIn(bastionProfile) {
+		if err := login([]string{"--profile", bastionProfile}, config); err != nil {
+			return err
+		}
+	}
+
+	token, err := bastionAuthToken(bastionProfile, bastion, *user, *region)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(token)
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// The expected token is the one botocore's generate_db_auth_token produces for the same inputs
+// in its own tests.
+func TestGenerateRDSAuthToken(t *testing.T) {
+	creds := awsCredentials{AccessKeyID: "akid", SecretAccessKey: "skid"}
+	now := time.Date(2016, 11, 7, 17, 39, 33, 0, time.UTC)
+
+	token := generateRDSAuthToken("prod-instance.us-east-1.rds.amazonaws.com", 3306, "us-east-1", "someusername", creds, now)
+
+	expected := "prod-instance.us-east-1.rds.amazonaws.com:3306/?Action=connect" +
+		"&DBUser=someusername&X-Amz-Algorithm=AWS4-HMAC-SHA256" +
+		"&X-Amz-Date=20161107T173933Z&X-Amz-SignedHeaders=host" +
+		"&X-Amz-Expires=900&X-Amz-Credential=akid%2F20161107%2F" +
+		"us-east-1%2Frds-db%2Faws4_request&X-Amz-Signature" +
+		"=d1138cdbc0ca63eec012ec0fc6c2267e03642168f5884a7795320d4c18374c61"
+
+	got, err := url.Parse("https://" + token)
+	if err != nil {
+		t.Fatalf("token is not a URL: %v", err)
+	}
+
+	want, _ := url.Parse("https://" + expected)
+
+	// The order of the query parameters does not matter
+	if got.Host != want.Host || got.Path != want.Path {
+		t.Errorf("token = %s, want %s", token, expected)
+	}
+
+	wantQuery := want.Query()
+	gotQuery := got.Query()
+
+	if len(gotQuery) != len(wantQuery) {
+		t.Errorf("token parameters = %v, want %v", gotQuery, wantQuery)
+	}
+
+	for name := range wantQuery {
+		if gotQuery.Get(name) != wantQuery.Get(name) {
+			t.Errorf("%s = %q, want %q", name, gotQuery.Get(name), wantQuery.Get(name))
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestRDSEndpointRegion(t *testing.T) {
+	tests := map[string]string{
+		"mydb.abc123.eu-west-1.rds.amazonaws.com":          "eu-west-1",
+		"users.cluster-ro-abc.us-east-1.rds.amazonaws.com": "us-east-1",
+		"proxy.proxy-abc.ap-south-1.rds.amazonaws.com.cn":  "ap-south-1",
+		"db.internal": "",
+		"master.sessions.abc.use1.cache.amazonaws.com": "",
+	}
+
+	for host, region := range tests {
+		if got := rdsEndpointRegion(host); got != region {
+			t.Errorf("rdsEndpointRegion(%q) = %q, want %q", host, got, region)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// maxConcurrentQueries bounds the regions or profiles that are queried at the same time.
+const maxConcurrentQueries = 8
+
+// regionFlags are the --region and --all-regions flags of commands that look for instances.
+type regionFlags struct {
+	regions stringListFlag
+	all     bool
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (f *regionFlags) register(flagSet *flag.FlagSet) {
+	flagSet.Var(&f.regions, "region", "--region <region>")
+	flagSet.BoolVar(&f.all, "all-regions", false, "--all-regions")
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// given reports whether any region flag was used.
+func (f *regionFlags) given() bool {
+	return f.all || len(f.regions) > 0
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// list returns the regions to search: the --region values, or every region enabled for the
+// account with --all-regions.
+func (f *regionFlags) list(profile string) ([]string, error) {
+	if !f.all {
+		return f.regions, nil
+	}
+
+	return queryRegions(profile)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// single returns the region given with --region, or an empty string for the profile's region,
+// for commands that work in one region.
+func (f *regionFlags) single() (string, error) {
+	if f.all || len(f.regions) > 1 {
+		return "", fmt.Errorf("this command works in one region, give a single --region")
+	}
+
+	if len(f.regions) == 0 {
+		return "", nil
+	}
+
+	return f.regions[0], nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// regionArgs returns the --region option for a command, or nothing for the profile's region.
+func regionArgs(region string) []string {
+	if region == "" {
+		return nil
+	}
+
+	return []string{"--region", region}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// queryRegions returns the regions enabled for the profile's account, in sorted order.
+func queryRegions(profile string) ([]string, error) {
+	output, err := awsRunner.Output(profile, "ec2", "describe-regions", "--output=json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query regions: %v", err)
+	}
+
+	var document ec2DescribeRegionsOutput
+	if err := json.Unmarshal(output, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse region list: %v", err)
+	}
+
+	regions := make([]string, 0, len(document.Regions))
+
+	for _, region := range document.Regions {
+		regions = append(regions, region.RegionName)
+	}
+
+	if len(regions) == 0 {
+		return nil, fmt.Errorf("no regions found for profile '%s'", profile)
+	}
+
+	sort.Strings(regions)
+
+	return regions, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// findEC2InstancesInRegions searches several regions at the same time and returns the instances
+// in the order of the regions. Without regions, the profile's region is searched.
+func findEC2InstancesInRegions(profile string, regions []string, filters []instanceFilter) ([]EC2Instance, error) {
+	if len(regions) == 0 {
+		return findEC2Instances(profile, "", filters)
+	}
+
+	results := make([][]EC2Instance, len(regions))
+	errs := make([]error, len(regions))
+
+	forEachConcurrently(len(regions), maxConcurrentQueries, func(i int) {
+		results[i], errs[i] = findEC2Instances(profile, regions[i], filters)
+	})
+
+	return mergeRegionResults(regions, results, errs)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// mergeRegionResults joins the instances found in each region, in the order of the regions. The
+// search fails only when every region failed; otherwise failed regions are reported and skipped.
+func mergeRegionResults(regions []string, results [][]EC2Instance, errs []error) ([]EC2Instance, error) {
+	var instances []EC2Instance
+	var failed []string
+
+	for i, region := range regions {
+		if errs[i] != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", region, errs[i]))
+			continue
+		}
+
+		instances = append(instances, results[i]...)
+	}
+
+	// A region that is not enabled for the account should not hide the others
+	if len(failed) == len(regions) {
+		return nil, fmt.Errorf("failed to query instances: %s", strings.Join(failed, "; "))
+	}
+
+	for _, failure := range failed {
+		fmt.Fprintf(os.Stderr, "Skipping region %s\n", failure)
+	}
+
+	return instances, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// locateInstanceRegion returns the region an instance lives in, out of the given regions. A
+// single region is taken as given.
+func locateInstanceRegion(profile string, instanceID string, regions []string) (string, error) {
+	if len(regions) == 1 {
+		return regions[0], nil
+	}
+
+	filters := []instanceFilter{{name: "instance-id", pattern: instanceID}}
+
+	instances, err := findEC2InstancesInRegions(profile, regions, filters)
+	if err != nil {
+		return "", err
+	}
+
+	if len(instances) == 0 {
+		return "", fmt.Errorf("instance %s not found in regions %s", instanceID, strings.Join(regions, ", "))
+	}
+
+	return instances[0].Region, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// updateInstanceRegion finds which of the flags' regions the instance lives in, and saves it with
+// the configured instance.
+func updateInstanceRegion(instance *Instance, profile string, regions regionFlags, config *Configuration) error {
+	searchRegions, err := regions.list(profile)
+	if err != nil {
+		return err
+	}
+
+	region, err := locateInstanceRegion(profile, instance.ID, searchRegions)
+	if err != nil {
+		return err
+	}
+
+	instance.Region = region
+
+	if saved, exists := config.Profiles[profile].Instances[instance.Name]; exists && saved.Region != region {
+		saved.Region = region
+		config.Profiles[profile].Instances[instance.Name] = saved
+
+		fmt.Printf("Saved region %s for instance '%s'.\n", region, instance.Name)
+	}
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// updateBastionRegion finds which of the flags' regions the bastion's instance lives in, and
+// saves it with the bastion. A bastion with an instance resolver takes a single region as given,
+// since its saved instance may be gone.
+func updateBastionRegion(bastion *Bastion, profile string, regions regionFlags, config *Configuration) error {
+	searchRegions, err := regions.list(profile)
+	if err != nil {
+		return err
+	}
+
+	var region string
+
+	if bastion.InstanceResolver != nil && len(searchRegions) > 1 {
+		region, err = locateResolverRegion(profile, bastion.InstanceResolver, searchRegions)
+	} else {
+		region, err = locateInstanceRegion(profile, bastion.Instance, searchRegions)
+	}
+
+	if err != nil {
+		return fmt.Errorf("bastion '%s': %v", bastion.Name, err)
+	}
+
+	bastion.Region = region
+
+	if profileInfo, exists := config.Profiles[profile]; exists {
+		if saved, exists := profileInfo.Bastions[bastion.Name]; exists && saved.Region != region {
+			saved.Region = region
+			profileInfo.Bastions[bastion.Name] = saved
+
+			fmt.Printf("Saved region %s for bastion '%s'.\n", region, bastion.Name)
+		}
+	}
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// locateResolverRegion returns the first of the regions with an instance the resolver finds.
+func locateResolverRegion(profile string, resolver *InstanceResolver, regions []string) (string, error) {
+	for _, region := range regions {
+		if _, err := resolveInstance(profile, region, resolver); err == nil {
+			return region, nil
+		}
+	}
+
+	return "", fmt.Errorf("no instance matching %s found in regions %s", resolver, strings.Join(regions, ", "))
+}
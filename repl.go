@@ -488,8 +488,14 @@ func startREPL(configFile string, config *Configuration) {
 			return
 		}
 
-		// Execute command
-		executeREPLCommand(command, args[1:], config)
+		// Execute command, with the output format given on its line
+		commandArgs, format, err := extractOutputOption(args[1:])
+		if err != nil {
+			fmt.Printf("\nError: %v\n\n", err)
+		} else {
+			outputFormat = format
+			executeREPLCommand(command, commandArgs, config)
+		}
 
 		// Save configuration after successful command
 		saveConfiguration(configFile, config)
@@ -521,7 +527,9 @@ func executeREPLCommand(command string, args []string, config *Configuration) {
 		login(args, config)
 	case "instances":
 		if len(args) < 1 {
-			listInstances(args, config)
+			if err := listInstances(args, config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
 			return
 		}
 
@@ -529,9 +537,13 @@ func executeREPLCommand(command string, args []string, config *Configuration) {
 
 		switch subcommand {
 		case "find":
-			findInstances(args[1:], config)
+			if err := findInstances(args[1:], config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
 		case "list", "ls":
-			listInstances(args[1:], config)
+			if err := listInstances(args[1:], config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
 		case "add":
 			addInstance(args[1:], config)
 		case "update":
@@ -544,12 +556,20 @@ func executeREPLCommand(command string, args []string, config *Configuration) {
 		}
 	case "terminal":
 		startSSMSession(args, config)
+	case "forward":
+		if err := forwardCommand(args, config); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
 	case "bastion":
-		startBastionTunnel(args, config)
+		if err := bastionCommand(args, config); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
 	case "bastions":
 		if len(args) < 1 {
 			// Default to 'list' if no subcommand provided
-			listBastions(args, config)
+			if err := listBastions(args, config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
 			return
 		}
 
@@ -557,17 +577,53 @@ func executeREPLCommand(command string, args []string, config *Configuration) {
 
 		switch subcommand {
 		case "list", "ls":
-			listBastions(args[1:], config)
+			if err := listBastions(args[1:], config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
 		case "add":
-			addBastion(args[1:], config)
+			if err := addBastion(args[1:], config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
 		case "update", "up":
-			updateBastion(args[1:], config)
+			if err := updateBastion(args[1:], config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
 		case "remove", "rm":
-			removeBastion(args[1:], config)
+			if err := removeBastion(args[1:], config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+		case "reconnect":
+			if err := reconnectBastion(args[1:], config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+		case "discovery":
+			if err := bastionDiscovery(args[1:], config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+		case "secret":
+			if err := bastionSecret(args[1:], config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+		case "group", "groups":
+			if err := tunnelGroupCommand(args[1:], config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+		case "export":
+			if err := exportBastions(args[1:], config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
 		default:
 			fmt.Printf("Invalid bastions subcommand: %s\n", subcommand)
 			fmt.Println("Use 'bastions list' to list bastions, 'bastions add' to add a new bastion, 'bastions update' to update an existing bastion, or 'bastions remove' to remove a bastion.")
 		}
+	case "db":
+		if err := bastionCommand(append([]string{"--connect"}, args...), config); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	case "backend":
+		if err := backendCommand(args, config); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
 	case "docs":
 		showDocs()
 	case "clear", "cls", "clr", ".c":
@@ -580,9 +636,13 @@ func executeREPLCommand(command string, args []string, config *Configuration) {
 		object := strings.ToLower(args[0])
 		switch object {
 		case "instances", "instance":
-			listInstances(args[1:], config)
+			if err := listInstances(args[1:], config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
 		case "bastions", "bastion":
-			listBastions(args[1:], config)
+			if err := listBastions(args[1:], config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
 		default:
 			fmt.Printf("Invalid object: %s\n", object)
 			fmt.Println("Use 'ls instances' or 'ls bastions'")
@@ -611,7 +671,9 @@ func executeREPLCommand(command string, args []string, config *Configuration) {
 		case "instance", "instances":
 			removeInstance(args[1:], config)
 		case "bastion", "bastions":
-			removeBastion(args[1:], config)
+			if err := removeBastion(args[1:], config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
 		default:
 			fmt.Printf("Invalid object: %s\n", object)
 			fmt.Println("Use 'rm instance' or 'rm bastion'")
@@ -623,7 +685,9 @@ func executeREPLCommand(command string, args []string, config *Configuration) {
 		object := strings.ToLower(args[0])
 		switch object {
 		case "instance", "instances":
-			findInstances(args[1:], config)
+			if err := findInstances(args[1:], config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
 		default:
 			fmt.Printf("Invalid object: %s\n", object)
 			fmt.Println("Use 'find instance'")
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// instanceCacheFile is the configuration file that refreshed bastion instances are written to as
+// soon as they change. Only the tunnel daemon sets it, since it runs until it is stopped and its
+// configuration is never saved on exit.
+var instanceCacheFile string
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// refreshBastionInstance makes sure that a bastion with an instance resolver points at a running
+// instance that is online in SSM. The saved instance ID is a cache: it is kept while it still
+// matches, and replaced by the newest matching instance once it does not. The new ID is stored
+// in the configuration when one is given, and written to instanceCacheFile when it is set.
+// Bastions with a fixed instance are left alone.
+func refreshBastionInstance(bastion *Bastion, profile string, config *Configuration) error {
+	resolver := bastion.InstanceResolver
+	if resolver == nil {
+		return nil
+	}
+
+	if bastion.Instance != "" {
+		usable, err := instanceMatchesResolver(profile, bastion.Region, bastion.Instance, resolver)
+		if err != nil {
+			return fmt.Errorf("failed to check bastion instance %s: %v", bastion.Instance, err)
+		}
+
+		if usable {
+			return nil
+		}
+	}
+
+	instance, err := resolveInstance(profile, bastion.Region, resolver)
+	if err != nil {
+		return fmt.Errorf("bastion '%s': %v", bastion.Name, err)
+	}
+
+	if bastion.Instance != "" {
+		fmt.Printf("Bastion instance %s is no longer available, using %s (%s) instead.\n", bastion.Instance, instance.Instance, instance.Name)
+	} else {
+		fmt.Printf("Using bastion instance %s (%s).\n", instance.Instance, instance.Name)
+	}
+
+	bastion.Instance = instance.Instance
+
+	// Cache the instance so that the next connection does not have to search for it
+	if config != nil {
+		if profileInfo, exists := config.Profiles[profile]; exists {
+			if saved, exists := profileInfo.Bastions[bastion.Name]; exists {
+				saved.Instance = instance.Instance
+				profileInfo.Bastions[bastion.Name] = saved
+
+				if instanceCacheFile != "" {
+					if err := saveBastionInstance(instanceCacheFile, profile, bastion.Name, instance.Instance); err != nil {
+						fmt.Printf("Failed to save bastion instance: %v\n", err)
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// resolveInstance returns the newest running instance that matches the resolver and is online in
+// SSM.
+func resolveInstance(profile string, region string, resolver *InstanceResolver) (EC2Instance, error) {
+	instances, err := describeEC2Instances(profile, region, resolverFilters(resolver)...)
+	if err != nil {
+		return EC2Instance{}, fmt.Errorf("failed to query instances: %v", err)
+	}
+
+	pingStatus, err := querySSMPingStatus(profile, region)
+	if err != nil {
+		return EC2Instance{}, fmt.Errorf("failed to query SSM instance status: %v", err)
+	}
+
+	online := []EC2Instance{}
+
+	for _, instance := range instances {
+		if pingStatus[instance.Instance] == "Online" {
+			instance.PingStatus = "Online"
+			online = append(online, instance)
+		}
+	}
+
+	if len(online) == 0 {
+		if len(instances) > 0 {
+			return EC2Instance{}, fmt.Errorf("no instance matching %s is online in SSM (%d running)", resolver, len(instances))
+		}
+
+		return EC2Instance{}, fmt.Errorf("no running instance matches %s", resolver)
+	}
+
+	// The newest instance is the most likely to stay, e.g. during an Auto Scaling group refresh
+	sort.SliceStable(online, func(i, j int) bool {
+		return online[i].LaunchTime > online[j].LaunchTime
+	})
+
+	return online[0], nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// instanceMatchesResolver reports whether an instance is running, still matches the resolver and
+// is online in SSM.
+func instanceMatchesResolver(profile string, region string, instanceID string, resolver *InstanceResolver) (bool, error) {
+	filters := append(resolverFilters(resolver), "Name=instance-id,Values="+instanceID)
+
+	instances, err := describeEC2Instances(profile, region, filters...)
+	if err != nil {
+		return false, err
+	}
+
+	if len(instances) == 0 {
+		return false, nil
+	}
+
+	pingStatus, err := querySSMPingStatus(profile, region)
+	if err != nil {
+		return false, err
+	}
+
+	return pingStatus[instanceID] == "Online", nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// resolverFilters returns the EC2 filters for running instances matching a resolver. EC2
+// combines filters with AND, so an instance must match the name and every tag.
+func resolverFilters(resolver *InstanceResolver) []string {
+	filters := []string{"Name=instance-state-name,Values=running"}
+
+	if resolver.Name != "" {
+		filters = append(filters, "Name=tag:Name,Values="+resolver.Name)
+	}
+
+	for _, key := range sortedKeys(resolver.Tags) {
+		filters = append(filters, fmt.Sprintf("Name=tag:%s,Values=%s", key, firstNonEmpty(resolver.Tags[key], "*")))
+	}
+
+	return filters
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// parseInstanceResolver builds a resolver from a name pattern and <key>=<value pattern> tags. It
+// returns nil when neither is given.
+func parseInstanceResolver(name string, tags []string) (*InstanceResolver, error) {
+	if name == "" && len(tags) == 0 {
+		return nil, nil
+	}
+
+	resolver := &InstanceResolver{Name: name}
+
+	for _, tag := range tags {
+		key, value, _ := strings.Cut(tag, "=")
+
+		if key == "" {
+			return nil, fmt.Errorf("invalid tag filter '%s', expected <key>=<value pattern>", tag)
+		}
+
+		if resolver.Tags == nil {
+			resolver.Tags = make(map[string]string)
+		}
+
+		resolver.Tags[key] = value
+	}
+
+	return resolver, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (r *InstanceResolver) String() string {
+	parts := []string{}
+
+	if r.Name != "" {
+		parts = append(parts, "Name="+r.Name)
+	}
+
+	for _, key := range sortedKeys(r.Tags) {
+		parts = append(parts, key+"="+firstNonEmpty(r.Tags[key], "*"))
+	}
+
+	return strings.Join(parts, ", ")
+}
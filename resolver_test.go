@@ -0,0 +1,53 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// The tunnel daemon saves a replaced instance straight away, keeping whatever other commands
+// changed in the configuration file since the daemon loaded it.
+func TestRefreshBastionInstanceSavesForDaemon(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("ec2 describe-instances", testInstancesOutput)
+	fake.Respond("ssm describe-instance-information", `{"InstanceInformationList": [
+		{"InstanceId": "i-0001", "PingStatus": "Online"}
+	]}`)
+
+	bastion := Bastion{Name: "db", Instance: "i-gone", InstanceResolver: &InstanceResolver{Name: "bastion-*"}}
+
+	config := newTestConfiguration()
+	config.Profiles["dev"] = Profile{Name: "dev", Bastions: map[string]Bastion{"db": bastion}}
+
+	fileName := filepath.Join(t.TempDir(), "awsdo_config.json")
+
+	saved := newTestConfiguration()
+	saved.Profiles["dev"] = Profile{Name: "dev", Bastions: map[string]Bastion{"db": bastion, "cache": {Name: "cache"}}}
+	saveConfiguration(fileName, saved)
+
+	instanceCacheFile = fileName
+	t.Cleanup(func() { instanceCacheFile = "" })
+
+	if err := refreshBastionInstance(&bastion, "dev", config); err != nil {
+		t.Fatalf("refreshBastionInstance: %v", err)
+	}
+
+	if bastion.Instance != "i-0001" || config.Profiles["dev"].Bastions["db"].Instance != "i-0001" {
+		t.Errorf("instance = %s, want i-0001", bastion.Instance)
+	}
+
+	reloaded, err := loadConfiguration(fileName)
+	if err != nil {
+		t.Fatalf("loadConfiguration: %v", err)
+	}
+
+	bastions := reloaded.Profiles["dev"].Bastions
+	if bastions["db"].Instance != "i-0001" {
+		t.Errorf("saved instance = %s, want i-0001", bastions["db"].Instance)
+	}
+
+	if _, exists := bastions["cache"]; !exists {
+		t.Errorf("saving the instance dropped the bastions added since the daemon started")
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	sessionClientBuiltin = "builtin"
+	sessionClientPlugin  = "plugin"
+)
+
+// ssmSessionProcess is an SSM session run by the built-in data channel client.
+type ssmSessionProcess struct {
+	channel   *ssmDataChannel
+	terminate func()
+	done      chan struct{}
+	err       error
+	killOnce  sync.Once
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// sessionClientFor returns the client used for SSM sessions. session-manager-plugin is used unless
+// the configuration opts in to the built-in client, since the plugin supports every credential
+// source of the AWS CLI and serves several port forwarding connections at once.
+func sessionClientFor(config *Configuration) string {
+	if config != nil && config.SessionClient == sessionClientBuiltin {
+		return sessionClientBuiltin
+	}
+
+	return sessionClientPlugin
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (p *ssmSessionProcess) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// Kill ends the session on the AWS side and closes the data channel.
+func (p *ssmSessionProcess) Kill() error {
+	p.killOnce.Do(func() {
+		if p.terminate != nil {
+			p.terminate()
+		}
+
+		p.channel.Close()
+	})
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// finish records the outcome of the session once its data channel has closed.
+func (p *ssmSessionProcess) finish(err error) {
+	if err == nil {
+		err = p.channel.Err()
+	}
+
+	if reason := p.channel.CloseReason(); reason != "" {
+		fmt.Fprintf(sessionOutput, "\n%s\n", reason)
+	}
+
+	p.err = err
+	close(p.done)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// startBuiltinSession connects to a session created by StartSession. Sessions with a local port
+// parameter forward that port; anything else is an interactive shell on the console.
+func (r *NativeRunner) startBuiltinSession(session nativeSession, input ssmStartSessionInput, output ssmStartSessionOutput) (AWSProcess, error) {
+	terminate := func() {
+		var result struct{}
+		r.callJSON(session, "ssm", "AmazonSSM", "TerminateSession", ssmTerminateSessionInput{SessionID: output.SessionID}, &result)
+	}
+
+	if localPorts, exists := input.Parameters["localPortNumber"]; exists && len(localPorts) > 0 {
+		localPort, err := strconv.Atoi(localPorts[0])
+		if err != nil {
+			terminate()
+			return nil, fmt.Errorf("invalid local port '%s'", localPorts[0])
+		}
+
+		return startSSMPortForwarding(output, localPort, terminate)
+	}
+
+	return startSSMShell(output, terminate)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// startSSMShell runs an interactive session, with the console in raw mode so that keys such as
+// Ctrl-C are sent to the remote shell.
+func startSSMShell(output ssmStartSessionOutput, terminate func()) (AWSProcess, error) {
+	channel, err := openSSMDataChannel(output.SessionID, output.StreamURL, output.TokenValue, func(payloadType uint32, payload []byte) {
+		switch payloadType {
+		case ssmPayloadOutput:
+			os.Stdout.Write(payload)
+		case ssmPayloadStdErr:
+			os.Stderr.Write(payload)
+		}
+	})
+
+	if err != nil {
+		terminate()
+		return nil, err
+	}
+
+	process := &ssmSessionProcess{channel: channel, terminate: terminate, done: make(chan struct{})}
+
+	fmt.Printf("\nStarting session with SessionId: %s\n", output.SessionID)
+
+	channel.WaitForHandshake(5 * time.Second)
+
+	stdinFd := int(os.Stdin.Fd())
+	stdoutFd := int(os.Stdout.Fd())
+
+	var originalState *term.State
+
+	if term.IsTerminal(stdinFd) {
+		originalState, err = term.MakeRaw(stdinFd)
+		if err != nil {
+			originalState = nil
+		}
+	}
+
+	go func() {
+		lastCols, lastRows := 0, 0
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			if cols, rows, err := term.GetSize(stdoutFd); err == nil && (cols != lastCols || rows != lastRows) {
+				lastCols, lastRows = cols, rows
+				channel.SendSize(cols, rows)
+			}
+
+			select {
+			case <-channel.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	go func() {
+		buffer := make([]byte, ssmStreamDataPayloadSize)
+
+		for {
+			// Poll so that this goroutine stops reading the console once the session ends
+			ready, err := waitForStdin(200 * time.Millisecond)
+
+			select {
+			case <-channel.Done():
+				return
+			default:
+			}
+
+			if err != nil {
+				return
+			}
+
+			if !ready {
+				continue
+			}
+
+			count, err := os.Stdin.Read(buffer)
+			if count > 0 {
+				if channel.SendData(append([]byte{}, buffer[:count]...)) != nil {
+					return
+				}
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	go func() {
+		<-channel.Done()
+
+		if originalState != nil {
+			term.Restore(stdinFd, originalState)
+		}
+
+		process.finish(nil)
+	}()
+
+	return process, nil
+}
+
+// ssmPortForwarder relays one local TCP connection at a time through a port forwarding session.
+type ssmPortForwarder struct {
+	channel *ssmDataChannel
+	mu      sync.Mutex
+	conn    net.Conn
+	busy    bool // A connection is being served, until the agent is told it ended
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// startSSMPortForwarding listens on the local port and relays connections to the remote port.
+func startSSMPortForwarding(output ssmStartSessionOutput, localPort int, terminate func()) (AWSProcess, error) {
+	listener, err := net.Listen("tcp", localAddress(localPort))
+	if err != nil {
+		terminate()
+		return nil, fmt.Errorf("unable to listen on local port %d: %v", localPort, err)
+	}
+
+	forwarder := &ssmPortForwarder{}
+
+	channel, err := openSSMDataChannel(output.SessionID, output.StreamURL, output.TokenValue, forwarder.receive)
+	if err != nil {
+		listener.Close()
+		terminate()
+		return nil, err
+	}
+
+	forwarder.channel = channel
+	process := &ssmSessionProcess{channel: channel, terminate: terminate, done: make(chan struct{})}
+
+	fmt.Fprintf(sessionOutput, "\nStarting session with SessionId: %s\n", output.SessionID)
+
+	channel.WaitForHandshake(5 * time.Second)
+
+	fmt.Fprintf(sessionOutput, "Port %d opened for sessionId %s.\n", listener.Addr().(*net.TCPAddr).Port, output.SessionID)
+	fmt.Fprintln(sessionOutput, "Waiting for connections...")
+
+	go func() {
+		<-channel.Done()
+		listener.Close()
+		forwarder.closeConnection()
+	}()
+
+	go func() {
+		var acceptErr error
+
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !channel.isClosed() {
+					acceptErr = fmt.Errorf("failed to accept connection: %v", err)
+					channel.Close()
+				}
+
+				break
+			}
+
+			// The basic port forwarding protocol carries a single connection at a time, so
+			// connections made while another is open are closed rather than left waiting
+			if !forwarder.acquire(conn) {
+				fmt.Fprintf(sessionOutput, "\nConnection rejected for session [%s]: the built-in session client forwards one connection at a time. Use session-manager-plugin for concurrent connections ('awsdo backend --session-client plugin').\n", output.SessionID)
+				conn.Close()
+				continue
+			}
+
+			fmt.Fprintf(sessionOutput, "\nConnection accepted for session [%s]\n", output.SessionID)
+
+			go forwarder.serve(conn)
+		}
+
+		process.finish(acceptErr)
+	}()
+
+	return process, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// acquire makes conn the current connection, unless another one is being served.
+func (f *ssmPortForwarder) acquire(conn net.Conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.busy {
+		return false
+	}
+
+	f.busy = true
+	f.conn = conn
+
+	return true
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// serve copies data from the local connection to the agent until either side closes it.
+func (f *ssmPortForwarder) serve(conn net.Conn) {
+	buffer := make([]byte, ssmStreamDataPayloadSize)
+
+	for {
+		count, err := conn.Read(buffer)
+		if count > 0 {
+			if f.channel.SendData(append([]byte{}, buffer[:count]...)) != nil {
+				break
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	f.closeConnection()
+
+	// Tell the agent to drop its side so the next local connection starts fresh
+	if !f.channel.isClosed() {
+		f.channel.SendFlag(ssmFlagDisconnectToPort)
+	}
+
+	f.mu.Lock()
+	f.busy = false
+	f.mu.Unlock()
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// receive writes data from the agent to the current local connection.
+func (f *ssmPortForwarder) receive(payloadType uint32, payload []byte) {
+	switch payloadType {
+	case ssmPayloadOutput:
+		f.mu.Lock()
+		conn := f.conn
+		f.mu.Unlock()
+
+		if conn != nil {
+			if _, err := conn.Write(payload); err != nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, io.EOF) {
+				f.closeConnection()
+			}
+		}
+	case ssmPayloadFlag:
+		if len(payload) >= 4 && binary.BigEndian.Uint32(payload) == ssmFlagConnectToPortError {
+			fmt.Fprintln(sessionOutput, "\nThe remote host refused the connection or could not be reached.")
+			f.closeConnection()
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (f *ssmPortForwarder) closeConnection() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.conn != nil {
+		f.conn.Close()
+		f.conn = nil
+	}
+}
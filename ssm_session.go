@@ -0,0 +1,705 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSM data channel message types.
+const (
+	ssmMessageInputStreamData   = "input_stream_data"
+	ssmMessageOutputStreamData  = "output_stream_data"
+	ssmMessageAcknowledge       = "acknowledge"
+	ssmMessageChannelClosed     = "channel_closed"
+	ssmMessageStartPublication  = "start_publication"
+	ssmMessagePausePublication  = "pause_publication"
+	ssmMessageTypeLength        = 32
+	ssmMessageHeaderLength      = 116
+	ssmMessagePayloadOffset     = ssmMessageHeaderLength + 4
+	ssmMessageSchemaVersion     = 1
+	ssmMessageFlagData          = 0
+	ssmMessageFlagAcknowledge   = 3
+	ssmStreamDataPayloadSize    = 1024
+	ssmOutgoingWindowSize       = 1000
+	ssmResendTimeout            = 3 * time.Second
+	ssmPingInterval             = 5 * time.Minute
+	ssmDataChannelSchemaVersion = "1.0"
+)
+
+// SSM data channel payload types.
+const (
+	ssmPayloadOutput            = 1
+	ssmPayloadError             = 2
+	ssmPayloadSize              = 3
+	ssmPayloadParameter         = 4
+	ssmPayloadHandshakeRequest  = 5
+	ssmPayloadHandshakeResponse = 6
+	ssmPayloadHandshakeComplete = 7
+	ssmPayloadEncChallengeReq   = 8
+	ssmPayloadEncChallengeResp  = 9
+	ssmPayloadFlag              = 10
+	ssmPayloadStdErr            = 11
+	ssmPayloadExitCode          = 12
+)
+
+// Flags carried in a flag payload during port forwarding.
+const (
+	ssmFlagDisconnectToPort   = 1
+	ssmFlagTerminateSession   = 2
+	ssmFlagConnectToPortError = 3
+)
+
+// Status values for a processed handshake action.
+const (
+	ssmActionSuccess     = 1
+	ssmActionFailed      = 2
+	ssmActionUnsupported = 3
+)
+
+// ssmClientVersion is the session-manager-plugin version awsdo reports to the agent. It
+// predates multiplexed port forwarding, so the agent uses the basic byte stream protocol.
+const ssmClientVersion = "1.1.61.0"
+
+// ssmClientMessage is a binary message exchanged over the data channel.
+type ssmClientMessage struct {
+	MessageType    string
+	SchemaVersion  uint32
+	CreatedDate    uint64
+	SequenceNumber int64
+	Flags          uint64
+	MessageID      [16]byte
+	PayloadType    uint32
+	Payload        []byte
+}
+
+// ssmOpenDataChannelInput is the first (text) message sent after connecting.
+type ssmOpenDataChannelInput struct {
+	MessageSchemaVersion string `json:"MessageSchemaVersion"`
+	RequestID            string `json:"RequestId"`
+	TokenValue           string `json:"TokenValue"`
+	ClientID             string `json:"ClientId"`
+	ClientVersion        string `json:"ClientVersion"`
+}
+
+// ssmAcknowledgeContent is the payload of an acknowledge message.
+type ssmAcknowledgeContent struct {
+	AcknowledgedMessageType           string `json:"AcknowledgedMessageType"`
+	AcknowledgedMessageID             string `json:"AcknowledgedMessageId"`
+	AcknowledgedMessageSequenceNumber int64  `json:"AcknowledgedMessageSequenceNumber"`
+	IsSequentialMessage               bool   `json:"IsSequentialMessage"`
+}
+
+// ssmHandshakeRequest is sent by the agent to negotiate session features.
+type ssmHandshakeRequest struct {
+	AgentVersion           string `json:"AgentVersion"`
+	RequestedClientActions []struct {
+		ActionType       string          `json:"ActionType"`
+		ActionParameters json.RawMessage `json:"ActionParameters"`
+	} `json:"RequestedClientActions"`
+}
+
+// ssmHandshakeResponse reports which of the requested actions the client performed.
+type ssmHandshakeResponse struct {
+	ClientVersion          string                     `json:"ClientVersion"`
+	ProcessedClientActions []ssmProcessedClientAction `json:"ProcessedClientActions"`
+	Errors                 []string                   `json:"Errors"`
+}
+
+type ssmProcessedClientAction struct {
+	ActionType   string `json:"ActionType"`
+	ActionStatus int    `json:"ActionStatus"`
+	Error        string `json:"Error,omitempty"`
+}
+
+// ssmSessionTypeParameters are the parameters of the SessionType handshake action.
+type ssmSessionTypeParameters struct {
+	SessionType string `json:"SessionType"`
+}
+
+// ssmHandshakeComplete ends the handshake and may carry a message for the user.
+type ssmHandshakeComplete struct {
+	HandshakeTimeToComplete int64  `json:"HandshakeTimeToComplete"`
+	CustomerMessage         string `json:"CustomerMessage"`
+}
+
+// ssmChannelClosed is the payload of a channel_closed message.
+type ssmChannelClosed struct {
+	SessionID string `json:"SessionId"`
+	Output    string `json:"Output"`
+}
+
+// ssmTerminalSize is the payload of a size message.
+type ssmTerminalSize struct {
+	Cols int `json:"cols"`
+	Rows int `json:"rows"`
+}
+
+// ssmOutgoingMessage is an input message waiting to be acknowledged by the agent.
+type ssmOutgoingMessage struct {
+	data   []byte
+	sentAt time.Time
+}
+
+// ssmDataChannel speaks the Session Manager data channel protocol over a WebSocket. It numbers
+// outgoing messages, resends them until acknowledged, acknowledges incoming messages, and
+// delivers incoming stream data in sequence order.
+type ssmDataChannel struct {
+	SessionID string
+
+	ws       *wsConn
+	onOutput func(payloadType uint32, payload []byte)
+
+	sendMu      sync.Mutex // Keeps callers of Send in order while they wait for the window
+	mu          sync.Mutex
+	windowOpen  *sync.Cond
+	nextSeq     int64
+	unacked     map[int64]*ssmOutgoingMessage
+	expectedSeq int64
+	pending     map[int64]ssmClientMessage
+	paused      bool
+	sessionType string
+	closeReason string
+
+	handshakeDone chan struct{}
+	closed        chan struct{}
+	closeOnce     sync.Once
+	err           error
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// openSSMDataChannel connects to the stream URL returned by StartSession and authenticates the
+// data channel with the session token. Output messages are passed to onOutput in order.
+func openSSMDataChannel(sessionID string, streamURL string, token string, onOutput func(uint32, []byte)) (*ssmDataChannel, error) {
+	ws, err := dialWebSocket(streamURL, http.Header{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the session data channel: %v", err)
+	}
+
+	channel := &ssmDataChannel{
+		SessionID:     sessionID,
+		ws:            ws,
+		onOutput:      onOutput,
+		unacked:       make(map[int64]*ssmOutgoingMessage),
+		pending:       make(map[int64]ssmClientMessage),
+		handshakeDone: make(chan struct{}),
+		closed:        make(chan struct{}),
+	}
+
+	channel.windowOpen = sync.NewCond(&channel.mu)
+
+	openInput, _ := json.Marshal(ssmOpenDataChannelInput{
+		MessageSchemaVersion: ssmDataChannelSchemaVersion,
+		RequestID:            newUUID(),
+		TokenValue:           token,
+		ClientID:             newUUID(),
+		ClientVersion:        ssmClientVersion,
+	})
+
+	if err := ws.WriteMessage(wsOpText, openInput); err != nil {
+		ws.Close()
+		return nil, fmt.Errorf("failed to open the session data channel: %v", err)
+	}
+
+	go channel.readLoop()
+	go channel.resendLoop()
+
+	return channel, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// SendData sends stream data to the agent, split into protocol sized chunks.
+func (c *ssmDataChannel) SendData(data []byte) error {
+	for len(data) > 0 {
+		size := min(len(data), ssmStreamDataPayloadSize)
+
+		if err := c.Send(ssmPayloadOutput, data[:size]); err != nil {
+			return err
+		}
+
+		data = data[size:]
+	}
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// SendFlag sends a port forwarding flag such as DisconnectToPort.
+func (c *ssmDataChannel) SendFlag(flag uint32) error {
+	return c.Send(ssmPayloadFlag, binary.BigEndian.AppendUint32(nil, flag))
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// SendSize tells the agent the size of the local terminal.
+func (c *ssmDataChannel) SendSize(cols int, rows int) error {
+	payload, _ := json.Marshal(ssmTerminalSize{Cols: cols, Rows: rows})
+	return c.Send(ssmPayloadSize, payload)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// Send sends an input_stream_data message. It blocks while too many messages are waiting to
+// be acknowledged, so it must not be called from the read loop, which receives the
+// acknowledgements.
+func (c *ssmDataChannel) Send(payloadType uint32, payload []byte) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	c.mu.Lock()
+	for len(c.unacked) >= ssmOutgoingWindowSize && !c.isClosed() {
+		c.windowOpen.Wait()
+	}
+	c.mu.Unlock()
+
+	return c.queue(payloadType, payload)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// queue numbers an input_stream_data message, keeps it until it is acknowledged and writes it
+// unless publication is paused. It does not wait for the window, so the read loop can answer
+// the agent.
+func (c *ssmDataChannel) queue(payloadType uint32, payload []byte) error {
+	c.mu.Lock()
+
+	if c.isClosed() {
+		c.mu.Unlock()
+		return errWebSocketClosed
+	}
+
+	message := ssmClientMessage{
+		MessageType:    ssmMessageInputStreamData,
+		SchemaVersion:  ssmMessageSchemaVersion,
+		CreatedDate:    uint64(time.Now().UnixMilli()),
+		SequenceNumber: c.nextSeq,
+		Flags:          ssmMessageFlagData,
+		MessageID:      newMessageID(),
+		PayloadType:    payloadType,
+		Payload:        payload,
+	}
+
+	outgoing := &ssmOutgoingMessage{data: message.marshal()}
+	c.unacked[c.nextSeq] = outgoing
+	c.nextSeq++
+
+	// Messages queued while publication is paused are sent by the resend loop
+	paused := c.paused
+	if !paused {
+		outgoing.sentAt = time.Now()
+	}
+
+	c.mu.Unlock()
+
+	if paused {
+		return nil
+	}
+
+	return c.ws.WriteMessage(wsOpBinary, outgoing.data)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// WaitForHandshake waits until the agent completes the handshake or the timeout expires. Older
+// agents do not perform a handshake, so a timeout is not an error.
+func (c *ssmDataChannel) WaitForHandshake(timeout time.Duration) string {
+	select {
+	case <-c.handshakeDone:
+	case <-c.closed:
+	case <-time.After(timeout):
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.sessionType
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// Done is closed when the data channel is closed.
+func (c *ssmDataChannel) Done() <-chan struct{} {
+	return c.closed
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// Err returns why the data channel closed, or nil if it closed normally.
+func (c *ssmDataChannel) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// CloseReason returns the message the agent sent when it closed the channel, if any.
+func (c *ssmDataChannel) CloseReason() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closeReason
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// Close closes the data channel.
+func (c *ssmDataChannel) Close() {
+	c.shutdown(nil)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (c *ssmDataChannel) shutdown(err error) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		close(c.closed)
+		c.windowOpen.Broadcast()
+		c.mu.Unlock()
+
+		c.ws.Close()
+	})
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// isClosed reports whether the channel has been closed.
+func (c *ssmDataChannel) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (c *ssmDataChannel) readLoop() {
+	for {
+		opcode, data, err := c.ws.ReadMessage()
+		if err != nil {
+			if errors.Is(err, errWebSocketClosed) || c.isClosed() {
+				c.shutdown(nil)
+			} else {
+				c.shutdown(fmt.Errorf("session data channel failed: %v", err))
+			}
+
+			return
+		}
+
+		if opcode != wsOpBinary {
+			continue
+		}
+
+		message, err := unmarshalSSMClientMessage(data)
+		if err != nil {
+			continue
+		}
+
+		switch message.MessageType {
+		case ssmMessageOutputStreamData:
+			c.receiveOutput(message)
+		case ssmMessageAcknowledge:
+			c.receiveAcknowledge(message)
+		case ssmMessageChannelClosed:
+			var closed ssmChannelClosed
+			json.Unmarshal(message.Payload, &closed)
+
+			c.mu.Lock()
+			c.closeReason = closed.Output
+			c.mu.Unlock()
+
+			c.shutdown(nil)
+			return
+		case ssmMessageStartPublication:
+			c.mu.Lock()
+			c.paused = false
+			c.mu.Unlock()
+		case ssmMessagePausePublication:
+			c.mu.Lock()
+			c.paused = true
+			c.mu.Unlock()
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// receiveOutput acknowledges an output message and processes it, along with any buffered
+// messages that follow it, once every earlier message has arrived.
+func (c *ssmDataChannel) receiveOutput(message ssmClientMessage) {
+	c.sendAcknowledge(message)
+
+	c.mu.Lock()
+
+	if message.SequenceNumber < c.expectedSeq {
+		// Already processed; the agent resent it because our acknowledgement was late
+		c.mu.Unlock()
+		return
+	}
+
+	c.pending[message.SequenceNumber] = message
+
+	var ready []ssmClientMessage
+
+	for {
+		next, exists := c.pending[c.expectedSeq]
+		if !exists {
+			break
+		}
+
+		delete(c.pending, c.expectedSeq)
+		ready = append(ready, next)
+		c.expectedSeq++
+	}
+
+	c.mu.Unlock()
+
+	for _, next := range ready {
+		c.processOutput(next)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (c *ssmDataChannel) processOutput(message ssmClientMessage) {
+	switch message.PayloadType {
+	case ssmPayloadHandshakeRequest:
+		c.handleHandshakeRequest(message.Payload)
+	case ssmPayloadHandshakeComplete:
+		var complete ssmHandshakeComplete
+		json.Unmarshal(message.Payload, &complete)
+
+		if complete.CustomerMessage != "" {
+			fmt.Fprintln(sessionOutput, complete.CustomerMessage)
+		}
+
+		select {
+		case <-c.handshakeDone:
+		default:
+			close(c.handshakeDone)
+		}
+	case ssmPayloadEncChallengeReq:
+		// KMS encryption is declined during the handshake, so there is nothing to answer
+	default:
+		if c.onOutput != nil {
+			c.onOutput(message.PayloadType, message.Payload)
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// handleHandshakeRequest records the session type and declines actions awsdo does not support,
+// such as KMS encryption.
+func (c *ssmDataChannel) handleHandshakeRequest(payload []byte) {
+	var request ssmHandshakeRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return
+	}
+
+	response := ssmHandshakeResponse{
+		ClientVersion: ssmClientVersion,
+		Errors:        []string{},
+	}
+
+	for _, action := range request.RequestedClientActions {
+		processed := ssmProcessedClientAction{ActionType: action.ActionType}
+
+		switch action.ActionType {
+		case "SessionType":
+			var parameters ssmSessionTypeParameters
+			json.Unmarshal(action.ActionParameters, &parameters)
+
+			c.mu.Lock()
+			c.sessionType = parameters.SessionType
+			c.mu.Unlock()
+
+			processed.ActionStatus = ssmActionSuccess
+		default:
+			processed.ActionStatus = ssmActionUnsupported
+			processed.Error = fmt.Sprintf("%s is not supported by awsdo", action.ActionType)
+			response.Errors = append(response.Errors, processed.Error)
+		}
+
+		response.ProcessedClientActions = append(response.ProcessedClientActions, processed)
+	}
+
+	// This runs on the read loop, which must not wait for acknowledgements it would read itself
+	responsePayload, _ := json.Marshal(response)
+	c.queue(ssmPayloadHandshakeResponse, responsePayload)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (c *ssmDataChannel) sendAcknowledge(message ssmClientMessage) {
+	content, _ := json.Marshal(ssmAcknowledgeContent{
+		AcknowledgedMessageType:           message.MessageType,
+		AcknowledgedMessageID:             formatUUID(message.MessageID),
+		AcknowledgedMessageSequenceNumber: message.SequenceNumber,
+		IsSequentialMessage:               true,
+	})
+
+	ack := ssmClientMessage{
+		MessageType:   ssmMessageAcknowledge,
+		SchemaVersion: ssmMessageSchemaVersion,
+		CreatedDate:   uint64(time.Now().UnixMilli()),
+		Flags:         ssmMessageFlagAcknowledge,
+		MessageID:     newMessageID(),
+		Payload:       content,
+	}
+
+	c.ws.WriteMessage(wsOpBinary, ack.marshal())
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (c *ssmDataChannel) receiveAcknowledge(message ssmClientMessage) {
+	var content ssmAcknowledgeContent
+	if err := json.Unmarshal(message.Payload, &content); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	delete(c.unacked, content.AcknowledgedMessageSequenceNumber)
+	c.windowOpen.Broadcast()
+	c.mu.Unlock()
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// resendLoop resends input messages that have not been acknowledged in time and keeps the
+// WebSocket alive with periodic pings.
+func (c *ssmDataChannel) resendLoop() {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	lastPing := time.Now()
+
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+		}
+
+		var resend [][]byte
+
+		c.mu.Lock()
+
+		if !c.paused {
+			sequences := make([]int64, 0, len(c.unacked))
+
+			for seq := range c.unacked {
+				sequences = append(sequences, seq)
+			}
+
+			// Resend in sequence order so the agent can process them as they arrive
+			slices.Sort(sequences)
+
+			for _, seq := range sequences {
+				outgoing := c.unacked[seq]
+				if time.Since(outgoing.sentAt) < ssmResendTimeout {
+					continue
+				}
+
+				outgoing.sentAt = time.Now()
+				resend = append(resend, outgoing.data)
+			}
+		}
+
+		c.mu.Unlock()
+
+		// Write outside the lock, so that acknowledgements are handled while the socket is busy
+		for _, data := range resend {
+			c.ws.WriteMessage(wsOpBinary, data)
+		}
+
+		if time.Since(lastPing) >= ssmPingInterval {
+			lastPing = time.Now()
+			c.ws.Ping()
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// marshal encodes the message in the data channel wire format. All numbers are big-endian.
+func (m ssmClientMessage) marshal() []byte {
+	data := make([]byte, ssmMessagePayloadOffset+len(m.Payload))
+
+	binary.BigEndian.PutUint32(data[0:], ssmMessageHeaderLength)
+
+	messageType := []byte(m.MessageType + strings.Repeat(" ", ssmMessageTypeLength))
+	copy(data[4:4+ssmMessageTypeLength], messageType[:ssmMessageTypeLength])
+
+	binary.BigEndian.PutUint32(data[36:], m.SchemaVersion)
+	binary.BigEndian.PutUint64(data[40:], m.CreatedDate)
+	binary.BigEndian.PutUint64(data[48:], uint64(m.SequenceNumber))
+	binary.BigEndian.PutUint64(data[56:], m.Flags)
+
+	// The message ID is written as its least significant half followed by its most significant
+	copy(data[64:72], m.MessageID[8:16])
+	copy(data[72:80], m.MessageID[0:8])
+
+	digest := sha256.Sum256(m.Payload)
+	copy(data[80:112], digest[:])
+
+	binary.BigEndian.PutUint32(data[112:], m.PayloadType)
+	binary.BigEndian.PutUint32(data[116:], uint32(len(m.Payload)))
+	copy(data[ssmMessagePayloadOffset:], m.Payload)
+
+	return data
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func unmarshalSSMClientMessage(data []byte) (ssmClientMessage, error) {
+	if len(data) < ssmMessagePayloadOffset {
+		return ssmClientMessage{}, fmt.Errorf("data channel message too short (%d bytes)", len(data))
+	}
+
+	headerLength := binary.BigEndian.Uint32(data[0:])
+	if headerLength < ssmMessageHeaderLength || int(headerLength)+4 > len(data) {
+		return ssmClientMessage{}, fmt.Errorf("invalid data channel header length %d", headerLength)
+	}
+
+	message := ssmClientMessage{
+		MessageType:    strings.TrimRight(string(data[4:4+ssmMessageTypeLength]), " \x00"),
+		SchemaVersion:  binary.BigEndian.Uint32(data[36:]),
+		CreatedDate:    binary.BigEndian.Uint64(data[40:]),
+		SequenceNumber: int64(binary.BigEndian.Uint64(data[48:])),
+		Flags:          binary.BigEndian.Uint64(data[56:]),
+		PayloadType:    binary.BigEndian.Uint32(data[112:]),
+	}
+
+	copy(message.MessageID[8:16], data[64:72])
+	copy(message.MessageID[0:8], data[72:80])
+
+	payloadLength := binary.BigEndian.Uint32(data[headerLength:])
+	payloadStart := int(headerLength) + 4
+
+	if payloadStart+int(payloadLength) > len(data) {
+		return ssmClientMessage{}, fmt.Errorf("invalid data channel payload length %d", payloadLength)
+	}
+
+	message.Payload = data[payloadStart : payloadStart+int(payloadLength)]
+
+	return message, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// newMessageID returns a random (version 4) UUID.
+func newMessageID() [16]byte {
+	var id [16]byte
+	rand.Read(id[:])
+
+	id[6] = (id[6] & 0x0F) | 0x40
+	id[8] = (id[8] & 0x3F) | 0x80
+
+	return id
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func newUUID() string {
+	return formatUUID(newMessageID())
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func formatUUID(id [16]byte) string {
+	text := hex.EncodeToString(id[:])
+	return text[0:8] + "-" + text[8:12] + "-" + text[12:16] + "-" + text[16:20] + "-" + text[20:32]
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSSMAgent is the agent side of a data channel, served by a WebSocket stand-in.
+type testSSMAgent struct {
+	t    *testing.T
+	ws   *wsConn
+	open ssmOpenDataChannelInput
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// openTestSSMDataChannel starts a WebSocket stand-in for the Session Manager service and opens a
+// data channel to it. The returned agent speaks for the other side.
+func openTestSSMDataChannel(t *testing.T, onOutput func(uint32, []byte)) (*ssmDataChannel, *testSSMAgent) {
+	t.Helper()
+
+	agents := make(chan *testSSMAgent, 1)
+	finished := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buffer, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+
+		accept := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + wsGUID))
+		fmt.Fprintf(buffer, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(accept[:]))
+		buffer.Flush()
+
+		// The client accepts masked frames, so the stand-in can reuse the client's framing
+		agent := &testSSMAgent{t: t, ws: &wsConn{conn: conn, reader: bufio.NewReader(buffer)}}
+
+		if _, data, err := agent.ws.ReadMessage(); err == nil {
+			json.Unmarshal(data, &agent.open)
+		}
+
+		agents <- agent
+		<-finished
+		agent.ws.Close()
+	}))
+
+	t.Cleanup(func() {
+		close(finished)
+		server.Close()
+	})
+
+	channel, err := openSSMDataChannel("session-1", "ws"+strings.TrimPrefix(server.URL, "http"), "token-1", onOutput)
+	if err != nil {
+		t.Fatalf("openSSMDataChannel: %v", err)
+	}
+
+	t.Cleanup(channel.Close)
+
+	select {
+	case agent := <-agents:
+		return channel, agent
+	case <-time.After(5 * time.Second):
+		t.Fatal("the data channel did not connect")
+	}
+
+	return nil, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (a *testSSMAgent) send(messageType string, seq int64, payloadType uint32, payload []byte) {
+	a.t.Helper()
+
+	message := ssmClientMessage{
+		MessageType:    messageType,
+		SchemaVersion:  ssmMessageSchemaVersion,
+		CreatedDate:    uint64(time.Now().UnixMilli()),
+		SequenceNumber: seq,
+		MessageID:      newMessageID(),
+		PayloadType:    payloadType,
+		Payload:        payload,
+	}
+
+	if err := a.ws.WriteMessage(wsOpBinary, message.marshal()); err != nil {
+		a.t.Fatalf("agent send: %v", err)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// receive returns the next message of the given type from the client, skipping others.
+func (a *testSSMAgent) receive(messageType string) ssmClientMessage {
+	a.t.Helper()
+
+	a.ws.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer a.ws.conn.SetReadDeadline(time.Time{})
+
+	for {
+		_, data, err := a.ws.ReadMessage()
+		if err != nil {
+			a.t.Fatalf("agent receive %s: %v", messageType, err)
+		}
+
+		message, err := unmarshalSSMClientMessage(data)
+		if err != nil {
+			a.t.Fatalf("agent receive %s: %v", messageType, err)
+		}
+
+		if message.MessageType == messageType {
+			return message
+		}
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// acknowledge acknowledges an input message from the client.
+func (a *testSSMAgent) acknowledge(message ssmClientMessage) {
+	a.t.Helper()
+
+	content, _ := json.Marshal(ssmAcknowledgeContent{
+		AcknowledgedMessageType:           message.MessageType,
+		AcknowledgedMessageID:             formatUUID(message.MessageID),
+		AcknowledgedMessageSequenceNumber: message.SequenceNumber,
+		IsSequentialMessage:               true,
+	})
+
+	a.send(ssmMessageAcknowledge, 0, 0, content)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// ackedSequence returns the sequence number an acknowledge message refers to.
+func ackedSequence(t *testing.T, message ssmClientMessage) int64 {
+	t.Helper()
+
+	var content ssmAcknowledgeContent
+	if err := json.Unmarshal(message.Payload, &content); err != nil {
+		t.Fatalf("invalid acknowledge payload: %v", err)
+	}
+
+	return content.AcknowledgedMessageSequenceNumber
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestSSMClientMessageRoundTrip(t *testing.T) {
+	message := ssmClientMessage{
+		MessageType:    ssmMessageInputStreamData,
+		SchemaVersion:  ssmMessageSchemaVersion,
+		CreatedDate:    1700000000000,
+		SequenceNumber: 42,
+		Flags:          ssmMessageFlagData,
+		MessageID:      newMessageID(),
+		PayloadType:    ssmPayloadOutput,
+		Payload:        []byte("hello"),
+	}
+
+	decoded, err := unmarshalSSMClientMessage(message.marshal())
+	if err != nil {
+		t.Fatalf("unmarshalSSMClientMessage: %v", err)
+	}
+
+	if decoded.MessageType != message.MessageType || decoded.SequenceNumber != 42 || decoded.MessageID != message.MessageID ||
+		decoded.PayloadType != ssmPayloadOutput || string(decoded.Payload) != "hello" {
+		t.Errorf("decoded message = %+v, want %+v", decoded, message)
+	}
+
+	if _, err := unmarshalSSMClientMessage(message.marshal()[:50]); err == nil {
+		t.Error("expected an error for a truncated message")
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestSSMDataChannelHandshake(t *testing.T) {
+	channel, agent := openTestSSMDataChannel(t, nil)
+
+	if agent.open.TokenValue != "token-1" || agent.open.ClientVersion != ssmClientVersion {
+		t.Errorf("open message = %+v", agent.open)
+	}
+
+	request := `{"AgentVersion":"3.2.0.0","RequestedClientActions":[` +
+		`{"ActionType":"SessionType","ActionParameters":{"SessionType":"Port"}},` +
+		`{"ActionType":"KMSEncryption","ActionParameters":{"KMSKeyId":"key"}}]}`
+	agent.send(ssmMessageOutputStreamData, 0, ssmPayloadHandshakeRequest, []byte(request))
+
+	if seq := ackedSequence(t, agent.receive(ssmMessageAcknowledge)); seq != 0 {
+		t.Errorf("acknowledged sequence %d, want 0", seq)
+	}
+
+	responseMessage := agent.receive(ssmMessageInputStreamData)
+	if responseMessage.PayloadType != ssmPayloadHandshakeResponse {
+		t.Fatalf("payload type %d, want a handshake response", responseMessage.PayloadType)
+	}
+
+	var response ssmHandshakeResponse
+	if err := json.Unmarshal(responseMessage.Payload, &response); err != nil {
+		t.Fatalf("invalid handshake response: %v", err)
+	}
+
+	statuses := map[string]int{}
+	for _, action := range response.ProcessedClientActions {
+		statuses[action.ActionType] = action.ActionStatus
+	}
+
+	if statuses["SessionType"] != ssmActionSuccess || statuses["KMSEncryption"] != ssmActionUnsupported {
+		t.Errorf("processed actions = %+v", response.ProcessedClientActions)
+	}
+
+	agent.acknowledge(responseMessage)
+	agent.send(ssmMessageOutputStreamData, 1, ssmPayloadHandshakeComplete, []byte(`{"HandshakeTimeToComplete":1}`))
+
+	if sessionType := channel.WaitForHandshake(5 * time.Second); sessionType != "Port" {
+		t.Errorf("session type %q, want Port", sessionType)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// The handshake request is answered while the send window is full and a sender is waiting for it.
+func TestSSMDataChannelHandshakeWithFullWindow(t *testing.T) {
+	channel, agent := openTestSSMDataChannel(t, nil)
+
+	for i := range ssmOutgoingWindowSize {
+		if err := channel.Send(ssmPayloadOutput, []byte{byte(i)}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	blocked := make(chan error, 1)
+	go func() { blocked <- channel.Send(ssmPayloadOutput, []byte("waiting")) }()
+
+	agent.send(ssmMessageOutputStreamData, 0, ssmPayloadHandshakeRequest, []byte(`{"RequestedClientActions":[]}`))
+
+	var lastSeq int64
+
+	for {
+		message := agent.receive(ssmMessageInputStreamData)
+		if message.PayloadType == ssmPayloadHandshakeResponse {
+			lastSeq = message.SequenceNumber
+			break
+		}
+	}
+
+	if lastSeq != ssmOutgoingWindowSize {
+		t.Errorf("handshake response sequence %d, want %d", lastSeq, ssmOutgoingWindowSize)
+	}
+
+	// The handshake response went past the window, so two acknowledgements open it again
+	agent.acknowledge(ssmClientMessage{MessageType: ssmMessageInputStreamData, SequenceNumber: 0})
+	agent.acknowledge(ssmClientMessage{MessageType: ssmMessageInputStreamData, SequenceNumber: 1})
+
+	select {
+	case err := <-blocked:
+		if err != nil {
+			t.Errorf("Send: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send did not resume after the window opened")
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestSSMDataChannelResendsUntilAcknowledged(t *testing.T) {
+	channel, agent := openTestSSMDataChannel(t, nil)
+
+	if err := channel.SendData([]byte("ping")); err != nil {
+		t.Fatalf("SendData: %v", err)
+	}
+
+	first := agent.receive(ssmMessageInputStreamData)
+	resent := agent.receive(ssmMessageInputStreamData)
+
+	if resent.SequenceNumber != first.SequenceNumber || resent.MessageID != first.MessageID || string(resent.Payload) != "ping" {
+		t.Errorf("resent message = %+v, want a copy of %+v", resent, first)
+	}
+
+	agent.acknowledge(resent)
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		channel.mu.Lock()
+		pending := len(channel.unacked)
+		channel.mu.Unlock()
+
+		if pending == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("%d messages still waiting for an acknowledgement", pending)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestSSMDataChannelOrdersOutput(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+
+	channel, agent := openTestSSMDataChannel(t, func(payloadType uint32, payload []byte) {
+		mu.Lock()
+		received = append(received, string(payload))
+		mu.Unlock()
+	})
+
+	agent.send(ssmMessageOutputStreamData, 1, ssmPayloadOutput, []byte("second"))
+	agent.send(ssmMessageOutputStreamData, 2, ssmPayloadOutput, []byte("third"))
+	agent.send(ssmMessageOutputStreamData, 0, ssmPayloadOutput, []byte("first"))
+
+	// A resent message that was already processed is acknowledged again but not delivered twice
+	agent.send(ssmMessageOutputStreamData, 0, ssmPayloadOutput, []byte("first"))
+
+	acked := map[int64]int{}
+	for range 4 {
+		acked[ackedSequence(t, agent.receive(ssmMessageAcknowledge))]++
+	}
+
+	if acked[0] != 2 || acked[1] != 1 || acked[2] != 1 {
+		t.Errorf("acknowledged sequences = %v", acked)
+	}
+
+	agent.send(ssmMessageChannelClosed, 0, 0, []byte(`{"SessionId":"session-1"}`))
+	<-channel.Done()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if strings.Join(received, ",") != "first,second,third" {
+		t.Errorf("received %v, want [first second third]", received)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestSSMDataChannelClosedByAgent(t *testing.T) {
+	channel, agent := openTestSSMDataChannel(t, nil)
+
+	agent.send(ssmMessageChannelClosed, 0, 0, []byte(`{"SessionId":"session-1","Output":"Session terminated"}`))
+
+	select {
+	case <-channel.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the data channel did not close")
+	}
+
+	if channel.Err() != nil {
+		t.Errorf("Err() = %v, want nil", channel.Err())
+	}
+
+	if channel.CloseReason() != "Session terminated" {
+		t.Errorf("CloseReason() = %q", channel.CloseReason())
+	}
+
+	if err := channel.SendData([]byte("late")); !errors.Is(err, errWebSocketClosed) {
+		t.Errorf("SendData after close = %v, want %v", err, errWebSocketClosed)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func TestSSMDataChannelConnectionLost(t *testing.T) {
+	channel, agent := openTestSSMDataChannel(t, nil)
+
+	// Drop the connection without a closing handshake
+	agent.ws.conn.Close()
+
+	select {
+	case <-channel.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the data channel did not close")
+	}
+
+	if channel.Err() == nil {
+		t.Error("Err() = nil, want the read error")
+	}
+}
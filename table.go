@@ -0,0 +1,309 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+const (
+	// tablePadding is the space after the text of each cell, for readability
+	tablePadding = 2
+
+	// minTableColumnWidth is the narrowest a column is wrapped to when a table is too wide for
+	// the terminal
+	minTableColumnWidth = 8
+)
+
+// tableOptions are the flags listing commands accept to shape their tables.
+type tableOptions struct {
+	columns  string // Comma-separated columns to show, in order
+	sortBy   string // Column to sort the rows by, descending with a leading "-"
+	noHeader bool
+	noColor  bool
+}
+
+// table is the output of a listing command: a header and the values of each row.
+type table struct {
+	headers []string
+	rows    [][]string
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func (o *tableOptions) register(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&o.columns, "columns", "", "--columns <column>[,<column> ...]")
+	flagSet.StringVar(&o.sortBy, "sort-by", "", "--sort-by [-]<column>")
+	flagSet.BoolVar(&o.noHeader, "no-header", false, "--no-header")
+	flagSet.BoolVar(&o.noColor, "no-color", false, "--no-color")
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// validate checks the column names of the options against a table's headers, for commands that
+// print several tables and should fail before printing any.
+func (o tableOptions) validate(headers []string) error {
+	_, err := table{headers: headers}.shape(o)
+	return err
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// color reports whether ANSI styles are used: on terminals, unless --no-color is given or the
+// NO_COLOR environment variable is set (https://no-color.org).
+func (o tableOptions) color() bool {
+	return !o.noColor && os.Getenv("NO_COLOR") == "" && isOutputTerminal()
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// bold wraps text in ANSI bold codes when colors are used.
+func (o tableOptions) bold(text string) string {
+	if !o.color() {
+		return text
+	}
+
+	return "\033[1m" + text + "\033[0m"
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// print writes the table shaped by the options. On terminals it is box-drawn and long values are
+// wrapped to fit the terminal's width. Otherwise the columns are only aligned, without borders or
+// colors, so that the output stays readable in files and easy to process with line-based tools.
+func (t table) print(options tableOptions) error {
+	shaped, err := t.shape(options)
+	if err != nil {
+		return err
+	}
+
+	lines := shaped.rows
+	if !options.noHeader {
+		lines = append([][]string{shaped.headers}, lines...)
+	}
+
+	widths := make([]int, len(shaped.headers))
+
+	for _, line := range lines {
+		for i, value := range line {
+			widths[i] = max(widths[i], utf8.RuneCountInString(value))
+		}
+	}
+
+	if !isOutputTerminal() {
+		for _, line := range lines {
+			cells := make([]string, len(line))
+			for i, value := range line {
+				cells[i] = padText(value, widths[i]+tablePadding)
+			}
+
+			fmt.Println(strings.TrimRight(strings.Join(cells, ""), " "))
+		}
+
+		return nil
+	}
+
+	if terminalWidth, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		// Each column has a border on its left, and the last one also on its right
+		fitColumnWidths(widths, terminalWidth-len(widths)-1-tablePadding*len(widths))
+	}
+
+	border := func(left string, middle string, right string) {
+		parts := make([]string, len(widths))
+		for i, width := range widths {
+			parts[i] = strings.Repeat("─", width+tablePadding)
+		}
+
+		fmt.Println(left + strings.Join(parts, middle) + right)
+	}
+
+	printRow := func(values []string, style func(string) string) {
+		wrapped := make([][]string, len(values))
+		height := 1
+
+		for i, value := range values {
+			wrapped[i] = wrapText(value, widths[i])
+			height = max(height, len(wrapped[i]))
+		}
+
+		for line := range height {
+			cells := make([]string, len(values))
+
+			for i := range values {
+				text := ""
+				if line < len(wrapped[i]) {
+					text = wrapped[i][line]
+				}
+
+				cells[i] = style(padText(text, widths[i]+tablePadding))
+			}
+
+			fmt.Println("│" + strings.Join(cells, "│") + "│")
+		}
+	}
+
+	border("┌", "┬", "┐")
+
+	if !options.noHeader {
+		printRow(shaped.headers, options.bold)
+		border("├", "┼", "┤")
+	}
+
+	for _, row := range shaped.rows {
+		printRow(row, func(text string) string { return text })
+	}
+
+	border("└", "┴", "┘")
+
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// shape sorts the rows by the --sort-by column and keeps the --columns columns, in their order.
+func (t table) shape(options tableOptions) (table, error) {
+	if options.sortBy != "" {
+		name, descending := strings.CutPrefix(options.sortBy, "-")
+
+		index, err := t.columnIndex(name)
+		if err != nil {
+			return table{}, err
+		}
+
+		rows := append([][]string(nil), t.rows...)
+
+		sort.SliceStable(rows, func(i, j int) bool {
+			if descending {
+				return lessTableValue(rows[j][index], rows[i][index])
+			}
+
+			return lessTableValue(rows[i][index], rows[j][index])
+		})
+
+		t.rows = rows
+	}
+
+	if options.columns == "" {
+		return t, nil
+	}
+
+	var indexes []int
+
+	for _, name := range strings.Split(options.columns, ",") {
+		index, err := t.columnIndex(strings.TrimSpace(name))
+		if err != nil {
+			return table{}, err
+		}
+
+		indexes = append(indexes, index)
+	}
+
+	pick := func(values []string) []string {
+		picked := make([]string, len(indexes))
+		for i, index := range indexes {
+			picked[i] = values[index]
+		}
+
+		return picked
+	}
+
+	shaped := table{headers: pick(t.headers)}
+
+	for _, row := range t.rows {
+		shaped.rows = append(shaped.rows, pick(row))
+	}
+
+	return shaped, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// columnIndex finds a column by name. Case, spaces, dashes and underscores are ignored, so that
+// "Instance ID", "instance-id" and "instanceid" name the same column.
+func (t table) columnIndex(name string) (int, error) {
+	for i, header := range t.headers {
+		if columnKey(header) == columnKey(name) {
+			return i, nil
+		}
+	}
+
+	names := make([]string, len(t.headers))
+	for i, header := range t.headers {
+		names[i] = strings.ToLower(strings.ReplaceAll(header, " ", "-"))
+	}
+
+	return 0, fmt.Errorf("unknown column '%s', expected one of: %s", name, strings.Join(names, ", "))
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+func columnKey(name string) string {
+	return strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(name))
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// lessTableValue orders numbers, such as ports, by value and other values alphabetically.
+func lessTableValue(a string, b string) bool {
+	numberA, errA := strconv.ParseFloat(a, 64)
+	numberB, errB := strconv.ParseFloat(b, 64)
+
+	if errA == nil && errB == nil {
+		return numberA < numberB
+	}
+
+	return strings.ToLower(a) < strings.ToLower(b)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// fitColumnWidths narrows the widest columns, one character at a time, until the columns fit in
+// the available width or none can be narrowed further.
+func fitColumnWidths(widths []int, available int) {
+	total := 0
+	for _, width := range widths {
+		total += width
+	}
+
+	for total > available {
+		widest := 0
+		for i, width := range widths {
+			if width > widths[widest] {
+				widest = i
+			}
+		}
+
+		if widths[widest] <= minTableColumnWidth {
+			return
+		}
+
+		widths[widest]--
+		total--
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// wrapText splits text into lines of at most width characters, after a space, dash, comma or
+// slash where possible.
+func wrapText(text string, width int) []string {
+	var lines []string
+	runes := []rune(text)
+
+	for len(runes) > width {
+		cut := width
+
+		for i := width; i > 0; i-- {
+			if strings.ContainsRune(" -,/", runes[i-1]) {
+				cut = i
+				break
+			}
+		}
+
+		lines = append(lines, strings.TrimRight(string(runes[:cut]), " "))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+	}
+
+	return append(lines, string(runes))
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// padText pads text with spaces to width characters.
+func padText(text string, width int) string {
+	return text + strings.Repeat(" ", max(0, width-utf8.RuneCountInString(text)))
+}
@@ -4,7 +4,6 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"os/exec"
 	"os/signal"
 )
 
@@ -17,10 +16,13 @@ func startSSMSession(args []string, config *Configuration) error {
 	instanceHost := flagSet.String("host", "", "--host <instance host>")
 	instanceHostShort := flagSet.String("h", "", "--host <instance host>")
 
+	var regions regionFlags
+	regions.register(flagSet)
+
 	flagSet.Usage = func() {
 		fmt.Println("USAGE:")
-		fmt.Println("    awsdo terminal [--profile <aws cli profile>] [<instance name>]")
-		fmt.Println("    awsdo terminal [--profile <aws cli profile>] [--host <instance host>]")
+		fmt.Println("    awsdo terminal [--profile <aws cli profile>] [--region <region> ... | --all-regions] [<instance name>]")
+		fmt.Println("    awsdo terminal [--profile <aws cli profile>] [--region <region> ... | --all-regions] [--host <instance host>]")
 	}
 
 	if err := flagSet.Parse(args); err != nil {
@@ -209,17 +211,6 @@ func startSSMSession(args []string, config *Configuration) error {
 		return fmt.Errorf("instance ID must be specified")
 	}
 
-	commandArgs := []string{
-		"ssm",
-		"start-session",
-		"--target",
-		instance.ID,
-	}
-
-	if len(currentProfile) != 0 {
-		commandArgs = append(commandArgs, "--profile", currentProfile)
-	}
-
 	// Ensure that we're logged in before running the command.
 	if !isLoggedIn(currentProfile) {
 		loginArgs := []string{}
@@ -231,6 +222,13 @@ func startSSMSession(args []string, config *Configuration) error {
 		login(loginArgs, config)
 	}
 
+	// --region and --all-regions find the instance's region and remember it for later sessions
+	if regions.given() {
+		if err := updateInstanceRegion(&instance, currentProfile, regions, config); err != nil {
+			return err
+		}
+	}
+
 	// Let's set up to prevent Ctrl-C from killing the program. Instead, it must
 	// be handled with the SSM session.
 	signalChan := make(chan os.Signal, 1)
@@ -247,12 +245,9 @@ func startSSMSession(args []string, config *Configuration) error {
 
 	fmt.Println("\nStarting SSM session...")
 
-	command := exec.Command("aws", commandArgs...)
-	command.Stdout = os.Stdout
-	command.Stderr = os.Stderr
-	command.Stdin = os.Stdin
+	sessionArgs := append([]string{"ssm", "start-session", "--target", instance.ID}, regionArgs(instance.Region)...)
 
-	if err = command.Run(); err != nil {
+	if err = awsRunner.Run(currentProfile, sessionArgs...); err != nil {
 		return err
 	}
 
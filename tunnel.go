@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultReconnectInitialDelay = 1 * time.Second
+	defaultReconnectMaxDelay     = 60 * time.Second
+
+	// A session that stays up this long starts a fresh series of reconnect attempts
+	tunnelStableDuration = time.Minute
+
+	tunnelStatusInterval      = 250 * time.Millisecond
+	defaultTunnelReadyTimeout = 60 * time.Second
+)
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// runTunnel runs the bastion's port forwarding session until it ends or Ctrl-C is pressed. With
+// a reconnect policy, the session is restarted with exponential backoff whenever it drops. A
+// background tunnel reports whether its session is ready in the stats file.
+func runTunnel(bastion Bastion, profile string, policy *ReconnectPolicy, statsFile string, signalChan chan os.Signal, config *Configuration) error {
+	attempt := 0
+
+	fmt.Printf("\nStarting port forwarding session to %s...\n", describeTunnelTarget(bastion))
+	fmt.Println("Press Ctrl-C to stop the tunnel and return to the REPL.")
+
+	for {
+		started := time.Now()
+
+		interrupted, err := runTunnelSession(bastion, profile, statsFile, signalChan)
+		if interrupted {
+			return nil
+		}
+
+		if policy == nil || !policy.Enabled {
+			return err
+		}
+
+		if time.Since(started) >= tunnelStableDuration {
+			attempt = 0
+		}
+
+		attempt++
+
+		if policy.MaxRetries > 0 && attempt > policy.MaxRetries {
+			if err != nil {
+				return fmt.Errorf("giving up after %d reconnect attempts: %v", policy.MaxRetries, err)
+			}
+
+			return fmt.Errorf("giving up after %d reconnect attempts", policy.MaxRetries)
+		}
+
+		reason := "the session ended"
+		if err != nil {
+			reason = err.Error()
+		}
+
+		attemptText := fmt.Sprintf("attempt %d", attempt)
+		if policy.MaxRetries > 0 {
+			attemptText = fmt.Sprintf("attempt %d of %d", attempt, policy.MaxRetries)
+		}
+
+		delay := reconnectDelay(policy, attempt)
+		fmt.Printf("\nTunnel down: %s. Reconnecting in %s (%s)...\n", reason, delay, attemptText)
+
+		select {
+		case <-signalChan:
+			fmt.Println("\nStopping tunnel...")
+			return nil
+		case <-time.After(delay):
+		}
+
+		// SSO sessions expire while long-running tunnels are up, so log in again if needed
+		if !isLoggedIn(profile) {
+			fmt.Println("\nYour AWS session is no longer valid. Logging in again...")
+
+			loginArgs := []string{}
+
+			if len(profile) != 0 {
+				loginArgs = append(loginArgs, "--profile", profile)
+			}
+
+			if err := login(loginArgs, config); err != nil {
+				fmt.Printf("Login failed: %v\n", err)
+			}
+		}
+
+		// The instance may have been replaced while the session was down
+		if err := refreshBastionInstance(&bastion, profile, config); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+
+		fmt.Printf("\nReconnecting to %s...\n", describeTunnelTarget(bastion))
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// runTunnelSession runs one port forwarding session. It reports whether the session was stopped
+// with Ctrl-C, and otherwise why it ended.
+func runTunnelSession(bastion Bastion, profile string, statsFile string, signalChan chan os.Signal) (bool, error) {
+	// The session's output is watched for the message that its port is open
+	readyWriter := newSessionReadyWriter(sessionOutput)
+	previousOutput := sessionOutput
+	sessionOutput = readyWriter
+
+	process, err := startPortForwardingSession(bastion, profile, bastion.LocalPort)
+	sessionOutput = previousOutput
+
+	if err != nil {
+		return false, fmt.Errorf("failed to start session: %v", err)
+	}
+
+	// Wait for command completion or interrupt in a goroutine
+	done := make(chan error, 1)
+	go func() {
+		done <- process.Wait()
+	}()
+
+	// Announce when the local port starts accepting connections
+	sessionEnded := make(chan struct{})
+	defer close(sessionEnded)
+	defer writeTunnelStats(statsFile, tunnelStats{})
+
+	go func() {
+		select {
+		case <-readyWriter.ready:
+			fmt.Printf("\nTunnel ready: %s -> %s\n", localAddress(bastion.LocalPort), tunnelRemoteAddress(bastion))
+			writeTunnelStats(statsFile, tunnelStats{Ready: true})
+		case <-sessionEnded:
+		}
+	}()
+
+	select {
+	case <-signalChan:
+		// Signal received (Ctrl-C) - kill the command process
+		fmt.Println("\nStopping tunnel...")
+		if err := process.Kill(); err != nil {
+			return true, fmt.Errorf("failed to kill process: %v", err)
+		}
+
+		// Wait for the process to actually terminate
+		<-done
+
+		// Don't return an error - just return to REPL
+		return true, nil
+	case err := <-done:
+		// Command completed normally
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				// If the process was terminated by a signal, don't treat it as an error
+				if exitErr.ExitCode() == -1 {
+					return false, nil
+				}
+			}
+			return false, fmt.Errorf("session ended with error: %v", err)
+		}
+
+		return false, nil
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// startPortForwardingSession starts an SSM session forwarding the local port to the bastion's
+// remote host and port. Without a remote host, the port on the instance itself is forwarded.
+func startPortForwardingSession(bastion Bastion, profile string, localPort int) (AWSProcess, error) {
+	document := "AWS-StartPortForwardingSessionToRemoteHost"
+	parameters := fmt.Sprintf(`host="%s",portNumber="%d",localPortNumber="%d"`, bastion.Host, bastion.Port, localPort)
+
+	if bastion.Host == "" {
+		document = "AWS-StartPortForwardingSession"
+		parameters = fmt.Sprintf(`portNumber="%d",localPortNumber="%d"`, bastion.Port, localPort)
+	}
+
+	args := []string{
+		"ssm",
+		"start-session",
+		"--target",
+		bastion.Instance,
+		"--document-name",
+		document,
+		"--parameters",
+		parameters,
+	}
+
+	return awsRunner.Start(profile, append(args, regionArgs(bastion.Region)...)...)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// describeTunnelTarget describes where a tunnel leads, for progress messages.
+func describeTunnelTarget(bastion Bastion) string {
+	if bastion.Host == "" {
+		return fmt.Sprintf("port %d on instance %s", bastion.Port, bastion.Instance)
+	}
+
+	return fmt.Sprintf("%s:%d via bastion %s", bastion.Host, bastion.Port, bastion.Instance)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// tunnelRemoteAddress returns the remote end of a tunnel as host:port.
+func tunnelRemoteAddress(bastion Bastion) string {
+	return net.JoinHostPort(firstNonEmpty(bastion.Host, bastion.Instance), strconv.Itoa(bastion.Port))
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// reconnectDelay doubles the wait after each failed attempt, up to the policy's maximum.
+func reconnectDelay(policy *ReconnectPolicy, attempt int) time.Duration {
+	delay := defaultReconnectInitialDelay
+	if policy.InitialDelay > 0 {
+		delay = time.Duration(policy.InitialDelay) * time.Second
+	}
+
+	maxDelay := defaultReconnectMaxDelay
+	if policy.MaxDelay > 0 {
+		maxDelay = time.Duration(policy.MaxDelay) * time.Second
+	}
+
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxDelay)
+}
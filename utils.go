@@ -3,33 +3,43 @@ package main
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"flag"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
+
+	"golang.org/x/term"
 )
 
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
 func findAvailableLocalPort(startPort int) (int, error) {
-	for port := startPort; port < startPort+1000; port++ {
-		// Try to listen on all interfaces (same as HTTP server will use)
-		// This checks if the port is truly available for binding
-		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
-		if err == nil {
-			// Port is available - close the listener immediately
-			listener.Close()
-
-			// Small delay to ensure port is fully released (especially on Windows)
-			time.Sleep(10 * time.Millisecond)
-
-			return port, nil
-		}
+	return nextFreeLocalPort(startPort, nil)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// isLocalPortAvailable reports whether a local TCP port can be bound.
+func isLocalPortAvailable(port int) bool {
+	// Try to listen on the address tunnels and the docs server use
+	// This checks if the port is truly available for binding
+	listener, err := net.Listen("tcp", localAddress(port))
+	if err != nil {
+		return false
 	}
 
-	return 0, fmt.Errorf("could not find available port starting from %d", startPort)
+	// Port is available - close the listener immediately
+	listener.Close()
+
+	// Small delay to ensure port is fully released (especially on Windows)
+	time.Sleep(10 * time.Millisecond)
+
+	return true
 }
 
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
@@ -55,3 +65,121 @@ func setupSignalHandler(sigChan chan os.Signal) {
 		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	}
 }
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// sortedKeys returns the keys of a string-keyed map in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// forEachConcurrently calls fn with each index below count, running at most limit calls at the
+// same time, and returns when all of them have returned.
+func forEachConcurrently(count int, limit int, fn func(i int)) {
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for range min(count, limit) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := range count {
+		indexes <- i
+	}
+
+	close(indexes)
+	wg.Wait()
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// parseFlags parses args with the flag set while allowing positional arguments to appear before
+// or between flags (e.g. "awsdo backend native --profile dev"). It returns the positional
+// arguments in order.
+func parseFlags(flagSet *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+
+	for {
+		if err := flagSet.Parse(args); err != nil {
+			return nil, err
+		}
+
+		args = flagSet.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// isInteractive reports whether stdin is a terminal that the user can answer prompts on.
+func isInteractive() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// isOutputTerminal reports whether stdout is a terminal rather than a pipe or a file.
+func isOutputTerminal() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// errNotInteractive reports a value that would be prompted for when stdin is not a terminal.
+func errNotInteractive(missing string) error {
+	return fmt.Errorf("%s is required when stdin is not a terminal", missing)
+}
+
+// stringListFlag collects the values of a flag that may be given more than once.
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// splitPassthroughArgs splits args at the first "--". The arguments after it are passed on to
+// another program untouched.
+func splitPassthroughArgs(args []string) ([]string, []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+
+	return args, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// firstNonEmpty returns the first of the values that is not empty.
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
@@ -3,9 +3,17 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
@@ -16,3 +24,136 @@ func setupSignalHandlerWindows(sigChan chan os.Signal) {
 	// Standard signal handling is used instead
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 }
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// waitForStdin reports whether standard input has data to read within the timeout.
+func waitForStdin(timeout time.Duration) (bool, error) {
+	fds := []unix.PollFd{{Fd: int32(os.Stdin.Fd()), Events: unix.POLLIN}}
+
+	count, err := unix.Poll(fds, int(timeout.Milliseconds()))
+	if err == unix.EINTR {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// detachedProcessAttributes starts a child in its own session so it outlives the terminal.
+func detachedProcessAttributes() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+// processTree is a background command together with the processes it starts, for example the AWS
+// CLI and the session-manager-plugin it runs. On Unix the tree is a process group.
+type processTree struct {
+	pid int
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// startProcessTree starts the command in a process group of its own, which can be signalled as a
+// whole and which the terminal's Ctrl-C does not reach.
+func startProcessTree(command *exec.Cmd) (*processTree, error) {
+	if command.SysProcAttr == nil {
+		command.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	command.SysProcAttr.Setpgid = true
+
+	if err := command.Start(); err != nil {
+		return nil, err
+	}
+
+	return &processTree{pid: command.Process.Pid}, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// stop asks every process in the tree to exit, giving them the chance to clean up.
+func (t *processTree) stop() error {
+	return syscall.Kill(-t.pid, syscall.SIGTERM)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// kill ends every process in the tree at once.
+func (t *processTree) kill() error {
+	return syscall.Kill(-t.pid, syscall.SIGKILL)
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// release frees what the tree holds once its command has exited. A process group needs nothing.
+func (t *processTree) release() {}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// listeningProcess finds the process listening on a local TCP port with lsof, or from /proc on
+// Linux when lsof is not installed. The PID is 0 when the process cannot be found, for example
+// when it belongs to another user.
+func listeningProcess(port int) (int, string) {
+	output, err := exec.Command("lsof", "-nP", fmt.Sprintf("-iTCP:%d", port), "-sTCP:LISTEN", "-Fpc").Output()
+	if err != nil {
+		return procListeningProcess(port)
+	}
+
+	pid, name := 0, ""
+
+	for _, line := range strings.Split(string(output), "\n") {
+		switch {
+		case strings.HasPrefix(line, "p") && pid == 0:
+			pid, _ = strconv.Atoi(line[1:])
+		case strings.HasPrefix(line, "c") && name == "":
+			name = line[1:]
+		}
+	}
+
+	return pid, name
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// procListeningProcess finds the listening socket's inode in /proc/net and then the process
+// holding a descriptor for it.
+func procListeningProcess(port int) (int, string) {
+	const tcpListen = "0A"
+
+	inodes := make(map[string]bool)
+
+	for _, table := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		data, err := os.ReadFile(table)
+		if err != nil {
+			continue
+		}
+
+		for _, line := range strings.Split(string(data), "\n")[1:] {
+			fields := strings.Fields(line)
+			if len(fields) < 10 || fields[3] != tcpListen {
+				continue
+			}
+
+			_, hexPort, _ := strings.Cut(fields[1], ":")
+
+			if localPort, err := strconv.ParseInt(hexPort, 16, 32); err == nil && int(localPort) == port {
+				inodes["socket:["+fields[9]+"]"] = true
+			}
+		}
+	}
+
+	if len(inodes) == 0 {
+		return 0, ""
+	}
+
+	descriptors, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+
+	for _, descriptor := range descriptors {
+		if target, err := os.Readlink(descriptor); err == nil && inodes[target] {
+			processDir := filepath.Dir(filepath.Dir(descriptor))
+			pid, _ := strconv.Atoi(filepath.Base(processDir))
+			name, _ := os.ReadFile(filepath.Join(processDir, "comm"))
+
+			return pid, strings.TrimSpace(string(name))
+		}
+	}
+
+	return 0, ""
+}
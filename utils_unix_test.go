@@ -0,0 +1,103 @@
+//go:build !windows
+
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// Killing a background process also ends the processes it started, the way the AWS CLI starts
+// session-manager-plugin.
+func TestBackgroundProcessKillEndsChildren(t *testing.T) {
+	previousOutput := sessionOutput
+	sessionOutput = io.Discard
+	t.Cleanup(func() { sessionOutput = previousOutput })
+
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+
+	process, err := startBackgroundProcess(exec.Command("sh", "-c", `sleep 60 & echo $! > "$0"; wait`, pidFile))
+	if err != nil {
+		t.Fatalf("startBackgroundProcess: %v", err)
+	}
+
+	var child int
+	deadline := time.Now().Add(5 * time.Second)
+
+	for child == 0 && time.Now().Before(deadline) {
+		pidBytes, _ := os.ReadFile(pidFile)
+		child, _ = strconv.Atoi(strings.TrimSpace(string(pidBytes)))
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if child == 0 {
+		t.Fatalf("the child process did not start")
+	}
+
+	if err := process.Kill(); err != nil {
+		t.Fatalf("Kill: %v", err)
+	}
+
+	process.Wait()
+
+	deadline = time.Now().Add(5 * time.Second)
+	for processRunning(child) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if processRunning(child) {
+		t.Errorf("child process %d outlived the killed process", child)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// A background process runs outside the console's process group, so Ctrl-C meant for a client
+// like psql does not reach it, and it does not read the console.
+func TestBackgroundProcessDetachedFromConsole(t *testing.T) {
+	previousOutput := sessionOutput
+	sessionOutput = io.Discard
+	t.Cleanup(func() { sessionOutput = previousOutput })
+
+	command := exec.Command("sh", "-c", "cat; sleep 60")
+
+	process, err := startBackgroundProcess(command)
+	if err != nil {
+		t.Fatalf("startBackgroundProcess: %v", err)
+	}
+	defer process.Kill()
+
+	if command.Stdin != nil {
+		t.Errorf("the process was given the console's input")
+	}
+
+	group, err := syscall.Getpgid(command.Process.Pid)
+	if err != nil {
+		t.Fatalf("Getpgid: %v", err)
+	}
+
+	if group == syscall.Getpgrp() {
+		t.Errorf("the process shares awsdo's process group %d", group)
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// processRunning reports whether a process exists and has not exited. An orphan that nobody
+// reaps stays a zombie, which counts as exited.
+func processRunning(pid int) bool {
+	output, err := exec.Command("ps", "-o", "stat=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return false
+	}
+
+	state := strings.TrimSpace(string(output))
+
+	return state != "" && !strings.HasPrefix(state, "Z")
+}
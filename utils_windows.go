@@ -3,9 +3,18 @@
 package main
 
 import (
+	"encoding/csv"
 	"os"
+	"os/exec"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
 )
 
 // - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
@@ -43,3 +52,165 @@ func setupSignalHandlerWindows(sigChan chan os.Signal) {
 	// Also set up standard signal handling as a fallback
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 }
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// waitForStdin reports whether standard input has data to read within the timeout.
+func waitForStdin(timeout time.Duration) (bool, error) {
+	kernel32 := syscall.NewLazyDLL("kernel32.dll")
+	waitForSingleObject := kernel32.NewProc("WaitForSingleObject")
+
+	// WAIT_OBJECT_0 = 0, WAIT_TIMEOUT = 0x102, WAIT_FAILED = 0xFFFFFFFF
+	ret, _, err := waitForSingleObject.Call(os.Stdin.Fd(), uintptr(timeout.Milliseconds()))
+
+	switch ret {
+	case 0:
+		return true, nil
+	case 0x102:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// detachedProcessAttributes starts a child without a console so it outlives the terminal.
+func detachedProcessAttributes() *syscall.SysProcAttr {
+	// DETACHED_PROCESS = 0x8, CREATE_NEW_PROCESS_GROUP = 0x200
+	return &syscall.SysProcAttr{CreationFlags: 0x00000008 | 0x00000200}
+}
+
+// processTree is a background command together with the processes it starts, for example the AWS
+// CLI and the session-manager-plugin it runs. On Windows the tree is a job object, which the
+// processes started by the command join as well.
+type processTree struct {
+	mu      sync.Mutex
+	process *os.Process
+	job     windows.Handle
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// startProcessTree starts the command in a process group of its own, so the console's Ctrl-C
+// does not reach it, and assigns it to a job that is killed when awsdo exits. If the job cannot be
+// set up, for example on Windows versions without nested jobs, only the command itself is killed.
+func startProcessTree(command *exec.Cmd) (*processTree, error) {
+	if command.SysProcAttr == nil {
+		command.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	command.SysProcAttr.CreationFlags |= windows.CREATE_NEW_PROCESS_GROUP
+
+	if err := command.Start(); err != nil {
+		return nil, err
+	}
+
+	tree := &processTree{process: command.Process}
+
+	// The command is assigned straight away, long before the AWS CLI gets to start the plugin
+	if job, err := newProcessJob(command.Process.Pid); err == nil {
+		tree.job = job
+	}
+
+	return tree, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// newProcessJob creates a job that kills its processes once its last handle is closed, and
+// assigns the process to it.
+func newProcessJob(pid int) (windows.Handle, error) {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	limits := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+	limits.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+
+	_, err = windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&limits)), uint32(unsafe.Sizeof(limits)))
+
+	if err == nil {
+		var process windows.Handle
+
+		process, err = windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(pid))
+		if err == nil {
+			err = windows.AssignProcessToJobObject(job, process)
+			windows.CloseHandle(process)
+		}
+	}
+
+	if err != nil {
+		windows.CloseHandle(job)
+		return 0, err
+	}
+
+	return job, nil
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// stop ends the tree. Windows cannot deliver SIGTERM, so it is killed.
+func (t *processTree) stop() error {
+	return t.kill()
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// kill ends every process in the job, or only the command when it has no job.
+func (t *processTree) kill() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.job != 0 {
+		return windows.TerminateJobObject(t.job, 1)
+	}
+
+	return t.process.Kill()
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// release closes the job once the command has exited, which also ends any process it left behind.
+func (t *processTree) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.job != 0 {
+		windows.CloseHandle(t.job)
+		t.job = 0
+	}
+}
+
+// - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+// listeningProcess finds the process listening on a local TCP port with netstat and tasklist.
+// The PID is 0 when the process cannot be found.
+func listeningProcess(port int) (int, string) {
+	output, err := exec.Command("netstat", "-ano", "-p", "TCP").Output()
+	if err != nil {
+		return 0, ""
+	}
+
+	pid := 0
+	suffix := ":" + strconv.Itoa(port)
+
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+
+		if len(fields) >= 5 && fields[3] == "LISTENING" && strings.HasSuffix(fields[1], suffix) {
+			pid, _ = strconv.Atoi(fields[4])
+			break
+		}
+	}
+
+	if pid == 0 {
+		return 0, ""
+	}
+
+	output, err = exec.Command("tasklist", "/FI", "PID eq "+strconv.Itoa(pid), "/FO", "CSV", "/NH").Output()
+	if err != nil {
+		return pid, ""
+	}
+
+	record, err := csv.NewReader(strings.NewReader(string(output))).Read()
+	if err != nil || len(record) < 2 {
+		return pid, ""
+	}
+
+	return pid, record[0]
+}